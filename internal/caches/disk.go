@@ -35,12 +35,13 @@ type Disk struct {
 	DiskConfig
 }
 
-// requestToFilename sanitizes LayerName (see safeLayerName) so a traversal sequence can't reach
+// requestToFilename sanitizes LayerName and Variant (see safeLayerName) so a traversal sequence can't reach
 // outside the cache directory. The rest of the name is left alone so filenames stay readable and
 // caches written by earlier versions keep matching.
 func requestToFilename(t pkg.TileRequest) string {
 	safe := t
 	safe.LayerName = safeLayerName(t.LayerName)
+	safe.Variant = safeLayerName(t.Variant)
 	return safe.StringWithSeparator("_")
 }
 
@@ -69,3 +69,35 @@ func TestDisk_LayerNamePathTraversalIsContained(t *testing.T) {
 	require.NotNil(t, result)
 	require.Equal(t, img.Content, result.Content)
 }
+
+// A variant is kept apart from a layer whose name looks like the layer name and variant together
+func TestDisk_VariantsAreSeparate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "tilegroxy-test-disk")
+	defer os.RemoveAll(dir)
+	require.NoError(t, err)
+
+	c, err := DiskRegistration{}.Initialize(DiskConfig{Path: dir}, cache.CacheDeps{ErrorMessages: config.ErrorMessages{}})
+	require.NoError(t, err)
+
+	tiles := []pkg.TileRequest{
+		{LayerName: "base", Z: 1, X: 2, Y: 3},
+		{LayerName: "base", Z: 1, X: 2, Y: 3, Variant: "jpeg"},
+		{LayerName: "base.jpeg", Z: 1, X: 2, Y: 3},
+		{LayerName: "base", Z: 1, X: 2, Y: 3, Variant: "../webp"},
+	}
+
+	for _, tile := range tiles {
+		require.NoError(t, c.Save(context.Background(), tile, &pkg.Image{Content: []byte(tile.LayerName + "|" + tile.Variant)}))
+	}
+
+	for _, tile := range tiles {
+		result, err := c.Lookup(context.Background(), tile)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		require.Equal(t, []byte(tile.LayerName+"|"+tile.Variant), result.Content)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, len(tiles))
+}
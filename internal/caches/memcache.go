@@ -90,11 +90,12 @@ func (s MemcacheRegistration) Initialize(configAny any, deps cache.CacheDeps) (c
 
 }
 
-// memcacheKey sanitizes LayerName (see safeLayerName) since memcache keys can't contain whitespace
+// memcacheKey sanitizes LayerName and Variant (see safeLayerName) since memcache keys can't contain whitespace
 // or control characters, then bounds the total length, which KeyPrefix counts toward.
 func memcacheKey(prefix string, t pkg.TileRequest) string {
 	safe := t
 	safe.LayerName = safeLayerName(t.LayerName)
+	safe.Variant = safeLayerName(t.Variant)
 	return safeMemcacheKey(prefix, safe.String())
 }
 
@@ -23,7 +23,6 @@ import (
 	"fmt"
 	"io"
 	"slices"
-	"strconv"
 	"strings"
 
 	"github.com/Michad/tilegroxy/pkg"
@@ -129,11 +128,14 @@ func (s S3Registration) Initialize(configAny any, deps cache.CacheDeps) (cache.C
 	return &S3{config, client, transfer}, nil
 }
 
-// calcKey sanitizes LayerName (see safeLayerName) so a request can't smuggle "/" into the object
-// key and produce an unexpected hierarchy in the bucket. The path/layer/z/x/y shape is preserved
-// so lifecycle rules and prefix-scoped IAM policies keep working.
+// calcKey sanitizes LayerName and Variant (see safeLayerName) so a request can't smuggle "/" into the
+// object key and produce an unexpected hierarchy in the bucket. The path/layer/z/x/y shape is
+// preserved so lifecycle rules and prefix-scoped IAM policies keep working.
 func calcKey(config *S3, t *pkg.TileRequest) string {
-	return config.Path + safeLayerName(t.LayerName) + "/" + strconv.Itoa(t.Z) + "/" + strconv.Itoa(t.X) + "/" + strconv.Itoa(t.Y)
+	safe := *t
+	safe.LayerName = safeLayerName(t.LayerName)
+	safe.Variant = safeLayerName(t.Variant)
+	return config.Path + safe.String()
 }
 
 // Just for testing purposes
@@ -105,6 +105,18 @@ func parseColor(fullStr string) (color.Color, error) {
 	return colObj, errors.New("invalid color")
 }
 
+// ParseColor reads a color in the hex notation accepted after "color:" by GetStaticImage, with an
+// optional leading "#". The channels are returned as written, without premultiplying by alpha
+func ParseColor(str string) (color.NRGBA, error) {
+	col, err := parseColor(KeyPrefixColor + strings.TrimPrefix(str, "#"))
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	rgba := col.(color.RGBA)
+	return color.NRGBA{rgba.R, rgba.G, rgba.B, rgba.A}, nil
+}
+
 // Returns the contents of an image. This can be an embedded image if path starts with "embedded:". The path will be treated as a standard filepath otherwise.  The contents of the image will be permanently cached in memory, this should be only used for images that will be reused a lot such as error responses. Errors will also be cached but 1% of the time it will be retried.
 func GetStaticImage(path string) (*[]byte, error) {
 	if path == KeyImageError {
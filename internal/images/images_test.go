@@ -103,3 +103,16 @@ func TestDefaultConfigImageKeysMatchEmbeddedKeys(t *testing.T) {
 		assert.NotNil(t, img)
 	}
 }
+
+func TestParseColor(t *testing.T) {
+	col, err := ParseColor("#f018")
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{255, 0, 17, 0x88}, col)
+
+	col, err = ParseColor("00ff00")
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0, 255, 0, 255}, col)
+
+	_, err = ParseColor("")
+	require.Error(t, err)
+}
@@ -0,0 +1,519 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultCogTileSize = 256
+const cogFetchConcurrency = 8
+const webMercatorRadius = 6378137
+
+const (
+	cogResamplingNearest  = "nearest"
+	cogResamplingBilinear = "bilinear"
+)
+
+var allCogResampling = []string{cogResamplingNearest, cogResamplingBilinear}
+var allCogFormats = []string{"png", "jpeg"}
+
+// ExtraSamples values that mark a band as alpha
+const (
+	tiffExtraSampleAssociatedAlpha   = 1
+	tiffExtraSampleUnassociatedAlpha = 2
+)
+
+type COGConfig struct {
+	File       string    // Path to a GeoTIFF on the local filesystem
+	URL        string    // URL of a GeoTIFF on a server supporting HTTP range requests
+	Bands      []uint    // Which bands to render, 1-indexed. One band is grayscale, two is grayscale and alpha, three is RGB, four is RGBA. Defaults to the color bands of the file
+	NoData     *float64  // Value marking a pixel without data. Defaults to the value in the file, if any
+	Rescale    []float64 // The minimum and maximum sample value, mapped to 0 and 255 in the output. Defaults to the full range of the data type
+	Resampling string    // How to sample the source pixels: nearest or bilinear. Defaults to nearest
+	Format     string    // The image format to output: png or jpeg. Defaults to png
+	Quality    int       // The quality of jpeg output, 1-100. Defaults to 75
+	TileSize   uint16    // The width and height of the output in pixels. Defaults to 256
+	Srid       uint      // The projection of the file, for files that don't identify it in a way this provider understands. 3857 or 4326
+}
+
+type COG struct {
+	COGConfig
+	reader rangeReader
+	// Guards structure, which is loaded on first use so an unreachable file doesn't stop startup
+	mu        sync.Mutex
+	structure *cogStructure
+}
+
+func init() {
+	layer.RegisterProvider(COGRegistration{})
+}
+
+type COGRegistration struct {
+}
+
+func (s COGRegistration) InitializeConfig() any {
+	return COGConfig{}
+}
+
+func (s COGRegistration) Name() string {
+	return "cog"
+}
+
+func (s COGRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(COGConfig)
+
+	if cfg.Resampling == "" {
+		cfg.Resampling = cogResamplingNearest
+	}
+	if !slices.Contains(allCogResampling, cfg.Resampling) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.cog.resampling", cfg.Resampling, allCogResampling)
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = "png"
+	}
+	if cfg.Format == "jpg" {
+		cfg.Format = "jpeg"
+	}
+	if !slices.Contains(allCogFormats, cfg.Format) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.cog.format", cfg.Format, allCogFormats)
+	}
+
+	if cfg.Quality == 0 {
+		cfg.Quality = jpeg.DefaultQuality
+	}
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.cog.quality", 1, 100)
+	}
+
+	if cfg.TileSize == 0 {
+		cfg.TileSize = defaultCogTileSize
+	}
+
+	if cfg.Srid != 0 && cfg.Srid != pkg.SRIDPsuedoMercator && cfg.Srid != pkg.SRIDWGS84 {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.cog.srid", cfg.Srid, []int{pkg.SRIDPsuedoMercator, pkg.SRIDWGS84})
+	}
+
+	if len(cfg.Bands) > 4 {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.cog.bands.length", 1, 4)
+	}
+	if slices.Contains(cfg.Bands, 0) {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.cog.bands", cfg.Bands)
+	}
+
+	if len(cfg.Rescale) != 0 && (len(cfg.Rescale) != 2 || cfg.Rescale[0] == cfg.Rescale[1]) {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.cog.rescale", cfg.Rescale)
+	}
+
+	reader, err := newRangeReader(cfg.File, cfg.URL, deps.ClientConfig, deps.ErrorMessages, "provider.cog")
+	if err != nil {
+		return nil, err
+	}
+
+	return &COG{COGConfig: cfg, reader: reader}, nil
+}
+
+func (t *COG) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthBypass: true}, nil
+}
+
+func (t *COG) GenerateTile(ctx context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	bounds, err := tileRequest.GetBoundsProjection(pkg.SRIDPsuedoMercator)
+	if err != nil {
+		return nil, err
+	}
+
+	structure, err := t.loadStructure(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	srid := structure.srid
+	if t.Srid != 0 {
+		srid = t.Srid
+	}
+	if srid == 0 {
+		return nil, fmt.Errorf("projection of %v is unsupported, only EPSG:3857 and EPSG:4326 can be read", t.source())
+	}
+
+	bands, alpha, err := t.selectBands(structure)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(t.TileSize)
+	coords := cogSourceCoords(bounds, size, srid)
+	level, transform := selectCogLevel(structure, coords, size)
+
+	// Convert every output pixel center into fractional pixel coordinates in the chosen level
+	minCol, minRow, maxCol, maxRow := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i := 0; i < len(coords); i += 2 {
+		coords[i], coords[i+1] = transform.toPixel(coords[i], coords[i+1])
+		minCol, maxCol = math.Min(minCol, coords[i]), math.Max(maxCol, coords[i])
+		minRow, maxRow = math.Min(minRow, coords[i+1]), math.Max(maxRow, coords[i+1])
+	}
+
+	if maxCol < 0 || maxRow < 0 || minCol >= float64(level.width) || minRow >= float64(level.height) {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	tiles, err := t.fetchTiles(ctx, level, minCol, minRow, maxCol, maxRow)
+	if err != nil {
+		return nil, err
+	}
+
+	r := cogRenderer{
+		level:   level,
+		tiles:   tiles,
+		bands:   bands,
+		alpha:   alpha,
+		noData:  structure.noData,
+		samples: make([]float64, len(bands)),
+	}
+
+	if t.NoData != nil {
+		r.noData = t.NoData
+	}
+
+	if len(t.Rescale) == 2 {
+		r.min, r.max = t.Rescale[0], t.Rescale[1]
+	} else {
+		r.min, r.max = defaultCogRange(level)
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			i := (y*size + x) * 2
+			col, row := coords[i], coords[i+1]
+
+			if t.Resampling == cogResamplingBilinear {
+				out.SetNRGBA(x, y, r.bilinear(col, row))
+			} else {
+				out.SetNRGBA(x, y, r.nearest(col, row))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if t.Format == "jpeg" {
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: t.Quality})
+	} else {
+		err = png.Encode(&buf, out)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: pkg.Ternary(t.Format == "jpeg", mimeJpeg, mimePng)}, nil
+}
+
+// Close releases the handle on the file
+func (t *COG) Close(_ context.Context) error {
+	return t.reader.Close()
+}
+
+func (t *COG) source() string {
+	if t.File != "" {
+		return t.File
+	}
+
+	return pkg.RedactURLForLog(t.URL)
+}
+
+func (t *COG) loadStructure(ctx context.Context) (*cogStructure, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.structure != nil {
+		return t.structure, nil
+	}
+
+	slog.DebugContext(ctx, "Loading cog structure")
+
+	structure, err := readCogStructure(ctx, t.reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cog %v: %w", t.source(), err)
+	}
+
+	t.structure = structure
+
+	return structure, nil
+}
+
+// selectBands returns the 0-indexed bands to render and whether the last of them is alpha
+func (t *COG) selectBands(structure *cogStructure) ([]uint64, bool, error) {
+	spp := structure.images[0].samplesPerPixel
+
+	if len(t.Bands) > 0 {
+		bands := make([]uint64, 0, len(t.Bands))
+		for _, b := range t.Bands {
+			if uint64(b) > spp {
+				return nil, false, fmt.Errorf("band %v requested but %v only has %v bands", b, t.source(), spp)
+			}
+			bands = append(bands, uint64(b)-1)
+		}
+
+		return bands, len(bands) == 2 || len(bands) == 4, nil
+	}
+
+	colorBands := min(spp-uint64(len(structure.extraSamples)), 3)
+	if colorBands != 1 && colorBands != 3 {
+		colorBands = 1
+	}
+
+	bands := make([]uint64, 0, 4)
+	for i := range colorBands {
+		bands = append(bands, i)
+	}
+
+	// Only the first extra sample can be alpha for the band count to line up with the output
+	if len(structure.extraSamples) > 0 && colorBands < spp {
+		extra := structure.extraSamples[0]
+		if extra == tiffExtraSampleAssociatedAlpha || extra == tiffExtraSampleUnassociatedAlpha {
+			return append(bands, spp-uint64(len(structure.extraSamples))), true, nil
+		}
+	}
+
+	return bands, false, nil
+}
+
+// cogSourceCoords returns the center of every pixel of the tile in the raster's CRS, as x,y pairs
+func cogSourceCoords(bounds *pkg.Bounds, size int, srid uint) []float64 {
+	coords := make([]float64, size*size*2)
+	width := (bounds.East - bounds.West) / float64(size)
+	height := (bounds.North - bounds.South) / float64(size)
+
+	for y := range size {
+		my := bounds.North - (float64(y)+0.5)*height
+		for x := range size {
+			mx := bounds.West + (float64(x)+0.5)*width
+			i := (y*size + x) * 2
+
+			if srid == pkg.SRIDWGS84 {
+				coords[i] = mx / webMercatorRadius * 180 / math.Pi
+				coords[i+1] = math.Atan(math.Sinh(my/webMercatorRadius)) * 180 / math.Pi
+			} else {
+				coords[i] = mx
+				coords[i+1] = my
+			}
+		}
+	}
+
+	return coords
+}
+
+// selectCogLevel picks the lowest resolution level that still has at least as much detail as the
+// tile, falling back to full resolution when zoomed in past it
+func selectCogLevel(structure *cogStructure, coords []float64, size int) (*cogImage, cogGeoTransform) {
+	last := len(coords) - 2
+	width := math.Abs(coords[last]-coords[0]) * float64(size) / float64(size-1)
+	height := math.Abs(coords[last+1]-coords[1]) * float64(size) / float64(size-1)
+	if size == 1 {
+		width, height = 0, 0
+	}
+	target := math.Min(width, height) / float64(size)
+
+	full := structure.images[0]
+	best := full
+	bestTransform := structure.transform
+
+	for _, level := range structure.images[1:] {
+		transform := structure.transform.forLevel(full, level)
+		// A bit of tolerance so rounding in the overview sizes doesn't skip an exact match
+		if transform.pixelSize() > target*1.01 {
+			break
+		}
+		best, bestTransform = level, transform
+	}
+
+	return best, bestTransform
+}
+
+// fetchTiles reads every tile of the level overlapping the given pixel range, in parallel
+func (t *COG) fetchTiles(ctx context.Context, level *cogImage, minCol, minRow, maxCol, maxRow float64) (map[uint64][]byte, error) {
+	// Bilinear sampling reaches half a pixel further in every direction
+	clampCol := func(v float64) uint64 { return uint64(math.Max(0, math.Min(v, float64(level.width-1)))) }
+	clampRow := func(v float64) uint64 { return uint64(math.Max(0, math.Min(v, float64(level.height-1)))) }
+
+	firstX, lastX := clampCol(minCol-1)/level.tileWidth, clampCol(maxCol+1)/level.tileWidth
+	firstY, lastY := clampRow(minRow-1)/level.tileHeight, clampRow(maxRow+1)/level.tileHeight
+
+	tiles := make(map[uint64][]byte)
+	var mu sync.Mutex
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(cogFetchConcurrency)
+
+	for ty := firstY; ty <= lastY; ty++ {
+		for tx := firstX; tx <= lastX; tx++ {
+			index := ty*level.tilesAcross + tx
+			group.Go(func() error {
+				data, err := level.decodeTile(groupCtx, t.reader, index)
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				tiles[index] = data
+				mu.Unlock()
+
+				return nil
+			})
+		}
+	}
+
+	return tiles, group.Wait()
+}
+
+// defaultCogRange is the range of sample values mapped onto 0-255 when no rescale is configured
+func defaultCogRange(level *cogImage) (float64, float64) {
+	if level.sampleFormat == tiffSampleFormatFloat {
+		return 0, 255
+	}
+
+	if level.sampleFormat == tiffSampleFormatInt {
+		half := math.Exp2(float64(level.bitsPerSample - 1))
+		return -half, half - 1
+	}
+
+	return 0, math.Exp2(float64(level.bitsPerSample)) - 1
+}
+
+type cogRenderer struct {
+	level   *cogImage
+	tiles   map[uint64][]byte
+	bands   []uint64
+	alpha   bool
+	noData  *float64
+	min     float64
+	max     float64
+	samples []float64
+}
+
+// read loads the selected bands of one pixel into r.samples, returning false if there's no data there
+func (r *cogRenderer) read(col int, row int) bool {
+	if col < 0 || row < 0 || uint64(col) >= r.level.width || uint64(row) >= r.level.height {
+		return false
+	}
+
+	x, y := uint64(col), uint64(row)
+	data := r.tiles[(y/r.level.tileHeight)*r.level.tilesAcross+x/r.level.tileWidth]
+	if data == nil {
+		return false
+	}
+
+	allNoData := true
+	colorBands := len(r.bands) - pkg.Ternary(r.alpha, 1, 0)
+
+	for i, band := range r.bands {
+		v := r.level.sample(data, x%r.level.tileWidth, y%r.level.tileHeight, band)
+		r.samples[i] = v
+
+		if i < colorBands && !r.isNoData(v) {
+			allNoData = false
+		}
+	}
+
+	return !allNoData
+}
+
+func (r *cogRenderer) isNoData(v float64) bool {
+	if math.IsNaN(v) {
+		return true
+	}
+
+	return r.noData != nil && (v == *r.noData || (math.IsNaN(*r.noData) && math.IsNaN(v)))
+}
+
+func (r *cogRenderer) scale(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, (v-r.min)/(r.max-r.min)*255))))
+}
+
+func (r *cogRenderer) toColor(samples []float64) color.NRGBA {
+	colorBands := len(r.bands) - pkg.Ternary(r.alpha, 1, 0)
+	c := color.NRGBA{A: 255}
+
+	if colorBands >= 3 {
+		c.R, c.G, c.B = r.scale(samples[0]), r.scale(samples[1]), r.scale(samples[2])
+	} else {
+		c.R = r.scale(samples[0])
+		c.G, c.B = c.R, c.R
+	}
+
+	if r.alpha {
+		c.A = r.scale(samples[len(samples)-1])
+	}
+
+	return c
+}
+
+func (r *cogRenderer) nearest(col float64, row float64) color.NRGBA {
+	if !r.read(int(math.Floor(col)), int(math.Floor(row))) {
+		return color.NRGBA{}
+	}
+
+	return r.toColor(r.samples)
+}
+
+// bilinear blends the four pixels around a point. Neighbors without data are left out of the blend
+// rather than dragging the edge of the data towards the nodata value
+func (r *cogRenderer) bilinear(col float64, row float64) color.NRGBA {
+	col -= 0.5
+	row -= 0.5
+	x0, y0 := math.Floor(col), math.Floor(row)
+	fx, fy := col-x0, row-y0
+
+	total := make([]float64, len(r.bands))
+	weightSum := 0.0
+
+	for _, n := range [4][3]float64{{0, 0, (1 - fx) * (1 - fy)}, {1, 0, fx * (1 - fy)}, {0, 1, (1 - fx) * fy}, {1, 1, fx * fy}} {
+		if n[2] == 0 || !r.read(int(x0+n[0]), int(y0+n[1])) {
+			continue
+		}
+
+		for i, v := range r.samples {
+			total[i] += v * n[2]
+		}
+		weightSum += n[2]
+	}
+
+	if weightSum == 0 {
+		return color.NRGBA{}
+	}
+
+	for i := range total {
+		total[i] /= weightSum
+	}
+
+	return r.toColor(total)
+}
@@ -0,0 +1,555 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTiffLevel struct {
+	size       int
+	tileSize   int
+	spp        int
+	bits       int
+	format     int
+	deflate    bool
+	predictor  int
+	pixelValue func(x, y, band int) float64
+}
+
+type testTiffEntry struct {
+	tag    uint16
+	typ    uint16
+	values []uint64
+	floats []float64
+	str    string
+}
+
+func (e testTiffEntry) count() int {
+	if e.str != "" {
+		return len(e.str) + 1
+	}
+	if e.floats != nil {
+		return len(e.floats)
+	}
+	return len(e.values)
+}
+
+func (e testTiffEntry) encode() []byte {
+	var buf bytes.Buffer
+	switch {
+	case e.str != "":
+		buf.WriteString(e.str)
+		buf.WriteByte(0)
+	case e.floats != nil:
+		for _, f := range e.floats {
+			_ = binary.Write(&buf, binary.LittleEndian, f)
+		}
+	case e.typ == 3:
+		for _, v := range e.values {
+			_ = binary.Write(&buf, binary.LittleEndian, uint16(v))
+		}
+	default:
+		for _, v := range e.values {
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(v))
+		}
+	}
+	return buf.Bytes()
+}
+
+func (l testTiffLevel) encodeTile(tx, ty int) []byte {
+	bytesPerSample := l.bits / 8
+	raw := make([]byte, l.tileSize*l.tileSize*l.spp*bytesPerSample)
+
+	for y := range l.tileSize {
+		for x := range l.tileSize {
+			for b := range l.spp {
+				v := l.pixelValue(tx*l.tileSize+x, ty*l.tileSize+y, b)
+				i := ((y*l.tileSize+x)*l.spp + b) * bytesPerSample
+				switch {
+				case l.format == tiffSampleFormatFloat:
+					binary.LittleEndian.PutUint32(raw[i:], math.Float32bits(float32(v)))
+				case l.bits == 8:
+					raw[i] = uint8(v)
+				case l.bits == 16:
+					binary.LittleEndian.PutUint16(raw[i:], uint16(int64(v)))
+				}
+			}
+		}
+	}
+
+	if l.predictor == tiffPredictorHorizontal {
+		rowLength := l.tileSize * l.spp
+		for y := range l.tileSize {
+			for i := rowLength - 1; i >= l.spp; i-- {
+				cur, prev := y*rowLength+i, y*rowLength+i-l.spp
+				switch l.bits {
+				case 8:
+					raw[cur] -= raw[prev]
+				case 16:
+					binary.LittleEndian.PutUint16(raw[cur*2:], binary.LittleEndian.Uint16(raw[cur*2:])-binary.LittleEndian.Uint16(raw[prev*2:]))
+				}
+			}
+		}
+	}
+
+	if !l.deflate {
+		return raw
+	}
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(raw)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// makeCog writes a little endian tiled GeoTIFF with the given resolution levels, the first being full
+// resolution. The raster covers extent (west, south, east, north) in the CRS identified by geoKeys
+func makeCog(t *testing.T, levels []testTiffLevel, extent [4]float64, geoKeys []uint64, extra []testTiffEntry) []byte {
+	t.Helper()
+
+	var tileData [][][]byte
+	ifds := make([][]testTiffEntry, len(levels))
+
+	for i, l := range levels {
+		across := (l.size + l.tileSize - 1) / l.tileSize
+		var tiles [][]byte
+		for ty := range across {
+			for tx := range across {
+				tiles = append(tiles, l.encodeTile(tx, ty))
+			}
+		}
+		tileData = append(tileData, tiles)
+
+		format := l.format
+		if format == 0 {
+			format = tiffSampleFormatUint
+		}
+		predictor := l.predictor
+		if predictor == 0 {
+			predictor = tiffPredictorNone
+		}
+
+		bits := make([]uint64, l.spp)
+		formats := make([]uint64, l.spp)
+		for b := range l.spp {
+			bits[b] = uint64(l.bits)
+			formats[b] = uint64(format)
+		}
+
+		entries := []testTiffEntry{
+			{tag: tiffTagNewSubfileType, typ: 4, values: []uint64{uint64(min(i, 1))}},
+			{tag: tiffTagImageWidth, typ: 4, values: []uint64{uint64(l.size)}},
+			{tag: tiffTagImageLength, typ: 4, values: []uint64{uint64(l.size)}},
+			{tag: tiffTagBitsPerSample, typ: 3, values: bits},
+			{tag: tiffTagCompression, typ: 3, values: []uint64{uint64(pkg.Ternary(l.deflate, tiffCompressionDeflate, tiffCompressionNone))}},
+			{tag: tiffTagSamplesPerPixel, typ: 3, values: []uint64{uint64(l.spp)}},
+			{tag: tiffTagPredictor, typ: 3, values: []uint64{uint64(predictor)}},
+			{tag: tiffTagTileWidth, typ: 3, values: []uint64{uint64(l.tileSize)}},
+			{tag: tiffTagTileLength, typ: 3, values: []uint64{uint64(l.tileSize)}},
+			{tag: tiffTagTileOffsets, typ: 4, values: make([]uint64, len(tiles))},
+			{tag: tiffTagTileByteCounts, typ: 4, values: make([]uint64, len(tiles))},
+			{tag: tiffTagSampleFormat, typ: 3, values: formats},
+		}
+
+		if i == 0 {
+			scale := (extent[2] - extent[0]) / float64(l.size)
+			entries = append(entries,
+				testTiffEntry{tag: tiffTagModelPixelScale, typ: 12, floats: []float64{scale, (extent[3] - extent[1]) / float64(l.size), 0}},
+				testTiffEntry{tag: tiffTagModelTiepoint, typ: 12, floats: []float64{0, 0, 0, extent[0], extent[3], 0}},
+				testTiffEntry{tag: tiffTagGeoKeyDirectory, typ: 3, values: geoKeys},
+			)
+			entries = append(entries, extra...)
+		}
+
+		slices.SortFunc(entries, func(a, b testTiffEntry) int { return int(a.tag) - int(b.tag) })
+		ifds[i] = entries
+	}
+
+	// Lay out the IFDs and their out of line values first, then all the tile data
+	ifdSize := func(entries []testTiffEntry) int {
+		size := 2 + 12*len(entries) + 4
+		for _, e := range entries {
+			if n := len(e.encode()); n > 4 {
+				size += n + n%2
+			}
+		}
+		return size
+	}
+
+	offset := 8
+	ifdOffsets := make([]int, len(ifds))
+	for i, entries := range ifds {
+		ifdOffsets[i] = offset
+		offset += ifdSize(entries)
+	}
+
+	for i, entries := range ifds {
+		for j, e := range entries {
+			switch e.tag {
+			case tiffTagTileOffsets:
+				for k, tile := range tileData[i] {
+					entries[j].values[k] = uint64(offset)
+					offset += len(tile)
+				}
+			case tiffTagTileByteCounts:
+				for k, tile := range tileData[i] {
+					entries[j].values[k] = uint64(len(tile))
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("II")
+	_ = binary.Write(&out, binary.LittleEndian, uint16(42))
+	_ = binary.Write(&out, binary.LittleEndian, uint32(8))
+
+	for i, entries := range ifds {
+		external := ifdOffsets[i] + 2 + 12*len(entries) + 4
+		var values bytes.Buffer
+
+		_ = binary.Write(&out, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			data := e.encode()
+			_ = binary.Write(&out, binary.LittleEndian, e.tag)
+			_ = binary.Write(&out, binary.LittleEndian, e.typ)
+			_ = binary.Write(&out, binary.LittleEndian, uint32(e.count()))
+			if len(data) <= 4 {
+				out.Write(append(data, make([]byte, 4-len(data))...))
+			} else {
+				_ = binary.Write(&out, binary.LittleEndian, uint32(external+values.Len()))
+				values.Write(data)
+				if len(data)%2 == 1 {
+					values.WriteByte(0)
+				}
+			}
+		}
+
+		next := uint32(0)
+		if i+1 < len(ifds) {
+			next = uint32(ifdOffsets[i+1])
+		}
+		_ = binary.Write(&out, binary.LittleEndian, next)
+		out.Write(values.Bytes())
+	}
+
+	for _, tiles := range tileData {
+		for _, tile := range tiles {
+			out.Write(tile)
+		}
+	}
+
+	return out.Bytes()
+}
+
+var testGeoKeys3857 = []uint64{1, 1, 0, 2, geoKeyModelType, 0, 1, 1, geoKeyProjectedCRS, 0, 1, 3857}
+var testGeoKeys4326 = []uint64{1, 1, 0, 2, geoKeyModelType, 0, 1, 2, geoKeyGeographicCRS, 0, 1, 4326}
+var testWorld3857 = [4]float64{-max3857Coord, -max3857Coord, max3857Coord, max3857Coord}
+
+const max3857Coord = 20037508.342789
+
+func writeCog(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.tif")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func renderCog(t *testing.T, cfg COGConfig, tileRequest pkg.TileRequest) (image.Image, *pkg.Image, error) {
+	t.Helper()
+
+	p, err := COGRegistration{}.Initialize(cfg, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer p.(*COG).Close(context.Background())
+
+	img, err := p.GenerateTile(context.Background(), layer.ProviderContext{}, tileRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	return decoded, img, nil
+}
+
+func Test_COG_Validate(t *testing.T) {
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+	path := writeCog(t, []byte("placeholder"))
+
+	for _, cfg := range []COGConfig{
+		{},
+		{File: path, URL: "http://example.com/test.tif"},
+		{File: path, Resampling: "cubic"},
+		{File: path, Format: "gif"},
+		{File: path, Quality: 101},
+		{File: path, Srid: 2263},
+		{File: path, Bands: []uint{0}},
+		{File: path, Bands: []uint{1, 2, 3, 4, 5}},
+		{File: path, Rescale: []float64{1}},
+	} {
+		p, err := COGRegistration{}.Initialize(cfg, deps)
+		assert.Nil(t, p)
+		require.Error(t, err)
+	}
+}
+
+func Test_COG_SelectsOverviewForZoom(t *testing.T) {
+	constant := func(v float64) func(x, y, band int) float64 {
+		return func(_, _, _ int) float64 { return v }
+	}
+
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 512, tileSize: 256, spp: 1, bits: 8, pixelValue: constant(100)},
+		{size: 256, tileSize: 256, spp: 1, bits: 8, pixelValue: constant(200)},
+	}, testWorld3857, testGeoKeys3857, nil))
+
+	img, out, err := renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, out.ContentType)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+	assert.Equal(t, color.NRGBAModel.Convert(color.Gray{200}), color.NRGBAModel.Convert(img.At(100, 100)))
+
+	img, _, err = renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBAModel.Convert(color.Gray{100}), color.NRGBAModel.Convert(img.At(100, 100)))
+}
+
+func Test_COG_DeflatePredictorRGB(t *testing.T) {
+	// Each quadrant of the world gets a distinct color
+	quadrant := func(x, y, band int) float64 {
+		q := (x/128)*2 + y/128
+		return float64([4][3]int{{255, 0, 0}, {0, 255, 0}, {0, 0, 255}, {255, 255, 0}}[q][band])
+	}
+
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 256, tileSize: 64, spp: 3, bits: 8, deflate: true, predictor: tiffPredictorHorizontal, pixelValue: quadrant},
+	}, testWorld3857, testGeoKeys3857, nil))
+
+	img, _, err := renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	assert.Equal(t, color.NRGBA{255, 0, 0, 255}, color.NRGBAModel.Convert(img.At(10, 10)))
+	assert.Equal(t, color.NRGBA{0, 255, 0, 255}, color.NRGBAModel.Convert(img.At(10, 200)))
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, color.NRGBAModel.Convert(img.At(200, 10)))
+	assert.Equal(t, color.NRGBA{255, 255, 0, 255}, color.NRGBAModel.Convert(img.At(200, 200)))
+
+	img, _, err = renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 3, X: 6, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, color.NRGBAModel.Convert(img.At(128, 128)))
+}
+
+func Test_COG_NoDataAndRescale(t *testing.T) {
+	// Elevation-like data where the western half is missing
+	elevation := func(x, _, _ int) float64 {
+		if x < 128 {
+			return 0
+		}
+		return 1000
+	}
+
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 256, tileSize: 256, spp: 1, bits: 16, deflate: true, predictor: tiffPredictorHorizontal, pixelValue: elevation},
+	}, testWorld3857, testGeoKeys3857, []testTiffEntry{{tag: tiffTagGDALNoData, typ: 2, str: "0"}}))
+
+	img, _, err := renderCog(t, COGConfig{File: path, Rescale: []float64{0, 2000}}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	_, _, _, a := img.At(10, 10).RGBA()
+	assert.Equal(t, uint32(0), a)
+	assert.Equal(t, color.NRGBA{128, 128, 128, 255}, color.NRGBAModel.Convert(img.At(200, 10)))
+
+	// Overriding the nodata value makes the western half visible again
+	noData := -1.0
+	img, _, err = renderCog(t, COGConfig{File: path, Rescale: []float64{0, 2000}, NoData: &noData}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0, 0, 0, 255}, color.NRGBAModel.Convert(img.At(10, 10)))
+}
+
+func Test_COG_Reprojects4326(t *testing.T) {
+	// Rows alternate every 10 degrees of latitude so the reprojection is visible
+	banded := func(_, y, _ int) float64 {
+		return float64((y / 10 % 2) * 255)
+	}
+
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 180, tileSize: 64, spp: 1, bits: 8, pixelValue: banded},
+	}, [4]float64{-90, -90, 90, 90}, testGeoKeys4326, nil))
+
+	img, _, err := renderCog(t, COGConfig{File: path, Format: "jpg"}, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 0})
+	require.NoError(t, err)
+
+	// The 0-10 degree band is black and 10-20 is white. In mercator 5 degrees north is most of the
+	// way down the tile
+	bounds, err := pkg.TileRequest{Z: 1, X: 1, Y: 0}.GetBoundsProjection(pkg.SRIDPsuedoMercator)
+	require.NoError(t, err)
+	pixelFor := func(lat float64) int {
+		y := math.Log(math.Tan((90+lat)*math.Pi/360)) * webMercatorRadius
+		return int((bounds.North - y) / (bounds.North - bounds.South) * 256)
+	}
+
+	r, _, _, _ := img.At(10, pixelFor(5)).RGBA()
+	assert.Less(t, r, uint32(0x2000))
+	r, _, _, _ = img.At(10, pixelFor(15)).RGBA()
+	assert.Greater(t, r, uint32(0xe000))
+
+	// West of the raster
+	_, _, err = renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 2, X: 0, Y: 1})
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+}
+
+func Test_COG_BilinearBlends(t *testing.T) {
+	stripes := func(x, _, _ int) float64 {
+		return float64((x % 2) * 200)
+	}
+
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 4, tileSize: 16, spp: 1, bits: 8, pixelValue: stripes},
+	}, testWorld3857, testGeoKeys3857, nil))
+
+	img, _, err := renderCog(t, COGConfig{File: path, Resampling: "bilinear"}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	// Right at the boundary between the first two source pixels, which nearest neighbor would render
+	// as either 0 or 200
+	c := color.NRGBAModel.Convert(img.At(64, 100)).(color.NRGBA)
+	assert.InDelta(t, 100, c.R, 3)
+	assert.Equal(t, uint8(255), c.A)
+}
+
+func Test_COG_ExecuteHTTP(t *testing.T) {
+	data := makeCog(t, []testTiffLevel{
+		{size: 256, tileSize: 128, spp: 1, bits: 32, format: tiffSampleFormatFloat, pixelValue: func(_, _, _ int) float64 { return 0.5 }},
+	}, testWorld3857, testGeoKeys3857, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "test.tif", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	p, err := COGRegistration{}.Initialize(COGConfig{URL: server.URL, Rescale: []float64{0, 1}}, layer.ProviderDeps{
+		ErrorMessages: testErrMessages,
+		ClientConfig:  config.ClientConfig{MaxLength: 1024 * 1024, Timeout: 5},
+	})
+	require.NoError(t, err)
+
+	out, err := p.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	img, _, err := image.Decode(bytes.NewReader(out.Content))
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{128, 128, 128, 255}, color.NRGBAModel.Convert(img.At(5, 5)))
+}
+
+func Test_COG_UnknownProjection(t *testing.T) {
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 16, tileSize: 16, spp: 1, bits: 8, pixelValue: func(_, _, _ int) float64 { return 1 }},
+	}, testWorld3857, []uint64{1, 1, 0, 1, geoKeyProjectedCRS, 0, 1, 32618}, nil))
+
+	_, _, err := renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "unsupported"))
+
+	_, _, err = renderCog(t, COGConfig{File: path, Srid: pkg.SRIDPsuedoMercator}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+}
+
+func Test_COG_ShortFinalStrip(t *testing.T) {
+	// 4x5 pixels in strips of 2 rows, so the last strip only has 1 row
+	data := []byte{1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5}
+	f, err := os.Open(writeCog(t, data))
+	require.NoError(t, err)
+	src := fileRangeReader{f}
+	defer src.Close()
+
+	img := cogImage{
+		width: 4, height: 5, tileWidth: 4, tileHeight: 2, tilesAcross: 1, striped: true,
+		offsets: []uint64{0, 8, 16}, byteCounts: []uint64{8, 8, 4},
+		bitsPerSample: 8, samplesPerPixel: 1, compression: tiffCompressionNone, predictor: tiffPredictorNone, order: binary.LittleEndian,
+	}
+
+	strip, err := img.decodeTile(context.Background(), src, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{5, 5, 5, 5, 0, 0, 0, 0}, strip)
+
+	// Tiles are always full size
+	img.striped = false
+	_, err = img.decodeTile(context.Background(), src, 2)
+	require.Error(t, err)
+}
+
+func Test_COG_EmptyTags(t *testing.T) {
+	r := &tiffReader{order: binary.LittleEndian}
+	short := func(v uint16) tiffField {
+		return tiffField{typ: 3, count: 1, data: binary.LittleEndian.AppendUint16(nil, v)}
+	}
+
+	_, err := r.parseImage(map[uint16]tiffField{
+		tiffTagImageWidth:    short(256),
+		tiffTagImageLength:   short(256),
+		tiffTagBitsPerSample: {typ: 3, count: 0},
+	})
+	require.Error(t, err)
+}
+
+func Test_COG_TooManyExtraSamples(t *testing.T) {
+	path := writeCog(t, makeCog(t, []testTiffLevel{
+		{size: 16, tileSize: 16, spp: 1, bits: 8, pixelValue: func(_, _, _ int) float64 { return 1 }},
+	}, testWorld3857, testGeoKeys3857, []testTiffEntry{{tag: tiffTagExtraSamples, typ: 3, values: []uint64{tiffExtraSampleUnassociatedAlpha, 0}}}))
+
+	_, _, err := renderCog(t, COGConfig{File: path}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "extra samples"))
+}
+
+func Test_COG_ReadPastPrefix(t *testing.T) {
+	f, err := os.Open(writeCog(t, make([]byte, 64)))
+	require.NoError(t, err)
+	src := fileRangeReader{f}
+	defer src.Close()
+
+	r := &tiffReader{src: src, prefix: make([]byte, 16), order: binary.LittleEndian}
+
+	data, err := r.read(context.Background(), 8, 8)
+	require.NoError(t, err)
+	assert.Len(t, data, 8)
+
+	// An offset this close to the top of the range would wrap around to inside the prefix if added
+	_, err = r.read(context.Background(), math.MaxUint64-3, 8)
+	require.Error(t, err)
+}
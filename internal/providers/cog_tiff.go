@@ -0,0 +1,777 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Michad/tilegroxy/pkg"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// A COG keeps every IFD and tile index at the start of the file, so reading this much up front
+// normally avoids a separate request per tag
+const tiffPrefixLength = 16384
+
+// Refuse to load tag values larger than this, a corrupt count shouldn't be able to exhaust memory
+const tiffMaxFieldLength = 64 * 1024 * 1024
+
+const tiffMaxImages = 64
+
+// TIFF and GeoTIFF tags needed to locate and decode tiles
+const (
+	tiffTagNewSubfileType  = 254
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagTileByteCounts  = 325
+	tiffTagExtraSamples    = 338
+	tiffTagSampleFormat    = 339
+	tiffTagJPEGTables      = 347
+	tiffTagModelPixelScale = 33550
+	tiffTagModelTiepoint   = 33922
+	tiffTagModelTransform  = 34264
+	tiffTagGeoKeyDirectory = 34735
+	tiffTagGDALNoData      = 42113
+)
+
+var tiffWantedTags = map[uint16]bool{
+	tiffTagNewSubfileType: true, tiffTagImageWidth: true, tiffTagImageLength: true, tiffTagBitsPerSample: true,
+	tiffTagCompression: true, tiffTagPhotometric: true, tiffTagStripOffsets: true, tiffTagSamplesPerPixel: true,
+	tiffTagRowsPerStrip: true, tiffTagStripByteCounts: true, tiffTagPlanarConfig: true, tiffTagPredictor: true,
+	tiffTagTileWidth: true, tiffTagTileLength: true, tiffTagTileOffsets: true, tiffTagTileByteCounts: true,
+	tiffTagExtraSamples: true, tiffTagSampleFormat: true, tiffTagJPEGTables: true, tiffTagModelPixelScale: true,
+	tiffTagModelTiepoint: true, tiffTagModelTransform: true, tiffTagGeoKeyDirectory: true, tiffTagGDALNoData: true,
+}
+
+// Size in bytes of each TIFF field type
+var tiffTypeSizes = map[uint16]uint64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8, 17: 8, 18: 8,
+}
+
+const (
+	tiffCompressionNone    = 1
+	tiffCompressionLZW     = 5
+	tiffCompressionJPEG    = 7
+	tiffCompressionDeflate = 8
+	// The value used for deflate before it was standardized, still written by some tools
+	tiffCompressionDeflateOld = 32946
+)
+
+const (
+	tiffSampleFormatUint  = 1
+	tiffSampleFormatInt   = 2
+	tiffSampleFormatFloat = 3
+)
+
+const (
+	tiffPredictorNone       = 1
+	tiffPredictorHorizontal = 2
+	tiffPredictorFloat      = 3
+)
+
+const (
+	geoKeyModelType     = 1024
+	geoKeyRasterType    = 1025
+	geoKeyGeographicCRS = 2048
+	geoKeyProjectedCRS  = 3072
+)
+
+const (
+	geoModelTypeGeographic = 2
+	geoRasterPixelIsPoint  = 2
+)
+
+// EPSG codes, official and otherwise, that all mean spherical web mercator
+var webMercatorCodes = []uint64{pkg.SRIDPsuedoMercator, 900913, 3785, 102100, 102113}
+
+type tiffField struct {
+	typ   uint16
+	count uint64
+	data  []byte
+}
+
+// tiffReader reads the structure of a TIFF or BigTIFF out of a rangeReader
+type tiffReader struct {
+	src    rangeReader
+	order  binary.ByteOrder
+	big    bool
+	prefix []byte
+}
+
+// cogImage is one resolution level of a COG: the full resolution image or one of its overviews
+type cogImage struct {
+	width           uint64
+	height          uint64
+	tileWidth       uint64
+	tileHeight      uint64
+	tilesAcross     uint64
+	offsets         []uint64
+	byteCounts      []uint64
+	bitsPerSample   uint64
+	samplesPerPixel uint64
+	sampleFormat    uint64
+	compression     uint64
+	predictor       uint64
+	jpegTables      []byte
+	order           binary.ByteOrder
+	// Strips are stored as tiles the width of the image, but unlike tiles the last is cut short
+	// rather than padded out when the height isn't a multiple of the rows per strip
+	striped bool
+}
+
+// cogGeoTransform maps pixel coordinates in the full resolution image to the raster's CRS:
+// x = originX + a*col + b*row, y = originY + d*col + e*row
+type cogGeoTransform struct {
+	originX float64
+	originY float64
+	a       float64
+	b       float64
+	d       float64
+	e       float64
+}
+
+// cogStructure is everything read from the file's IFDs
+type cogStructure struct {
+	images       []*cogImage
+	transform    cogGeoTransform
+	srid         uint
+	noData       *float64
+	extraSamples []uint64
+}
+
+func openTiff(ctx context.Context, src rangeReader) (*tiffReader, uint64, error) {
+	prefix, err := src.ReadRange(ctx, 0, tiffPrefixLength)
+	if err != nil && len(prefix) < 16 {
+		// A file shorter than the prefix can make a range request fail outright, fall back to just the header
+		prefix, err = src.ReadRange(ctx, 0, 16)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if len(prefix) < 8 {
+		return nil, 0, errors.New("file too short to be a tiff")
+	}
+
+	r := tiffReader{src: src, prefix: prefix}
+
+	switch string(prefix[0:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("not a tiff file")
+	}
+
+	switch r.order.Uint16(prefix[2:4]) {
+	case 42:
+		return &r, uint64(r.order.Uint32(prefix[4:8])), nil
+	case 43:
+		if len(prefix) < 16 {
+			return nil, 0, errors.New("file too short to be a bigtiff")
+		}
+		r.big = true
+		return &r, r.order.Uint64(prefix[8:16]), nil
+	}
+
+	return nil, 0, errors.New("not a tiff file")
+}
+
+func (r *tiffReader) read(ctx context.Context, offset uint64, length uint64) ([]byte, error) {
+	// Checked without adding so offsets from the file near the top of the range can't wrap around
+	if length <= uint64(len(r.prefix)) && offset <= uint64(len(r.prefix))-length {
+		return r.prefix[offset : offset+length], nil
+	}
+
+	data, err := r.src.ReadRange(ctx, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(data)) != length {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+// readIFD reads the fields this provider cares about from the IFD at offset and returns the offset
+// of the next IFD
+func (r *tiffReader) readIFD(ctx context.Context, offset uint64) (map[uint16]tiffField, uint64, error) {
+	countSize, entrySize, valueSize := uint64(2), uint64(12), uint64(4)
+	if r.big {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
+	countBytes, err := r.read(ctx, offset, countSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := r.uint(countBytes)
+	if count > 4096 {
+		return nil, 0, fmt.Errorf("tiff directory at %v has too many entries", offset)
+	}
+
+	entries, err := r.read(ctx, offset+countSize, count*entrySize+valueSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fields := make(map[uint16]tiffField)
+
+	for i := range count {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		tag := r.order.Uint16(entry[0:2])
+		typ := r.order.Uint16(entry[2:4])
+		size, ok := tiffTypeSizes[typ]
+
+		if !ok || !tiffWantedTags[tag] {
+			continue
+		}
+
+		valueCount := r.uint(entry[4 : 4+valueSize])
+		value := entry[4+valueSize:]
+
+		if valueCount > tiffMaxFieldLength/size {
+			return nil, 0, fmt.Errorf("tiff tag %v is too large", tag)
+		}
+
+		length := valueCount * size
+		data := value[:min(length, valueSize)]
+
+		if length > valueSize {
+			data, err = r.read(ctx, r.uint(value), length)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		fields[tag] = tiffField{typ, valueCount, data}
+	}
+
+	return fields, r.uint(entries[count*entrySize:]), nil
+}
+
+// uint reads an unsigned integer sized to fit b
+func (r *tiffReader) uint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(r.order.Uint16(b))
+	case 4:
+		return uint64(r.order.Uint32(b))
+	}
+
+	return r.order.Uint64(b)
+}
+
+func (r *tiffReader) uints(f tiffField) []uint64 {
+	size := tiffTypeSizes[f.typ]
+	result := make([]uint64, 0, f.count)
+
+	for i := range f.count {
+		result = append(result, r.uint(f.data[i*size:(i+1)*size]))
+	}
+
+	return result
+}
+
+func (r *tiffReader) floats(f tiffField) []float64 {
+	if f.typ != 12 {
+		result := make([]float64, 0, f.count)
+		for _, v := range r.uints(f) {
+			result = append(result, float64(v))
+		}
+		return result
+	}
+
+	result := make([]float64, 0, f.count)
+	for i := range f.count {
+		result = append(result, math.Float64frombits(r.order.Uint64(f.data[i*8:(i+1)*8])))
+	}
+
+	return result
+}
+
+// readCogStructure walks every IFD in the file and pulls out the resolution levels and georeferencing
+func readCogStructure(ctx context.Context, src rangeReader) (*cogStructure, error) {
+	r, offset, err := openTiff(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	result := cogStructure{}
+	var first map[uint16]tiffField
+
+	for offset != 0 && len(result.images) < tiffMaxImages {
+		var fields map[uint16]tiffField
+		fields, offset, err = r.readIFD(ctx, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		// Masks are stored as extra images alongside the overviews but aren't a resolution level
+		if r.firstUint(fields, tiffTagNewSubfileType, 0)&4 != 0 {
+			continue
+		}
+
+		img, err := r.parseImage(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			first = fields
+		} else if img.width > result.images[len(result.images)-1].width {
+			// Overviews have to get smaller or the level selection breaks down
+			continue
+		}
+
+		result.images = append(result.images, img)
+	}
+
+	if first == nil {
+		return nil, errors.New("tiff contains no images")
+	}
+
+	result.transform, err = r.parseGeoTransform(first)
+	if err != nil {
+		return nil, err
+	}
+
+	result.srid = r.parseSrid(first)
+
+	if noData, ok := first[tiffTagGDALNoData]; ok {
+		str := strings.TrimSpace(strings.TrimRight(string(noData.data), "\x00"))
+		val, err := strconv.ParseFloat(str, 64)
+		if err == nil {
+			result.noData = &val
+		}
+	}
+
+	if extra, ok := first[tiffTagExtraSamples]; ok {
+		result.extraSamples = r.uints(extra)
+		if uint64(len(result.extraSamples)) > result.images[0].samplesPerPixel {
+			return nil, fmt.Errorf("tiff has %v extra samples but only %v samples per pixel", len(result.extraSamples), result.images[0].samplesPerPixel)
+		}
+	}
+
+	return &result, nil
+}
+
+func (r *tiffReader) firstUint(fields map[uint16]tiffField, tag uint16, def uint64) uint64 {
+	f, ok := fields[tag]
+	if !ok || f.count == 0 {
+		return def
+	}
+
+	return r.uints(f)[0]
+}
+
+func (r *tiffReader) parseImage(fields map[uint16]tiffField) (*cogImage, error) {
+	img := cogImage{
+		width:           r.firstUint(fields, tiffTagImageWidth, 0),
+		height:          r.firstUint(fields, tiffTagImageLength, 0),
+		samplesPerPixel: r.firstUint(fields, tiffTagSamplesPerPixel, 1),
+		sampleFormat:    r.firstUint(fields, tiffTagSampleFormat, tiffSampleFormatUint),
+		compression:     r.firstUint(fields, tiffTagCompression, tiffCompressionNone),
+		predictor:       r.firstUint(fields, tiffTagPredictor, tiffPredictorNone),
+		order:           r.order,
+	}
+
+	if img.width == 0 || img.height == 0 {
+		return nil, errors.New("tiff image has no size")
+	}
+
+	if r.firstUint(fields, tiffTagPlanarConfig, 1) != 1 {
+		return nil, errors.New("tiffs with separate planes per band are not supported")
+	}
+
+	if bits, ok := fields[tiffTagBitsPerSample]; ok {
+		all := r.uints(bits)
+		if len(all) == 0 {
+			return nil, errors.New("tiff image has no bits per sample")
+		}
+		for _, b := range all {
+			if b != all[0] {
+				return nil, errors.New("tiffs with a different bit depth per band are not supported")
+			}
+		}
+		img.bitsPerSample = all[0]
+	} else {
+		img.bitsPerSample = 1
+	}
+
+	switch {
+	case img.sampleFormat == tiffSampleFormatFloat && (img.bitsPerSample == 32 || img.bitsPerSample == 64):
+	case (img.sampleFormat == tiffSampleFormatUint || img.sampleFormat == tiffSampleFormatInt) && (img.bitsPerSample == 8 || img.bitsPerSample == 16 || img.bitsPerSample == 32):
+	default:
+		return nil, fmt.Errorf("unsupported tiff sample format %v with %v bits per sample", img.sampleFormat, img.bitsPerSample)
+	}
+
+	switch img.compression {
+	case tiffCompressionNone, tiffCompressionLZW, tiffCompressionDeflate, tiffCompressionDeflateOld:
+	case tiffCompressionJPEG:
+		if img.bitsPerSample != 8 || (img.samplesPerPixel != 1 && img.samplesPerPixel != 3) {
+			return nil, errors.New("jpeg compressed tiffs must be 8 bit grayscale or rgb")
+		}
+		if tables, ok := fields[tiffTagJPEGTables]; ok {
+			img.jpegTables = tables.data
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tiff compression %v", img.compression)
+	}
+
+	if img.predictor != tiffPredictorNone && img.predictor != tiffPredictorHorizontal && img.predictor != tiffPredictorFloat {
+		return nil, fmt.Errorf("unsupported tiff predictor %v", img.predictor)
+	}
+
+	offsets, hasTiles := fields[tiffTagTileOffsets]
+	counts := fields[tiffTagTileByteCounts]
+
+	if hasTiles {
+		img.tileWidth = r.firstUint(fields, tiffTagTileWidth, 0)
+		img.tileHeight = r.firstUint(fields, tiffTagTileLength, 0)
+	} else {
+		// A striped tiff is the same as a tiled one with tiles the full width of the image
+		offsets = fields[tiffTagStripOffsets]
+		counts = fields[tiffTagStripByteCounts]
+		img.tileWidth = img.width
+		img.striped = true
+		img.tileHeight = min(r.firstUint(fields, tiffTagRowsPerStrip, img.height), img.height)
+	}
+
+	if img.tileWidth == 0 || img.tileHeight == 0 {
+		return nil, errors.New("tiff image has no tile size")
+	}
+
+	img.tilesAcross = (img.width + img.tileWidth - 1) / img.tileWidth
+	tilesDown := (img.height + img.tileHeight - 1) / img.tileHeight
+
+	img.offsets = r.uints(offsets)
+	img.byteCounts = r.uints(counts)
+
+	if uint64(len(img.offsets)) != img.tilesAcross*tilesDown || len(img.byteCounts) != len(img.offsets) {
+		return nil, errors.New("tiff tile index doesn't match the image size")
+	}
+
+	return &img, nil
+}
+
+func (r *tiffReader) parseGeoTransform(fields map[uint16]tiffField) (cogGeoTransform, error) {
+	var t cogGeoTransform
+
+	if matrix, ok := fields[tiffTagModelTransform]; ok && matrix.count >= 8 {
+		m := r.floats(matrix)
+		t = cogGeoTransform{originX: m[3], originY: m[7], a: m[0], b: m[1], d: m[4], e: m[5]}
+	} else {
+		tiepoint, okTie := fields[tiffTagModelTiepoint]
+		scale, okScale := fields[tiffTagModelPixelScale]
+
+		if !okTie || !okScale || tiepoint.count < 6 || scale.count < 2 {
+			return t, errors.New("tiff is missing georeferencing")
+		}
+
+		tp := r.floats(tiepoint)
+		s := r.floats(scale)
+		t = cogGeoTransform{originX: tp[3] - tp[0]*s[0], originY: tp[4] + tp[1]*s[1], a: s[0], e: -s[1]}
+	}
+
+	if t.a*t.e-t.b*t.d == 0 {
+		return t, errors.New("tiff georeferencing is degenerate")
+	}
+
+	// Shift point referenced rasters so the origin is the corner of the first pixel rather than its center
+	if r.geoKey(fields, geoKeyRasterType) == geoRasterPixelIsPoint {
+		t.originX -= (t.a + t.b) / 2
+		t.originY -= (t.d + t.e) / 2
+	}
+
+	return t, nil
+}
+
+// parseSrid works out which of the supported projections the raster is in, returning 0 when it's
+// something else
+func (r *tiffReader) parseSrid(fields map[uint16]tiffField) uint {
+	projected := r.geoKey(fields, geoKeyProjectedCRS)
+	for _, code := range webMercatorCodes {
+		if projected == code {
+			return pkg.SRIDPsuedoMercator
+		}
+	}
+
+	if r.geoKey(fields, geoKeyModelType) == geoModelTypeGeographic && r.geoKey(fields, geoKeyGeographicCRS) == pkg.SRIDWGS84 {
+		return pkg.SRIDWGS84
+	}
+
+	return 0
+}
+
+// geoKey returns a short valued key from the GeoKeyDirectory or 0 if it isn't present
+func (r *tiffReader) geoKey(fields map[uint16]tiffField, key uint64) uint64 {
+	dir, ok := fields[tiffTagGeoKeyDirectory]
+	if !ok {
+		return 0
+	}
+
+	values := r.uints(dir)
+	for i := 4; i+3 < len(values); i += 4 {
+		if values[i] == key && values[i+1] == 0 {
+			return values[i+3]
+		}
+	}
+
+	return 0
+}
+
+// forLevel scales the transform of the full resolution image to apply to an overview
+func (t cogGeoTransform) forLevel(full *cogImage, level *cogImage) cogGeoTransform {
+	sx := float64(full.width) / float64(level.width)
+	sy := float64(full.height) / float64(level.height)
+
+	return cogGeoTransform{originX: t.originX, originY: t.originY, a: t.a * sx, b: t.b * sy, d: t.d * sx, e: t.e * sy}
+}
+
+// toPixel maps a coordinate in the raster's CRS to fractional pixel coordinates
+func (t cogGeoTransform) toPixel(x float64, y float64) (float64, float64) {
+	det := t.a*t.e - t.b*t.d
+	dx := x - t.originX
+	dy := y - t.originY
+
+	return (t.e*dx - t.b*dy) / det, (-t.d*dx + t.a*dy) / det
+}
+
+// pixelSize is the ground distance covered by one pixel, in CRS units
+func (t cogGeoTransform) pixelSize() float64 {
+	return math.Min(math.Hypot(t.a, t.d), math.Hypot(t.b, t.e))
+}
+
+// decodeTile fetches and decompresses one tile, returning its samples in pixel interleaved order.
+// Returns nil for a sparse tile that was never written
+func (img *cogImage) decodeTile(ctx context.Context, src rangeReader, index uint64) ([]byte, error) {
+	if img.byteCounts[index] == 0 {
+		return nil, nil
+	}
+
+	raw, err := src.ReadRange(ctx, img.offsets[index], img.byteCounts[index])
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerSample := img.bitsPerSample / 8
+	rowLength := img.tileWidth * img.samplesPerPixel * bytesPerSample
+	expected := rowLength * img.tileHeight
+
+	rows := img.tileHeight
+	if img.striped {
+		rows = min(rows, img.height-index*img.tileHeight)
+	}
+
+	var data []byte
+
+	switch img.compression {
+	case tiffCompressionNone:
+		data = raw
+	case tiffCompressionLZW:
+		data, err = io.ReadAll(io.LimitReader(lzw.NewReader(bytes.NewReader(raw), lzw.MSB, 8), int64(expected)))
+	case tiffCompressionDeflate, tiffCompressionDeflateOld:
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(bytes.NewReader(raw))
+		if err == nil {
+			data, err = io.ReadAll(io.LimitReader(zr, int64(expected)))
+			zr.Close()
+		}
+	case tiffCompressionJPEG:
+		return img.decodeJpegTile(raw)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(data)) < rowLength*rows {
+		return nil, fmt.Errorf("tiff tile %v is truncated", index)
+	}
+
+	if uint64(len(data)) < expected {
+		// A short final strip, padded out so it can be treated like any other tile
+		padded := make([]byte, expected)
+		copy(padded, data)
+		data = padded
+	}
+
+	data = data[:expected]
+
+	switch img.predictor {
+	case tiffPredictorHorizontal:
+		img.undoHorizontalPredictor(data)
+	case tiffPredictorFloat:
+		data = img.undoFloatPredictor(data)
+	}
+
+	return data, nil
+}
+
+func (img *cogImage) decodeJpegTile(raw []byte) ([]byte, error) {
+	// Tiles share their quantization and huffman tables, which are stored once in the IFD. Splicing
+	// them in front of the tile (minus the duplicate start and end markers) makes a standalone jpeg
+	if len(img.jpegTables) > 4 && len(raw) > 2 {
+		spliced := make([]byte, 0, len(img.jpegTables)+len(raw))
+		spliced = append(spliced, img.jpegTables[:len(img.jpegTables)-2]...)
+		raw = append(spliced, raw[2:]...)
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	spp := img.samplesPerPixel
+	data := make([]byte, img.tileWidth*img.tileHeight*spp)
+	bounds := decoded.Bounds()
+
+	for y := range min(uint64(bounds.Dy()), img.tileHeight) {
+		for x := range min(uint64(bounds.Dx()), img.tileWidth) {
+			i := (y*img.tileWidth + x) * spp
+			if gray, ok := decoded.(*image.Gray); ok {
+				data[i] = gray.Pix[gray.PixOffset(bounds.Min.X+int(x), bounds.Min.Y+int(y))]
+				continue
+			}
+
+			red, green, blue, _ := decoded.At(bounds.Min.X+int(x), bounds.Min.Y+int(y)).RGBA()
+			data[i] = uint8(red >> 8)
+			if spp == 3 {
+				data[i+1] = uint8(green >> 8)
+				data[i+2] = uint8(blue >> 8)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// undoHorizontalPredictor reverses the differencing between each sample and the same sample of
+// the pixel to its left
+func (img *cogImage) undoHorizontalPredictor(data []byte) {
+	spp := img.samplesPerPixel
+	rowLength := img.tileWidth * spp
+
+	for row := range img.tileHeight {
+		start := row * rowLength
+
+		for i := spp; i < rowLength; i++ {
+			cur := start + i
+			prev := cur - spp
+
+			switch img.bitsPerSample {
+			case 8:
+				data[cur] += data[prev]
+			case 16:
+				img.order.PutUint16(data[cur*2:], img.order.Uint16(data[cur*2:])+img.order.Uint16(data[prev*2:]))
+			case 32:
+				img.order.PutUint32(data[cur*4:], img.order.Uint32(data[cur*4:])+img.order.Uint32(data[prev*4:]))
+			}
+		}
+	}
+}
+
+// undoFloatPredictor reverses the floating point predictor, which differences bytes after
+// splitting each row into planes of most to least significant bytes
+func (img *cogImage) undoFloatPredictor(data []byte) []byte {
+	bytesPerSample := img.bitsPerSample / 8
+	samples := img.tileWidth * img.samplesPerPixel
+	rowBytes := samples * bytesPerSample
+	result := make([]byte, len(data))
+
+	for row := range img.tileHeight {
+		in := data[row*rowBytes : (row+1)*rowBytes]
+		out := result[row*rowBytes : (row+1)*rowBytes]
+
+		for i := img.samplesPerPixel; i < rowBytes; i++ {
+			in[i] += in[i-img.samplesPerPixel]
+		}
+
+		for s := range samples {
+			for b := range bytesPerSample {
+				// Planes run from most significant byte to least
+				plane := in[b*samples+s]
+				if img.order == binary.BigEndian {
+					out[s*bytesPerSample+b] = plane
+				} else {
+					out[s*bytesPerSample+bytesPerSample-b-1] = plane
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// sample reads one sample value out of a decoded tile
+func (img *cogImage) sample(data []byte, x uint64, y uint64, band uint64) float64 {
+	i := ((y*img.tileWidth+x)*img.samplesPerPixel + band) * (img.bitsPerSample / 8)
+
+	switch img.bitsPerSample {
+	case 8:
+		if img.sampleFormat == tiffSampleFormatInt {
+			return float64(int8(data[i]))
+		}
+		return float64(data[i])
+	case 16:
+		v := img.order.Uint16(data[i:])
+		if img.sampleFormat == tiffSampleFormatInt {
+			return float64(int16(v))
+		}
+		return float64(v)
+	case 32:
+		v := img.order.Uint32(data[i:])
+		switch img.sampleFormat {
+		case tiffSampleFormatInt:
+			return float64(int32(v))
+		case tiffSampleFormatFloat:
+			return float64(math.Float32frombits(v))
+		}
+		return float64(v)
+	}
+
+	return math.Float64frombits(img.order.Uint64(data[i:]))
+}
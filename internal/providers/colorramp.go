@@ -0,0 +1,295 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/Michad/tilegroxy/internal/images"
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/anthonynsimon/bild/parallel"
+)
+
+const (
+	colorRampContinuous = "continuous"
+	colorRampDiscrete   = "discrete"
+)
+
+var allColorRampModes = []string{colorRampContinuous, colorRampDiscrete}
+
+// How the value is read from each pixel
+const (
+	colorRampEncodingChannel = "channel"
+	colorRampEncodingRGB     = "rgb"
+)
+
+var allColorRampEncodings = []string{colorRampEncodingChannel, colorRampEncodingRGB}
+
+var allColorRampChannels = []string{"gray", "red", "green", "blue", "alpha"}
+
+type ColorStop struct {
+	Value float64
+	Color string
+}
+
+type ColorRampConfig struct {
+	Stops       []ColorStop
+	Mode        string   // Whether colors blend between stops or change abruptly at each one
+	Encoding    string   // Whether the value is a single channel or packed into red, green and blue
+	Channel     string   // The channel holding the value when Encoding is channel
+	Scale       float64  // Multiplier applied to the raw value
+	Offset      float64  // Added to the raw value after scaling
+	NoData      *float64 // Raw value, before scale and offset, marking a pixel without data
+	NoDataColor string
+	Provider    map[string]interface{}
+}
+
+type ColorRamp struct {
+	ColorRampConfig
+	values      []float64
+	colors      []color.NRGBA
+	noDataColor color.NRGBA
+	// For the channel encoding, the color of every possible raw value
+	lookup   *[256]color.NRGBA
+	provider layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(ColorRampRegistration{})
+}
+
+type ColorRampRegistration struct {
+}
+
+func (s ColorRampRegistration) InitializeConfig() any {
+	return ColorRampConfig{}
+}
+
+func (s ColorRampRegistration) Name() string {
+	return "colorramp"
+}
+
+func (s ColorRampRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(ColorRampConfig)
+
+	if len(cfg.Stops) == 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.colorramp.stops")
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = colorRampContinuous
+	}
+
+	if !slices.Contains(allColorRampModes, cfg.Mode) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.colorramp.mode", cfg.Mode, allColorRampModes)
+	}
+
+	if cfg.Encoding == "" {
+		cfg.Encoding = colorRampEncodingChannel
+	}
+
+	if !slices.Contains(allColorRampEncodings, cfg.Encoding) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.colorramp.encoding", cfg.Encoding, allColorRampEncodings)
+	}
+
+	if cfg.Channel == "" {
+		cfg.Channel = "gray"
+	}
+
+	if !slices.Contains(allColorRampChannels, cfg.Channel) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.colorramp.channel", cfg.Channel, allColorRampChannels)
+	}
+
+	if cfg.Scale == 0 {
+		cfg.Scale = 1
+	}
+
+	var noDataColor color.NRGBA
+	if cfg.NoDataColor != "" {
+		var err error
+		noDataColor, err = images.ParseColor(cfg.NoDataColor)
+		if err != nil {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.colorramp.nodatacolor", cfg.NoDataColor)
+		}
+	}
+
+	errs := make([]error, 0)
+	values := make([]float64, len(cfg.Stops))
+	colors := make([]color.NRGBA, len(cfg.Stops))
+
+	for i, stop := range cfg.Stops {
+		param := "provider.colorramp.stops[" + strconv.Itoa(i) + "]"
+
+		if i > 0 && stop.Value <= cfg.Stops[i-1].Value {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".value", stop.Value))
+		}
+
+		col, err := images.ParseColor(stop.Color)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".color", stop.Color))
+		}
+
+		values[i] = stop.Value
+		colors[i] = col
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	ramp := &ColorRamp{ColorRampConfig: cfg, values: values, colors: colors, noDataColor: noDataColor, provider: provider}
+
+	if cfg.Encoding == colorRampEncodingChannel {
+		ramp.lookup = new([256]color.NRGBA)
+		for raw := range ramp.lookup {
+			ramp.lookup[raw] = ramp.colorOf(float64(raw))
+		}
+	}
+
+	return ramp, nil
+}
+
+func (t ColorRamp) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. ColorRamp holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t ColorRamp) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t ColorRamp) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	img, err := t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil || img == nil {
+		return img, err
+	}
+
+	if isMVT(img) {
+		return nil, fmt.Errorf("color ramp requires imagery but got %v", img.ContentType)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Rect, decoded, bounds.Min, draw.Src)
+
+	out := image.NewNRGBA(src.Rect)
+
+	parallel.Line(src.Rect.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range src.Rect.Dx() {
+				i := y*src.Stride + x*4
+				col := t.colorOfPixel(src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3])
+				out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = col.R, col.G, col.B, col.A
+			}
+		}
+	})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng, ForceSkipCache: img.ForceSkipCache}, nil
+}
+
+// colorOfPixel reads the raw value out of a pixel and looks up its color. Fully transparent pixels
+// have no data unless the value is the transparency itself
+func (t ColorRamp) colorOfPixel(r, g, b, a uint8) color.NRGBA {
+	if a == 0 && t.Channel != "alpha" {
+		return t.noDataColor
+	}
+
+	if t.lookup == nil {
+		return t.colorOf(float64(r)*65536 + float64(g)*256 + float64(b))
+	}
+
+	switch t.Channel {
+	case "red":
+		return t.lookup[r]
+	case "green":
+		return t.lookup[g]
+	case "blue":
+		return t.lookup[b]
+	case "alpha":
+		return t.lookup[a]
+	}
+
+	// Same weights as color.GrayModel
+	gray := (19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16
+	return t.lookup[gray]
+}
+
+// colorOf maps a raw value to its color along the ramp
+func (t ColorRamp) colorOf(raw float64) color.NRGBA {
+	if t.NoData != nil && raw == *t.NoData {
+		return t.noDataColor
+	}
+
+	v := raw*t.Scale + t.Offset
+	if math.IsNaN(v) {
+		return t.noDataColor
+	}
+
+	// The first stop above the value
+	i := sort.SearchFloat64s(t.values, v)
+	if i < len(t.values) && t.values[i] == v {
+		return t.colors[i]
+	}
+
+	if t.Mode == colorRampDiscrete {
+		// Each stop colors everything from its value up to the next stop
+		if i == 0 {
+			return color.NRGBA{}
+		}
+		return t.colors[i-1]
+	}
+
+	if i == 0 {
+		return t.colors[0]
+	}
+	if i == len(t.values) {
+		return t.colors[i-1]
+	}
+
+	f := (v - t.values[i-1]) / (t.values[i] - t.values[i-1])
+	lerp := func(a, b uint8) uint8 { return uint8(math.Round(float64(a) + f*(float64(b)-float64(a)))) }
+	lo, hi := t.colors[i-1], t.colors[i]
+
+	return color.NRGBA{lerp(lo.R, hi.R), lerp(lo.G, hi.G), lerp(lo.B, hi.B), lerp(lo.A, hi.A)}
+}
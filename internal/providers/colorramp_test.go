@@ -0,0 +1,181 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testColorStops = []ColorStop{{Value: 0, Color: "0000ff"}, {Value: 100, Color: "ffffff"}, {Value: 200, Color: "#ff0000"}}
+
+func makeColorRamp(t *testing.T, cfg ColorRampConfig, img image.Image) *ColorRamp {
+	t.Helper()
+
+	if cfg.Stops == nil {
+		cfg.Stops = testColorStops
+	}
+	cfg.Provider = map[string]interface{}{"name": "static", "color": "F00"}
+	p, err := ColorRampRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	c := p.(*ColorRamp)
+	c.provider = &recordingProvider{img: &pkg.Image{Content: buf.Bytes(), ContentType: mimePng, ForceSkipCache: true}}
+	return c
+}
+
+func renderColorRamp(t *testing.T, c *ColorRamp) *image.NRGBA {
+	t.Helper()
+
+	img, err := c.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.True(t, img.ForceSkipCache)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	out := image.NewNRGBA(decoded.Bounds())
+	for y := range out.Rect.Dy() {
+		for x := range out.Rect.Dx() {
+			out.Set(x, y, decoded.At(x, y))
+		}
+	}
+	return out
+}
+
+// grayRow gives an image one pixel high with a pixel of each gray value
+func grayRow(values ...uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, len(values), 1))
+	copy(img.Pix, values)
+	return img
+}
+
+func Test_ColorRampValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := ColorRampRegistration{}.Initialize(ColorRampConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: testColorStops, Mode: "stepped", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: testColorStops, Encoding: "float", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: testColorStops, Channel: "cyan", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: testColorStops, NoDataColor: "nope", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: []ColorStop{{Value: 10, Color: "fff"}, {Value: 5, Color: "000"}}, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: []ColorStop{{Value: 10, Color: "white"}}, Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := ColorRampRegistration{}.Initialize(ColorRampConfig{Stops: testColorStops, Provider: s}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, "continuous", p.(*ColorRamp).Mode)
+	assert.Equal(t, "channel", p.(*ColorRamp).Encoding)
+	assert.Equal(t, "gray", p.(*ColorRamp).Channel)
+	assert.InDelta(t, 1.0, p.(*ColorRamp).Scale, 0)
+}
+
+func Test_ColorRampContinuous(t *testing.T) {
+	c := makeColorRamp(t, ColorRampConfig{Scale: 2, Offset: -10}, grayRow(0, 5, 30, 55, 105, 200))
+	out := renderColorRamp(t, c)
+
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, out.NRGBAAt(0, 0))     // -10 is below the first stop
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, out.NRGBAAt(1, 0))     // 0
+	assert.Equal(t, color.NRGBA{128, 128, 255, 255}, out.NRGBAAt(2, 0)) // 50, halfway to white
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, out.NRGBAAt(3, 0)) // 100
+	assert.Equal(t, color.NRGBA{255, 0, 0, 255}, out.NRGBAAt(4, 0))     // 200
+	assert.Equal(t, color.NRGBA{255, 0, 0, 255}, out.NRGBAAt(5, 0))     // 390 is above the last stop
+}
+
+func Test_ColorRampDiscrete(t *testing.T) {
+	stops := []ColorStop{{Value: 10, Color: "0000ff"}, {Value: 100, Color: "ffffff"}}
+	c := makeColorRamp(t, ColorRampConfig{Stops: stops, Mode: "discrete"}, grayRow(5, 10, 99, 100, 255))
+	out := renderColorRamp(t, c)
+
+	assert.Equal(t, color.NRGBA{}, out.NRGBAAt(0, 0))
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, out.NRGBAAt(1, 0))
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, out.NRGBAAt(2, 0))
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, out.NRGBAAt(3, 0))
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, out.NRGBAAt(4, 0))
+}
+
+func Test_ColorRampNoData(t *testing.T) {
+	noData := 0.0
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{100, 100, 100, 255})
+	src.SetNRGBA(2, 0, color.NRGBA{100, 100, 100, 0})
+
+	c := makeColorRamp(t, ColorRampConfig{NoData: &noData, NoDataColor: "00ff0080"}, src)
+	out := renderColorRamp(t, c)
+
+	assert.Equal(t, color.NRGBA{0, 255, 0, 128}, out.NRGBAAt(0, 0))
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, out.NRGBAAt(1, 0))
+	assert.Equal(t, color.NRGBA{0, 255, 0, 128}, out.NRGBAAt(2, 0))
+}
+
+func Test_ColorRampChannel(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0, 100, 200, 255})
+
+	out := renderColorRamp(t, makeColorRamp(t, ColorRampConfig{Channel: "green"}, src))
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, out.NRGBAAt(0, 0))
+
+	out = renderColorRamp(t, makeColorRamp(t, ColorRampConfig{Channel: "blue"}, src))
+	assert.Equal(t, color.NRGBA{255, 0, 0, 255}, out.NRGBAAt(0, 0))
+}
+
+func Test_ColorRampRGB(t *testing.T) {
+	// Terrain-RGB style: -10000 + packed * 0.1
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0x01, 0x86, 0xa0, 255}) // 0m
+	src.SetNRGBA(1, 0, color.NRGBA{0x01, 0x8a, 0x88, 255}) // 100m
+
+	stops := []ColorStop{{Value: 0, Color: "000"}, {Value: 1000, Color: "fff"}}
+	c := makeColorRamp(t, ColorRampConfig{Stops: stops, Encoding: "rgb", Scale: 0.1, Offset: -10000}, src)
+	out := renderColorRamp(t, c)
+
+	assert.Equal(t, color.NRGBA{0, 0, 0, 255}, out.NRGBAAt(0, 0))
+	assert.Equal(t, color.NRGBA{26, 26, 26, 255}, out.NRGBAAt(1, 0))
+}
+
+func Test_ColorRampRejectsMVT(t *testing.T) {
+	c := makeColorRamp(t, ColorRampConfig{}, grayRow(0))
+	c.provider = &recordingProvider{img: &pkg.Image{Content: []byte{0x1a, 0x00}, ContentType: mvtContentType}}
+
+	_, err := c.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.Error(t, err)
+}
@@ -27,14 +27,22 @@ import (
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/Michad/tilegroxy/pkg/entities/layer"
 	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/paulmach/orb/encoding/mvt"
 )
 
+type CompositeMVTRename struct {
+	From string
+	To   string
+}
+
 type CompositeMVTConfig struct {
 	Providers []map[string]interface{}
+	Rename    []CompositeMVTRename
+	Exclude   []string
 }
 
 type CompositeMVT struct {
-	// CompositeMVTConfig
+	CompositeMVTConfig
 	providers     []layer.Provider
 	errorMessages config.ErrorMessages
 }
@@ -66,12 +74,21 @@ func (s CompositeMVTRegistration) Initialize(cfgAny any, deps layer.ProviderDeps
 		errorSlice = append(errorSlice, err)
 	}
 
+	for i, r := range cfg.Rename {
+		if r.From == "" {
+			errorSlice = append(errorSlice, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.compositemvt.rename["+strconv.Itoa(i)+"].from"))
+		}
+		if r.To == "" {
+			errorSlice = append(errorSlice, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.compositemvt.rename["+strconv.Itoa(i)+"].to"))
+		}
+	}
+
 	errorsFlat := errors.Join(errorSlice...)
 	if errorsFlat != nil {
 		return nil, errorsFlat
 	}
 
-	return &CompositeMVT{providers: providers, errorMessages: deps.ErrorMessages}, nil
+	return &CompositeMVT{CompositeMVTConfig: cfg, providers: providers, errorMessages: deps.ErrorMessages}, nil
 }
 
 // Close releases the child providers. CompositeMVT holds them directly rather than through a
@@ -94,8 +111,8 @@ func (t CompositeMVT) GenerateTile(ctx context.Context, providerContext layer.Pr
 	slog.DebugContext(ctx, fmt.Sprintf("Compositing %v providers", len(t.providers)))
 
 	wg := sync.WaitGroup{}
-	errs := make(chan error, len(t.providers))
-	imgs := make(chan *pkg.Image, len(t.providers))
+	imgs := make([]*pkg.Image, len(t.providers))
+	errs := make([]error, len(t.providers))
 
 	for i, p := range t.providers {
 		wg.Add(1)
@@ -104,34 +121,65 @@ func (t CompositeMVT) GenerateTile(ctx context.Context, providerContext layer.Pr
 
 	wg.Wait()
 
-	imgSlice := make([]*pkg.Image, len(t.providers))
-	errSlice := make([]error, len(t.providers))
-	for i := range t.providers {
-		errSlice[i] = <-errs
-		imgSlice[i] = <-imgs
-	}
-
-	joinError := errors.Join(errSlice...)
+	joinError := errors.Join(errs...)
 
 	if joinError != nil {
 		return nil, joinError
 	}
 
-	resultImg := pkg.Image{ContentType: mvtContentType, ForceSkipCache: false, Content: []byte{}}
-	for _, img := range imgSlice {
-		resultImg.Content = slices.Concat(resultImg.Content, img.Content)
-		if img.ForceSkipCache {
-			resultImg.ForceSkipCache = true
+	return t.merge(imgs)
+}
+
+// merge combines the layers of every tile into one. Layers are renamed first, then layers that end
+// up sharing a name are combined into one with the features of each, in the order the providers
+// are configured. Excluded layers are left out entirely
+func (t CompositeMVT) merge(imgs []*pkg.Image) (*pkg.Image, error) {
+	result := make(mvt.Layers, 0)
+	byName := make(map[string]*mvt.Layer)
+	forceSkipCache := false
+
+	for _, img := range imgs {
+		if img == nil {
+			continue
+		}
+
+		forceSkipCache = forceSkipCache || img.ForceSkipCache
+
+		layers, err := decodeMVT(img)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, l := range layers {
+			for _, r := range t.Rename {
+				if l.Name == r.From {
+					l.Name = r.To
+					break
+				}
+			}
+
+			if slices.Contains(t.Exclude, l.Name) {
+				continue
+			}
+
+			existing, ok := byName[l.Name]
+			if !ok {
+				byName[l.Name] = l
+				result = append(result, l)
+				continue
+			}
+
+			mergeMVTLayer(existing, l)
 		}
 	}
 
-	return &resultImg, nil
+	return encodeMVT(result, forceSkipCache)
 }
 
-func callCompositingProvider(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest, provider layer.Provider, i int, imgs chan *pkg.Image, errs chan error, wg *sync.WaitGroup) {
+func callCompositingProvider(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest, provider layer.Provider, i int, imgs []*pkg.Image, errs []error, wg *sync.WaitGroup) {
 	defer func() {
 		if r := recover(); r != nil {
-			errs <- fmt.Errorf("unexpected composite error %v", r)
+			errs[i] = fmt.Errorf("unexpected composite error %v", r)
 		}
 		wg.Done()
 	}()
@@ -148,12 +196,18 @@ func callCompositingProvider(ctx context.Context, providerContext layer.Provider
 		img, err = provider.GenerateTile(ctx, layer.ProviderContext{}, tileRequest)
 	}
 
-	if img != nil {
-		imgs <- img
-	} else if err == nil {
+	// A child with nothing for this tile, such as an mbtiles file that doesn't cover it, just
+	// contributes no layers
+	var notFound pkg.TileNotFoundError
+	if errors.As(err, &notFound) {
+		return
+	}
+
+	if img == nil && err == nil {
 		// img and err are both nil -- that's not right
 		err = errors.New("no image returned to compositor")
 	}
 
-	errs <- err
+	imgs[i] = img
+	errs[i] = err
 }
@@ -16,11 +16,15 @@ package providers
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"testing"
 
-	"github.com/Michad/tilegroxy/internal/images"
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -60,8 +64,85 @@ func Test_Composite_ExecuteStatic(t *testing.T) {
 	assert.NotNil(t, img)
 	require.NoError(t, err)
 
-	imgExp, err := images.GetStaticImage("embedded:box.mvt")
+	// Both children have the same layer, so the result is that one layer with the box twice
+	layers, err := mvt.Unmarshal(img.Content)
 	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, "layer", layers[0].Name)
+	assert.Len(t, layers[0].Features, 2)
+}
+
+func makeCompositeTile(t *testing.T, extent uint32, layers map[string][]*geojson.Feature) []byte {
+	t.Helper()
+
+	result := make(mvt.Layers, 0, len(layers))
+	for _, name := range slices.Sorted(maps.Keys(layers)) {
+		result = append(result, &mvt.Layer{Name: name, Version: 2, Extent: extent, Features: layers[name]})
+	}
+
+	content, err := mvt.Marshal(result)
+	require.NoError(t, err)
+
+	return content
+}
+
+func Test_Composite_MergesLayers(t *testing.T) {
+	road := geojson.NewFeature(orb.LineString{{0, 0}, {100, 100}})
+	road.Properties["kind"] = "primary"
+	path := geojson.NewFeature(orb.LineString{{10, 10}, {20, 20}})
+	path.Properties["surface"] = "gravel"
+	path.Properties["kind"] = "path"
+	water := geojson.NewFeature(orb.Point{5, 5})
+	park := geojson.NewFeature(orb.Point{8, 8})
+
+	first := makeCompositeTile(t, 4096, map[string][]*geojson.Feature{"roads": {road}, "water": {water}})
+	gzipped, err := mvt.MarshalGzipped(mvt.Layers{
+		{Name: "paths", Version: 2, Extent: 512, Features: []*geojson.Feature{path}},
+		{Name: "parks", Version: 2, Extent: 512, Features: []*geojson.Feature{park}},
+	})
+	require.NoError(t, err)
+
+	c := CompositeMVT{
+		CompositeMVTConfig: CompositeMVTConfig{
+			Rename:  []CompositeMVTRename{{From: "paths", To: "roads"}},
+			Exclude: []string{"water"},
+		},
+		providers: []layer.Provider{
+			&recordingProvider{img: &pkg.Image{Content: first, ContentType: mvtContentType}},
+			&recordingProvider{img: &pkg.Image{Content: gzipped, ContentType: mvtContentType}},
+			&recordingProvider{img: &pkg.Image{Content: []byte{}, ContentType: mvtContentType}},
+			&recordingProvider{err: pkg.TileNotFoundError{}},
+		},
+	}
+
+	img, err := c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 9, X: 23, Y: 32})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+
+	assert.Equal(t, "roads", layers[0].Name)
+	assert.Equal(t, uint32(4096), layers[0].Extent)
+	require.Len(t, layers[0].Features, 2)
+	assert.Equal(t, "primary", layers[0].Features[0].Properties["kind"])
+	assert.Equal(t, "path", layers[0].Features[1].Properties["kind"])
+	assert.Equal(t, "gravel", layers[0].Features[1].Properties["surface"])
+
+	// Brought up from an extent of 512 to match the layer it joined
+	assert.Equal(t, orb.LineString{{80, 80}, {160, 160}}, layers[0].Features[1].Geometry)
+
+	assert.Equal(t, "parks", layers[1].Name)
+	assert.Equal(t, uint32(512), layers[1].Extent)
+}
+
+func Test_Composite_Validate(t *testing.T) {
+	provConfig := map[string]interface{}{
+		"name":  "static",
+		"image": "embedded:box.mvt",
+	}
 
-	assert.Len(t, img.Content, len(*imgExp)*2)
+	_, err := CompositeMVTRegistration{}.Initialize(CompositeMVTConfig{Providers: []map[string]interface{}{provConfig}, Rename: []CompositeMVTRename{{From: "a"}}}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.Error(t, err)
 }
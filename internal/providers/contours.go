@@ -0,0 +1,400 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+const contoursDefaultMajor = 5
+
+// Used when no intervals are configured
+var contoursDefaultIntervals = []ContourInterval{
+	{Zoom: "0-9", Interval: 200},
+	{Zoom: "10", Interval: 100},
+	{Zoom: "11", Interval: 50},
+	{Zoom: "12-14", Interval: 20},
+	{Zoom: "15-21", Interval: 10},
+}
+
+type ContourInterval struct {
+	Zoom     string  // Zoom levels the interval is used at
+	Interval float64 // Meters between lines
+	Major    int     // Lines at a multiple of this many intervals are index contours
+}
+
+type ContoursConfig struct {
+	Encoding  string
+	Intervals []ContourInterval
+	Layer     string
+	Extent    uint32
+	Simplify  *float64
+	Provider  map[string]interface{}
+}
+
+type Contours struct {
+	ContoursConfig
+	// intervalZooms[i] holds the zoom levels of Intervals[i]
+	intervalZooms [][]int
+	tolerance     float64
+	provider      layer.Provider
+	elevation     *elevationCache
+}
+
+func init() {
+	layer.RegisterProvider(ContoursRegistration{})
+}
+
+type ContoursRegistration struct {
+}
+
+func (s ContoursRegistration) InitializeConfig() any {
+	return ContoursConfig{}
+}
+
+func (s ContoursRegistration) Name() string {
+	return "contours"
+}
+
+func (s ContoursRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(ContoursConfig)
+
+	if cfg.Encoding == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.contours.encoding")
+	}
+
+	if !slices.Contains(allElevationEncodings, cfg.Encoding) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.contours.encoding", cfg.Encoding, allElevationEncodings)
+	}
+
+	if len(cfg.Intervals) == 0 {
+		cfg.Intervals = contoursDefaultIntervals
+	}
+
+	if cfg.Layer == "" {
+		cfg.Layer = "contours"
+	}
+
+	if cfg.Extent == 0 {
+		cfg.Extent = mvt.DefaultExtent
+	}
+
+	tolerance := 1.0
+	if cfg.Simplify != nil {
+		if *cfg.Simplify < 0 {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.contours.simplify", *cfg.Simplify)
+		}
+		tolerance = *cfg.Simplify
+	}
+
+	errs := make([]error, 0)
+	intervals := make([]ContourInterval, len(cfg.Intervals))
+	intervalZooms := make([][]int, len(cfg.Intervals))
+
+	for i, interval := range cfg.Intervals {
+		param := "provider.contours.intervals[" + strconv.Itoa(i) + "]"
+
+		zooms, err := pkg.ParseZoomString(interval.Zoom)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".zoom", interval.Zoom))
+		}
+		intervalZooms[i] = zooms
+
+		if interval.Interval <= 0 {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".interval", interval.Interval))
+		}
+
+		if interval.Major == 0 {
+			interval.Major = contoursDefaultMajor
+		}
+
+		if interval.Major < 0 {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".major", interval.Major))
+		}
+
+		intervals[i] = interval
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// Copied so filling in defaults doesn't touch the shared default intervals
+	cfg.Intervals = intervals
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	elevation, err := newElevationCache(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Contours{cfg, intervalZooms, tolerance, provider, elevation}, nil
+}
+
+func (t Contours) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Contours holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Contours) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Contours) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	var interval *ContourInterval
+	for i := range t.Intervals {
+		if slices.Contains(t.intervalZooms[i], tileRequest.Z) {
+			interval = &t.Intervals[i]
+			break
+		}
+	}
+
+	if interval == nil {
+		slog.DebugContext(ctx, fmt.Sprintf("No contour interval for zoom %v", tileRequest.Z))
+		return encodeMVT(mvt.Layers{}, false)
+	}
+
+	elevation, err := fetchElevation(ctx, t.provider, t.elevation, providerContext, tileRequest, t.Encoding)
+	if err != nil || elevation == nil {
+		return nil, err
+	}
+
+	lines := traceContours(elevation, interval.Interval)
+
+	features := make([]*geojson.Feature, 0, len(lines))
+	scale := float64(t.Extent) / float64(elevation.size)
+
+	for _, level := range slices.Sorted(maps.Keys(lines)) {
+		ele := float64(level) * interval.Interval
+		// Avoids attributes like 0.30000000000000004 from fractional intervals
+		ele = math.Round(ele*1e6) / 1e6
+
+		multi := make(orb.MultiLineString, 0, len(lines[level]))
+		for _, line := range lines[level] {
+			for i := range line {
+				line[i] = orb.Point{line[i][0] * scale, line[i][1] * scale}
+			}
+			multi = append(multi, line)
+		}
+
+		f := geojson.NewFeature(multi)
+		f.Properties["ele"] = ele
+		f.Properties["index"] = pkg.Ternary(level%int64(interval.Major) == 0, "major", "minor")
+		features = append(features, f)
+	}
+
+	l := &mvt.Layer{Name: t.Layer, Version: 2, Extent: t.Extent, Features: features}
+
+	if t.tolerance > 0 {
+		l.Simplify(simplify.DouglasPeucker(t.tolerance))
+	}
+
+	transformMVTLayer(l, func(p orb.Point) orb.Point { return p })
+	l.RemoveEmpty(1, 1)
+
+	layers := mvt.Layers{}
+	if len(l.Features) > 0 {
+		layers = append(layers, l)
+	}
+
+	return encodeMVT(layers, elevation.forceSkipCache)
+}
+
+// traceContours runs marching squares over the grid of pixel centers, including the centers one
+// pixel into each neighbor so lines continue across the tile edge. It returns the lines at each
+// multiple of interval, keyed by the multiple, in pixel coordinates of the requested tile
+func traceContours(elevation *elevationTiles, interval float64) map[int64][]orb.LineString {
+	size := elevation.size
+	n := size + 2 // Grid points per side
+
+	values := make([]float64, n*n)
+	for iy := range n {
+		for ix := range n {
+			values[iy*n+ix] = elevation.at(ix-1, iy-1)
+		}
+	}
+
+	// Each crossing of a line over an edge between two grid points is identified by the first
+	// point's index times two, plus one for vertical edges. A segment joins two crossings
+	hEdge := func(ix, iy int) int { return (iy*n + ix) * 2 }
+	vEdge := func(ix, iy int) int { return (iy*n+ix)*2 + 1 }
+
+	type segments struct {
+		pairs  [][2]int
+		points map[int]orb.Point
+	}
+	levels := make(map[int64]*segments)
+
+	crossing := func(edge int, level float64) orb.Point {
+		ix, iy := (edge/2)%n, (edge/2)/n
+		ix2, iy2 := ix+(1-edge%2), iy+edge%2
+
+		v1, v2 := values[iy*n+ix], values[iy2*n+ix2]
+		f := (level - v1) / (v2 - v1)
+
+		// Grid points sit at pixel centers, starting half a pixel outside the tile
+		return orb.Point{float64(ix) - 0.5 + f*float64(ix2-ix), float64(iy) - 0.5 + f*float64(iy2-iy)}
+	}
+
+	for iy := range n - 1 {
+		for ix := range n - 1 {
+			tl, tr := values[iy*n+ix], values[iy*n+ix+1]
+			bl, br := values[(iy+1)*n+ix], values[(iy+1)*n+ix+1]
+
+			lo := math.Ceil(min(tl, tr, bl, br) / interval)
+			hi := math.Floor(max(tl, tr, bl, br) / interval)
+
+			top, bottom := hEdge(ix, iy), hEdge(ix, iy+1)
+			left, right := vEdge(ix, iy), vEdge(ix+1, iy)
+
+			for k := lo; k <= hi; k++ {
+				level := k * interval
+
+				c := 0
+				for bit, v := range []float64{bl, br, tr, tl} {
+					if v >= level {
+						c |= 1 << bit
+					}
+				}
+
+				var pairs [][2]int
+				switch c {
+				case 1, 14:
+					pairs = [][2]int{{left, bottom}}
+				case 2, 13:
+					pairs = [][2]int{{bottom, right}}
+				case 3, 12:
+					pairs = [][2]int{{left, right}}
+				case 4, 11:
+					pairs = [][2]int{{top, right}}
+				case 6, 9:
+					pairs = [][2]int{{top, bottom}}
+				case 7, 8:
+					pairs = [][2]int{{top, left}}
+				case 5, 10:
+					// Saddles are resolved by the average of the corners, separating the corners on the
+					// other side of the level from the center
+					centerAbove := (tl+tr+bl+br)/4 >= level
+					if (c == 5) == centerAbove {
+						pairs = [][2]int{{left, top}, {bottom, right}}
+					} else {
+						pairs = [][2]int{{left, bottom}, {top, right}}
+					}
+				}
+
+				if len(pairs) == 0 {
+					continue
+				}
+
+				key := int64(k)
+				s := levels[key]
+				if s == nil {
+					s = &segments{points: make(map[int]orb.Point)}
+					levels[key] = s
+				}
+
+				for _, p := range pairs {
+					s.pairs = append(s.pairs, p)
+					for _, edge := range p {
+						if _, ok := s.points[edge]; !ok {
+							s.points[edge] = crossing(edge, level)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	result := make(map[int64][]orb.LineString, len(levels))
+	for k, s := range levels {
+		result[k] = joinSegments(s.pairs, s.points)
+	}
+
+	return result
+}
+
+// joinSegments chains segments that share a crossing into lines. Every crossing is shared by at
+// most two segments, so lines either run between two unshared crossings or form a loop
+func joinSegments(pairs [][2]int, points map[int]orb.Point) []orb.LineString {
+	byEdge := make(map[int][]int, len(points))
+	for i, p := range pairs {
+		byEdge[p[0]] = append(byEdge[p[0]], i)
+		byEdge[p[1]] = append(byEdge[p[1]], i)
+	}
+
+	used := make([]bool, len(pairs))
+	lines := make([]orb.LineString, 0)
+
+	walk := func(start int, edge int) {
+		line := orb.LineString{points[edge]}
+		for seg := start; seg >= 0; {
+			used[seg] = true
+			edge = pkg.Ternary(pairs[seg][0] == edge, pairs[seg][1], pairs[seg][0])
+			line = append(line, points[edge])
+
+			seg = -1
+			for _, next := range byEdge[edge] {
+				if !used[next] {
+					seg = next
+					break
+				}
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	// Open lines first, starting from either end, so they aren't broken in the middle
+	for i, p := range pairs {
+		if used[i] {
+			continue
+		}
+
+		for _, edge := range p {
+			if len(byEdge[edge]) == 1 {
+				walk(i, edge)
+				break
+			}
+		}
+	}
+
+	for i, p := range pairs {
+		if !used[i] {
+			walk(i, p[0])
+		}
+	}
+
+	return lines
+}
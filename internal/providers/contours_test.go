@@ -0,0 +1,167 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeContours(t *testing.T, cfg ContoursConfig, provider layer.Provider) *Contours {
+	t.Helper()
+
+	cfg.Encoding = elevationTerrarium
+	cfg.Provider = map[string]interface{}{"name": "static", "color": "F00"}
+	p, err := ContoursRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	c := p.(*Contours)
+	c.provider = provider
+	return c
+}
+
+func renderContours(t *testing.T, c *Contours, tileRequest pkg.TileRequest) mvt.Layers {
+	t.Helper()
+
+	img, err := c.GenerateTile(context.Background(), layer.ProviderContext{}, tileRequest)
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := decodeMVT(img)
+	require.NoError(t, err)
+	return layers
+}
+
+func Test_ContoursValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := ContoursRegistration{}.Initialize(ContoursConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ContoursRegistration{}.Initialize(ContoursConfig{Encoding: "srtm", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ContoursRegistration{}.Initialize(ContoursConfig{Encoding: "terrarium", Intervals: []ContourInterval{{Zoom: "a", Interval: 10}}, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ContoursRegistration{}.Initialize(ContoursConfig{Encoding: "terrarium", Intervals: []ContourInterval{{Zoom: "10", Interval: 0}}, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = ContoursRegistration{}.Initialize(ContoursConfig{Encoding: "terrarium", Intervals: []ContourInterval{{Zoom: "10", Interval: 10, Major: -1}}, Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := ContoursRegistration{}.Initialize(ContoursConfig{Encoding: "terrarium", Provider: s}, deps)
+	require.NoError(t, err)
+	c := p.(*Contours)
+	assert.Equal(t, "contours", c.Layer)
+	assert.Equal(t, uint32(4096), c.Extent)
+	assert.Len(t, c.Intervals, len(contoursDefaultIntervals))
+	assert.Equal(t, 5, c.Intervals[0].Major)
+	assert.Equal(t, 0, contoursDefaultIntervals[0].Major)
+}
+
+func Test_ContoursHill(t *testing.T) {
+	// A cone peaking at 95m in the middle of the tile, 1m lower for every pixel away from it
+	hill := &elevationProvider{size: 64, elevation: func(x, y int) float64 {
+		return 95 - math.Hypot(float64(x-5*64)-31.5, float64(y-5*64)-31.5)
+	}}
+	c := makeContours(t, ContoursConfig{Intervals: []ContourInterval{{Zoom: "10", Interval: 10, Major: 2}}}, hill)
+
+	layers := renderContours(t, c, pkg.TileRequest{LayerName: "l", Z: 10, X: 5, Y: 5})
+	require.Len(t, layers, 1)
+	assert.Equal(t, "contours", layers[0].Name)
+
+	// 90m down to 70m are complete rings within the tile, 60m and 50m are cut by the edges
+	ele := make(map[float64]string)
+	for _, f := range layers[0].Features {
+		ele[f.Properties["ele"].(float64)] = f.Properties["index"].(string)
+
+		if f.Properties["ele"].(float64) < 70 {
+			continue
+		}
+
+		lines := f.Geometry.(orb.LineString)
+		radius := (95 - f.Properties["ele"].(float64)) * 4096 / 64
+		assert.Equal(t, lines[0], lines[len(lines)-1])
+		for _, p := range lines {
+			assert.InDelta(t, radius, math.Hypot(p[0]-2048, p[1]-2048), 16)
+		}
+	}
+
+	assert.Equal(t, map[float64]string{90: "minor", 80: "major", 70: "minor", 60: "major", 50: "minor"}, ele)
+}
+
+func Test_ContoursSeamless(t *testing.T) {
+	// Rising 1m per pixel to the east, so every line runs north to south through the center of
+	// the pixel at its elevation
+	slope := &elevationProvider{size: 64, elevation: func(x, _ int) float64 { return float64(x - 7*64) }}
+	c := makeContours(t, ContoursConfig{Intervals: []ContourInterval{{Zoom: "12", Interval: 16}}, Extent: 64}, slope)
+
+	layers := renderContours(t, c, pkg.TileRequest{LayerName: "l", Z: 12, X: 7, Y: 3})
+	require.Len(t, layers, 1)
+	// 64m falls on the centers of the first column of pixels in the neighbor to the east
+	require.Len(t, layers[0].Features, 5)
+
+	for _, f := range layers[0].Features {
+		ele := f.Properties["ele"].(float64)
+		line := f.Geometry.(orb.LineString)
+
+		// Lines carry on past the top and bottom into the neighbors rather than stopping short
+		bound := line.Bound()
+		assert.InDelta(t, ele+0.5, bound.Min.X(), 1)
+		assert.InDelta(t, ele+0.5, bound.Max.X(), 1)
+		assert.Less(t, bound.Min.Y(), 0.0)
+		assert.Greater(t, bound.Max.Y(), 64.0)
+	}
+}
+
+func Test_ContoursNoInterval(t *testing.T) {
+	c := makeContours(t, ContoursConfig{Intervals: []ContourInterval{{Zoom: "12-14", Interval: 10}}}, &recordingProvider{})
+
+	layers := renderContours(t, c, pkg.TileRequest{LayerName: "l", Z: 8, X: 1, Y: 1})
+	assert.Empty(t, layers)
+}
+
+func Test_ContoursFlat(t *testing.T) {
+	flat := &elevationProvider{size: 32, elevation: func(_, _ int) float64 { return 20 }}
+	c := makeContours(t, ContoursConfig{}, flat)
+
+	// A level exactly at the ground has no crossings
+	layers := renderContours(t, c, pkg.TileRequest{LayerName: "l", Z: 12, X: 1, Y: 1})
+	assert.Empty(t, layers)
+}
+
+func Test_ContoursFetchesNeighborsOnce(t *testing.T) {
+	slope := &elevationProvider{size: 32, elevation: func(x, _ int) float64 { return float64(x - 2*32) }}
+	c := makeContours(t, ContoursConfig{}, slope)
+
+	for y := 1; y < 4; y++ {
+		for x := 1; x < 4; x++ {
+			renderContours(t, c, pkg.TileRequest{LayerName: "l", Z: 12, X: x, Y: y})
+		}
+	}
+
+	// The 3x3 tiles and the ring around them, rather than nine fetches for each tile
+	assert.Equal(t, int32(25), slope.calls.Load())
+}
@@ -18,15 +18,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/png"
 	"log/slog"
+	"slices"
 
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/Michad/tilegroxy/pkg/entities/layer"
 	"github.com/anthonynsimon/bild/transform"
+	"github.com/paulmach/orb/encoding/mvt"
 )
 
 type CropConfig struct {
@@ -34,12 +38,15 @@ type CropConfig struct {
 	Secondary      map[string]interface{}
 	Bounds         pkg.Bounds
 	BoundsFromAuth bool
+	Mask           map[string]interface{} // GeoJSON polygons to crop to instead of bounds
+	MaskFile       string                 // File containing GeoJSON polygons to crop to instead of bounds
 }
 
 type Crop struct {
 	CropConfig
 	Primary   layer.Provider
 	Secondary layer.Provider
+	mask      *polygonMask
 }
 
 func init() {
@@ -60,6 +67,11 @@ func (s CropRegistration) Name() string {
 func (s CropRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
 	cfg := cfgAny.(CropConfig)
 
+	mask, err := loadCropMask(cfg, deps)
+	if err != nil {
+		return nil, err
+	}
+
 	primary, err := layer.ConstructProvider(cfg.Primary, deps)
 	if err != nil {
 		return nil, err
@@ -69,7 +81,20 @@ func (s CropRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer
 		return nil, err
 	}
 
-	return &Crop{cfg, primary, secondary}, nil
+	return &Crop{cfg, primary, secondary, mask}, nil
+}
+
+func loadCropMask(cfg CropConfig, deps layer.ProviderDeps) (*polygonMask, error) {
+	mask, err := loadPolygonMask(cfg.Mask, cfg.MaskFile, "provider.crop.mask", deps)
+	if err != nil {
+		return nil, err
+	}
+
+	if mask != nil && !cfg.Bounds.IsNullIsland() {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamsMutuallyExclusive, "provider.crop.bounds", pkg.Ternary(cfg.Mask != nil, "provider.crop.mask", "provider.crop.maskfile"))
+	}
+
+	return mask, nil
 }
 
 func (t Crop) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
@@ -78,14 +103,20 @@ func (t Crop) PreAuth(ctx context.Context, providerContext layer.ProviderContext
 
 func (t Crop) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
 	boundsToCrop := t.Bounds
+	boundsFromAuth := false
 
 	if t.BoundsFromAuth {
 		b, ok := pkg.AllowedAreaFromContext(ctx)
 		if ok && b != nil && !b.IsNullIsland() {
 			boundsToCrop = *b
+			boundsFromAuth = true
 		}
 	}
 
+	if t.mask != nil && !boundsFromAuth {
+		return t.generateMaskedTile(ctx, providerContext, tileRequest)
+	}
+
 	intersects, err := tileRequest.IntersectsBounds(boundsToCrop)
 
 	if err != nil {
@@ -172,6 +203,104 @@ func (t Crop) GenerateTile(ctx context.Context, providerContext layer.ProviderCo
 	return &pkg.Image{Content: output, ContentType: mimePng, ForceSkipCache: img.ForceSkipCache}, nil
 }
 
+// generateMaskedTile crops to the polygons of the mask. Tiles that the edge of the mask doesn't
+// pass through come straight from one provider or the other without being decoded
+func (t Crop) generateMaskedTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	switch t.mask.relate(tileRequest) {
+	case maskOutside:
+		slog.DebugContext(ctx, "Tile fully outside crop mask")
+		return t.Secondary.GenerateTile(ctx, providerContext, tileRequest)
+	case maskInside:
+		slog.DebugContext(ctx, "Tile fully inside crop mask")
+		return t.Primary.GenerateTile(ctx, providerContext, tileRequest)
+	case maskPartial:
+	}
+
+	img, err := t.Primary.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	img2, err := t.Secondary.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if img == nil || img2 == nil {
+		return nil, errors.New("crop requires a tile from both providers")
+	}
+
+	forceSkipCache := img.ForceSkipCache || img2.ForceSkipCache
+
+	if isMVT(img) || isMVT(img2) {
+		if !isMVT(img) || !isMVT(img2) {
+			return nil, fmt.Errorf("crop can't combine %v with %v", img.ContentType, img2.ContentType)
+		}
+
+		return t.clipVectorTiles(img, img2, tileRequest, forceSkipCache)
+	}
+
+	realImage, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	realImage2, _, err := image.Decode(bytes.NewReader(img2.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	realImage, realImage2 = resizeImages(ctx, realImage, realImage2)
+
+	bounds := realImage.Bounds()
+	primary := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(primary, primary.Rect, realImage, bounds.Min, draw.Src)
+
+	resultImage := image.NewNRGBA(primary.Rect)
+	draw.Draw(resultImage, resultImage.Rect, realImage2, realImage2.Bounds().Min, draw.Src)
+
+	mask := t.mask.rasterize(tileRequest, bounds.Dx(), bounds.Dy())
+	for i, v := range mask.Pix {
+		if v != 0 {
+			copy(resultImage.Pix[i*4:i*4+4], primary.Pix[i*4:i*4+4])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resultImage); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng, ForceSkipCache: forceSkipCache}, nil
+}
+
+// clipVectorTiles keeps the features of the primary inside the mask and the features of the
+// secondary outside it. Layers from both with the same name are combined
+func (t Crop) clipVectorTiles(img *pkg.Image, img2 *pkg.Image, tileRequest pkg.TileRequest, forceSkipCache bool) (*pkg.Image, error) {
+	layers, err := decodeMVT(img)
+	if err != nil {
+		return nil, err
+	}
+
+	layers2, err := decodeMVT(img2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := t.mask.clipLayers(layers, tileRequest, true)
+
+	for _, l := range t.mask.clipLayers(layers2, tileRequest, false) {
+		i := slices.IndexFunc(result, func(existing *mvt.Layer) bool { return existing.Name == l.Name })
+		if i < 0 {
+			result = append(result, l)
+		} else {
+			mergeMVTLayer(result[i], l)
+		}
+	}
+
+	return encodeMVT(result, forceSkipCache)
+}
+
 func resizeImages(ctx context.Context, img image.Image, img2 image.Image) (image.Image, image.Image) {
 	if img.Bounds() != img2.Bounds() {
 		var size image.Point
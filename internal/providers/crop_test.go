@@ -17,12 +17,20 @@ package providers
 import (
 	"bytes"
 	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Michad/tilegroxy/internal/images"
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -175,3 +183,166 @@ func Test_Crop_ExecuteCropNoBounds(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, img1, img2)
 }
+
+// A mask covering the western hemisphere with a hole in the middle of it
+var testCropMask = map[string]interface{}{
+	"type": "Polygon",
+	"coordinates": []interface{}{
+		[]interface{}{[]interface{}{-180, -85}, []interface{}{0, -85}, []interface{}{0, 85}, []interface{}{-180, 85}, []interface{}{-180, -85}},
+		[]interface{}{[]interface{}{-120, -40}, []interface{}{-60, -40}, []interface{}{-60, 40}, []interface{}{-120, 40}, []interface{}{-120, -40}},
+	},
+}
+
+func makeMaskedCrop(t *testing.T, primary layer.Provider, secondary layer.Provider) *Crop {
+	t.Helper()
+
+	p, s, _ := makeCropProvidersImages()
+	f, err := CropRegistration{}.Initialize(CropConfig{Mask: testCropMask, Primary: p, Secondary: s}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	c := f.(*Crop)
+	c.Primary = primary
+	c.Secondary = secondary
+	return c
+}
+
+func makeCropMVT(t *testing.T, geometries ...orb.Geometry) *pkg.Image {
+	t.Helper()
+
+	l := &mvt.Layer{Name: "features", Version: 2, Extent: 4096}
+	for _, g := range geometries {
+		l.Features = append(l.Features, geojson.NewFeature(g))
+	}
+
+	img, err := encodeMVT(mvt.Layers{l}, false)
+	require.NoError(t, err)
+	return img
+}
+
+func Test_Crop_MaskValidate(t *testing.T) {
+	p, s, _ := makeCropProvidersImages()
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+
+	_, err := CropRegistration{}.Initialize(CropConfig{Mask: testCropMask, MaskFile: "mask.geojson", Primary: p, Secondary: s}, deps)
+	require.Error(t, err)
+
+	_, err = CropRegistration{}.Initialize(CropConfig{Mask: testCropMask, Bounds: pkg.Bounds{South: -10, North: 10, West: -10, East: 10}, Primary: p, Secondary: s}, deps)
+	require.Error(t, err)
+
+	_, err = CropRegistration{}.Initialize(CropConfig{Mask: map[string]interface{}{"type": "Point", "coordinates": []interface{}{1, 2}}, Primary: p, Secondary: s}, deps)
+	require.Error(t, err)
+
+	_, err = CropRegistration{}.Initialize(CropConfig{MaskFile: "test_files/missing.geojson", Primary: p, Secondary: s}, deps)
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "mask.geojson")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"FeatureCollection","features":[{"type":"Feature","properties":{},"geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,0]]]]}}]}`), 0600))
+
+	f, err := CropRegistration{}.Initialize(CropConfig{MaskFile: path, Primary: p, Secondary: s}, deps)
+	require.NoError(t, err)
+	assert.NotNil(t, f.(*Crop).mask)
+}
+
+func Test_Crop_MaskShortCircuits(t *testing.T) {
+	primary := &recordingProvider{img: &pkg.Image{Content: []byte("primary"), ContentType: mimePng}}
+	secondary := &recordingProvider{img: &pkg.Image{Content: []byte("secondary"), ContentType: mimePng}}
+	c := makeMaskedCrop(t, primary, secondary)
+
+	// Well inside the western hemisphere, away from the hole
+	img, err := c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 1, Y: 7})
+	require.NoError(t, err)
+	assert.Same(t, primary.img, img)
+
+	// Eastern hemisphere
+	img, err = c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 12, Y: 7})
+	require.NoError(t, err)
+	assert.Same(t, secondary.img, img)
+
+	// Inside the hole
+	img, err = c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 4, Y: 7})
+	require.NoError(t, err)
+	assert.Same(t, secondary.img, img)
+
+	assert.Len(t, primary.requested, 1)
+	assert.Len(t, secondary.requested, 2)
+}
+
+func Test_Crop_MaskRaster(t *testing.T) {
+	p, s := map[string]interface{}{"name": "static", "color": "F00"}, map[string]interface{}{"name": "static", "color": "00F"}
+	f, err := CropRegistration{}.Initialize(CropConfig{Mask: testCropMask, Primary: p, Secondary: s}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	img, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	require.Equal(t, 512, decoded.Bounds().Dx())
+
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	at := func(x, y int) color.Color { return color.NRGBAModel.Convert(decoded.At(x, y)) }
+
+	assert.Equal(t, red, at(20, 256))
+	assert.Equal(t, red, at(255, 256))
+	assert.Equal(t, blue, at(256, 256))
+	assert.Equal(t, blue, at(128, 256)) // The hole
+	assert.Equal(t, red, at(128, 100))
+	assert.Equal(t, blue, at(400, 100))
+}
+
+func Test_Crop_MaskVector(t *testing.T) {
+	square := orb.Polygon{{{0, 0}, {4096, 0}, {4096, 4096}, {0, 4096}, {0, 0}}}
+	line := orb.LineString{{0, 1000}, {4096, 1000}}
+
+	primary := &recordingProvider{img: makeCropMVT(t, square, line, orb.Point{1000, 1000}, orb.Point{3000, 1000})}
+	secondary := &recordingProvider{img: makeCropMVT(t, square)}
+	c := makeMaskedCrop(t, primary, secondary)
+
+	img, err := c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := decodeMVT(img)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+
+	features := layers[0].Features
+	require.Len(t, features, 4)
+
+	// The primary's square is cut down to the western half with the hole punched through it
+	polygon, ok := features[0].Geometry.(orb.Polygon)
+	require.True(t, ok)
+	require.Len(t, polygon, 2)
+	assert.InDelta(t, 0, polygon.Bound().Min.X(), 1)
+	assert.InDelta(t, 2048, polygon.Bound().Max.X(), 1)
+	assert.InDelta(t, 683, polygon[1].Bound().Min.X(), 1)
+	assert.InDelta(t, 1365, polygon[1].Bound().Max.X(), 1)
+	assert.Greater(t, planar.Area(polygon[0]), 0.0)
+	assert.Less(t, planar.Area(polygon[1]), 0.0)
+
+	// The line stops at the edge of the mask and the point outside is gone
+	lineOut, ok := features[1].Geometry.(orb.LineString)
+	require.True(t, ok)
+	assert.Equal(t, orb.LineString{{0, 1000}, {2048, 1000}}, lineOut)
+	assert.Equal(t, orb.Point{1000, 1000}, features[2].Geometry)
+
+	// The secondary's square fills the eastern half and the hole,
+	multi, ok := features[3].Geometry.(orb.MultiPolygon)
+	require.True(t, ok)
+	require.Len(t, multi, 2)
+	// along with the slivers above 85 and below -85 degrees
+	mercatorY := func(lat float64) float64 { return 2048 * math.Log(math.Tan(math.Pi/4+lat*math.Pi/360)) / math.Pi }
+	holeArea := 4096.0 / 6 * 2 * mercatorY(40)
+	sliversArea := 2 * 2048 * (2048 - mercatorY(85))
+	assert.InDelta(t, 4096*2048+holeArea+sliversArea, planar.Area(multi), 4096)
+}
+
+func Test_Crop_MaskMixedTypes(t *testing.T) {
+	primary := &recordingProvider{img: makeCropMVT(t, orb.Point{1, 1})}
+	secondary := &recordingProvider{img: &pkg.Image{Content: []byte("secondary"), ContentType: mimePng}}
+	c := makeMaskedCrop(t, primary, secondary)
+
+	_, err := c.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.Error(t, err)
+}
@@ -0,0 +1,265 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Michad/tilegroxy/internal/images"
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+const (
+	debugFormatPng = "png"
+	debugFormatMvt = "mvt"
+)
+
+var allDebugFormats = []string{debugFormatPng, debugFormatMvt}
+
+var allDebugDetails = []string{"layer", "quadkey", "4326", "3857", "time"}
+
+// Padding in pixels around the label and between it and the border
+const debugLabelPadding = 3
+
+// Height of the label text in pixels
+const debugFontSize = 12
+
+type DebugConfig struct {
+	Format string   // Whether to draw an image or emit vector tiles
+	Show   []string // Details to include beyond the tile coordinates
+	Size   int      // Width and height of images in pixels
+	Color  string   // Color of the border and label in images
+	Layer  string   // Name of the layer in vector tiles
+	Extent uint32   // Extent of the layer in vector tiles
+}
+
+type Debug struct {
+	DebugConfig
+	font  *opentype.Font
+	color color.NRGBA
+}
+
+func init() {
+	layer.RegisterProvider(DebugRegistration{})
+}
+
+type DebugRegistration struct {
+}
+
+func (s DebugRegistration) InitializeConfig() any {
+	return DebugConfig{}
+}
+
+func (s DebugRegistration) Name() string {
+	return "debug"
+}
+
+func (s DebugRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(DebugConfig)
+
+	if cfg.Format == "" {
+		cfg.Format = debugFormatPng
+	}
+
+	if !slices.Contains(allDebugFormats, cfg.Format) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.debug.format", cfg.Format, allDebugFormats)
+	}
+
+	for _, detail := range cfg.Show {
+		if !slices.Contains(allDebugDetails, detail) {
+			return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.debug.show", detail, allDebugDetails)
+		}
+	}
+
+	if cfg.Size == 0 {
+		cfg.Size = 256
+	}
+
+	if cfg.Size < 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.debug.size", cfg.Size)
+	}
+
+	if cfg.Color == "" {
+		cfg.Color = "F00"
+	}
+
+	col, err := images.ParseColor(cfg.Color)
+	if err != nil {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.debug.color", cfg.Color)
+	}
+
+	if cfg.Layer == "" {
+		cfg.Layer = "debug"
+	}
+
+	if cfg.Extent == 0 {
+		cfg.Extent = mvt.DefaultExtent
+	}
+
+	parsed, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Debug{DebugConfig: cfg, font: parsed, color: col}, nil
+}
+
+func (t Debug) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthBypass: true}, nil
+}
+
+func (t Debug) GenerateTile(_ context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	details, err := t.details(tileRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Format == debugFormatMvt {
+		return t.generateMVT(tileRequest, details)
+	}
+
+	return t.generateImage(tileRequest, details)
+}
+
+// debugDetail is a single fact about the tile, labeled for both the image and vector tile attributes
+type debugDetail struct {
+	key   string
+	label string
+	value string
+}
+
+// details gives the facts about the tile requested through Show, in the order configured
+func (t Debug) details(tileRequest pkg.TileRequest) ([]debugDetail, error) {
+	details := make([]debugDetail, 0, len(t.Show))
+
+	for _, detail := range t.Show {
+		switch detail {
+		case "layer":
+			details = append(details, debugDetail{"layer", "layer", tileRequest.LayerName})
+		case "quadkey":
+			details = append(details, debugDetail{"quadkey", "quadkey", quadkey(tileRequest)})
+		case "4326", "3857":
+			srid, _ := strconv.ParseUint(detail, 10, 0)
+			bounds, err := tileRequest.GetBoundsProjection(uint(srid))
+			if err != nil {
+				return nil, err
+			}
+
+			// Degrees need more decimals than meters to tell neighboring tiles apart at high zooms
+			precision := pkg.Ternary(srid == pkg.SRIDWGS84, 6, 1)
+			coords := make([]string, 4)
+			for i, v := range []float64{bounds.West, bounds.South, bounds.East, bounds.North} {
+				coords[i] = strconv.FormatFloat(v, 'f', precision, 64)
+			}
+
+			details = append(details, debugDetail{"bounds_" + detail, "EPSG:" + detail, strings.Join(coords, ",")})
+		case "time":
+			details = append(details, debugDetail{"time", "rendered", time.Now().UTC().Format(time.RFC3339)})
+		}
+	}
+
+	return details, nil
+}
+
+func (t Debug) generateImage(tileRequest pkg.TileRequest, details []debugDetail) (*pkg.Image, error) {
+	out := image.NewNRGBA(image.Rect(0, 0, t.Size, t.Size))
+	border := image.NewUniform(t.color)
+
+	// Neighboring tiles each draw their own edge so together they make a two pixel line
+	draw.Draw(out, image.Rect(0, 0, t.Size, 1), border, image.Point{}, draw.Src)
+	draw.Draw(out, image.Rect(0, t.Size-1, t.Size, t.Size), border, image.Point{}, draw.Src)
+	draw.Draw(out, image.Rect(0, 0, 1, t.Size), border, image.Point{}, draw.Src)
+	draw.Draw(out, image.Rect(t.Size-1, 0, t.Size, t.Size), border, image.Point{}, draw.Src)
+
+	lines := []string{strconv.Itoa(tileRequest.Z) + "/" + strconv.Itoa(tileRequest.X) + "/" + strconv.Itoa(tileRequest.Y)}
+	for _, detail := range details {
+		lines = append(lines, detail.label+": "+detail.value)
+	}
+
+	face, err := newTextFace(t.font, debugFontSize)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	label := drawText(face, t.color, strings.Join(lines, "\n"))
+
+	// A translucent backdrop keeps the label legible over busy imagery once it's blended
+	origin := image.Point{debugLabelPadding * 2, debugLabelPadding * 2}
+	backdrop := label.Rect.Add(origin).Inset(-debugLabelPadding)
+	draw.Draw(out, backdrop, image.NewUniform(color.NRGBA{255, 255, 255, 192}), image.Point{}, draw.Over)
+	draw.Draw(out, label.Rect.Add(origin), label, image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng}, nil
+}
+
+func (t Debug) generateMVT(tileRequest pkg.TileRequest, details []debugDetail) (*pkg.Image, error) {
+	extent := float64(t.Extent)
+
+	// Clockwise on screen, which is the exterior orientation in tile coordinates
+	outline := orb.Polygon{orb.Ring{{0, 0}, {extent, 0}, {extent, extent}, {0, extent}, {0, 0}}}
+
+	feature := geojson.NewFeature(outline)
+	feature.Properties["z"] = tileRequest.Z
+	feature.Properties["x"] = tileRequest.X
+	feature.Properties["y"] = tileRequest.Y
+	for _, detail := range details {
+		feature.Properties[detail.key] = detail.value
+	}
+
+	l := &mvt.Layer{Name: t.Layer, Version: 2, Extent: t.Extent, Features: []*geojson.Feature{feature}}
+
+	return encodeMVT(mvt.Layers{l}, false)
+}
+
+// quadkey gives the Bing Maps style key of the tile, one digit per zoom level
+func quadkey(tileRequest pkg.TileRequest) string {
+	var key strings.Builder
+
+	for z := tileRequest.Z; z > 0; z-- {
+		mask := 1 << (z - 1)
+		digit := '0'
+		if tileRequest.X&mask != 0 {
+			digit++
+		}
+		if tileRequest.Y&mask != 0 {
+			digit += 2
+		}
+		key.WriteRune(digit)
+	}
+
+	return key.String()
+}
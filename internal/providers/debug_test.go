@@ -0,0 +1,158 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeDebug(t *testing.T, cfg DebugConfig) *Debug {
+	t.Helper()
+
+	p, err := DebugRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	return p.(*Debug)
+}
+
+func Test_DebugValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := DebugRegistration{}.Initialize(DebugConfig{Format: "jpeg"}, deps)
+	require.Error(t, err)
+
+	_, err = DebugRegistration{}.Initialize(DebugConfig{Show: []string{"layer", "user"}}, deps)
+	require.Error(t, err)
+
+	_, err = DebugRegistration{}.Initialize(DebugConfig{Color: "red"}, deps)
+	require.Error(t, err)
+
+	_, err = DebugRegistration{}.Initialize(DebugConfig{Size: -1}, deps)
+	require.Error(t, err)
+
+	p, err := DebugRegistration{}.Initialize(DebugConfig{}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, "png", p.(*Debug).Format)
+	assert.Equal(t, 256, p.(*Debug).Size)
+	assert.Equal(t, "debug", p.(*Debug).Layer)
+
+	pc, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.True(t, pc.AuthBypass)
+}
+
+func Test_DebugQuadkey(t *testing.T) {
+	assert.Equal(t, "", quadkey(pkg.TileRequest{Z: 0, X: 0, Y: 0}))
+	assert.Equal(t, "213", quadkey(pkg.TileRequest{Z: 3, X: 3, Y: 5}))
+	assert.Equal(t, "1202102332221212", quadkey(pkg.TileRequest{Z: 16, X: 35210, Y: 21493}))
+}
+
+func Test_DebugImage(t *testing.T) {
+	d := makeDebug(t, DebugConfig{Show: []string{"layer", "quadkey", "4326", "3857", "time"}})
+
+	img, err := d.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 3, X: 3, Y: 5})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.False(t, img.ForceSkipCache)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), decoded.Bounds())
+
+	red := color.NRGBA{255, 0, 0, 255}
+	at := func(x, y int) color.NRGBA { return color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA) }
+
+	assert.Equal(t, red, at(128, 0))
+	assert.Equal(t, red, at(0, 255))
+	assert.Equal(t, red, at(255, 128))
+	assert.Equal(t, red, at(128, 255))
+	assert.Equal(t, color.NRGBA{}, at(128, 250))
+	assert.Equal(t, color.NRGBA{}, at(250, 250))
+
+	// The label sits in the top left over a light backdrop
+	assert.Equal(t, color.NRGBA{255, 255, 255, 192}, at(4, 4))
+
+	// Each line of text makes the label taller
+	plain := makeDebug(t, DebugConfig{})
+	img, err = plain.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 3, X: 3, Y: 5})
+	require.NoError(t, err)
+	short, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	labelHeight := func(img image.Image) int {
+		y := 3
+		for color.NRGBAModel.Convert(img.At(4, y)).(color.NRGBA).A != 0 {
+			y++
+		}
+		return y
+	}
+	assert.Greater(t, labelHeight(decoded), labelHeight(short)*3)
+}
+
+// Tiles are drawn at the same time for different requests, which mustn't share a font face
+func Test_DebugImageConcurrent(t *testing.T) {
+	d := makeDebug(t, DebugConfig{Show: []string{"quadkey"}})
+
+	var wg sync.WaitGroup
+	for x := range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			img, err := d.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 5, X: x, Y: 5})
+			assert.NoError(t, err)
+			assert.NotNil(t, img)
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_DebugMVT(t *testing.T) {
+	d := makeDebug(t, DebugConfig{Format: "mvt", Layer: "grid", Extent: 256, Show: []string{"layer", "quadkey", "4326", "3857", "time"}})
+
+	img, err := d.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := decodeMVT(img)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, "grid", layers[0].Name)
+	assert.Equal(t, uint32(256), layers[0].Extent)
+	require.Len(t, layers[0].Features, 1)
+
+	f := layers[0].Features[0]
+	assert.Equal(t, orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{256, 256}}, f.Geometry.Bound())
+	assert.InDelta(t, 1.0, f.Properties["z"], 0)
+	assert.InDelta(t, 1.0, f.Properties["x"], 0)
+	assert.InDelta(t, 0.0, f.Properties["y"], 0)
+	assert.Equal(t, "l", f.Properties["layer"])
+	assert.Equal(t, "1", f.Properties["quadkey"])
+	assert.Equal(t, "0.000000,0.000000,180.000000,85.051129", f.Properties["bounds_4326"])
+	assert.Equal(t, "0.0,0.0,20037508.3,20037508.3", f.Properties["bounds_3857"])
+	assert.Contains(t, f.Properties, "time")
+}
@@ -0,0 +1,231 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/maypok86/otter"
+	"golang.org/x/sync/singleflight"
+)
+
+// How elevation is packed into the colors of DEM imagery
+const (
+	elevationTerrainRGB = "terrainrgb"
+	elevationTerrarium  = "terrarium"
+)
+
+var allElevationEncodings = []string{elevationTerrainRGB, elevationTerrarium}
+
+// How many elevation tiles are kept, and for how long, for the tiles around them. The tiles of a
+// viewport are requested at nearly the same time, so they don't need to be kept long
+const (
+	elevationCacheSize = 128
+	elevationCacheTTL  = 30 * time.Second
+)
+
+// elevationCache keeps the elevation tiles fetched by a provider for a short while. Each tile is
+// also fetched as a neighbor of the eight tiles around it, so without this every elevation tile
+// would be fetched about nine times across a viewport. Concurrent fetches of a tile are shared
+type elevationCache struct {
+	recent otter.Cache[pkg.TileRequest, *pkg.Image]
+	flight *singleflight.Group
+	// Tiles are kept apart by the layer's cache variant, for providers that give different tiles
+	// by request
+	variant func(ctx context.Context) string
+}
+
+func newElevationCache(deps layer.ProviderDeps) (*elevationCache, error) {
+	recent, err := otter.MustBuilder[pkg.TileRequest, *pkg.Image](elevationCacheSize).
+		WithTTL(elevationCacheTTL).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &elevationCache{recent, &singleflight.Group{}, deps.CacheVariant}, nil
+}
+
+// fetch gets a tile from the provider unless it was fetched recently. Tiles that shouldn't be
+// cached aren't kept
+func (c *elevationCache) fetch(ctx context.Context, provider layer.Provider, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	key := tileRequest
+	key.Variant = c.variant(ctx)
+
+	if img, ok := c.recent.Get(key); ok {
+		return img, nil
+	}
+
+	// Detached so a client disconnecting doesn't fail the tile for every other request waiting on it
+	detached := context.WithoutCancel(ctx)
+	resultChan := c.flight.DoChan(key.String(), func() (any, error) {
+		img, err := provider.GenerateTile(detached, providerContext, tileRequest)
+		if err == nil && img != nil && !img.ForceSkipCache {
+			c.recent.Set(key, img)
+		}
+
+		return img, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-resultChan:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.(*pkg.Image), nil
+	}
+}
+
+// elevationTiles holds the elevation of every pixel of a tile and the eight tiles around it, so
+// that calculations needing the pixels around each pixel are seamless across tile edges
+type elevationTiles struct {
+	// Ordered row by row from the top left so the requested tile is in the middle. Neighbors past
+	// the poles, that failed or that don't match the size of the requested tile are nil
+	tiles          [9][]float64
+	size           int
+	forceSkipCache bool
+}
+
+// fetchElevation gets and decodes the requested tile along with its neighbors, through the cache of
+// recent tiles. It returns nil without an error if the provider has no tile
+func fetchElevation(ctx context.Context, provider layer.Provider, cache *elevationCache, providerContext layer.ProviderContext, tileRequest pkg.TileRequest, encoding string) (*elevationTiles, error) {
+	var imgs [9]*pkg.Image
+	var errs [9]error
+	count := 1 << tileRequest.Z
+
+	var wg sync.WaitGroup
+	for i := range imgs {
+		y := tileRequest.Y + i/3 - 1
+		if y < 0 || y >= count {
+			continue
+		}
+
+		// Wrap across the antimeridian
+		x := (tileRequest.X + i%3 - 1 + count) % count
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imgs[i], errs[i] = cache.fetch(ctx, provider, providerContext, pkg.TileRequest{LayerName: tileRequest.LayerName, Z: tileRequest.Z, X: x, Y: y})
+		}()
+	}
+	wg.Wait()
+
+	center := imgs[4]
+	if errs[4] != nil || center == nil {
+		return nil, errs[4]
+	}
+
+	if isMVT(center) {
+		return nil, fmt.Errorf("elevation must be imagery but got %v", center.ContentType)
+	}
+
+	result := &elevationTiles{forceSkipCache: center.ForceSkipCache}
+
+	// The center goes first so the neighbors can be checked against its size
+	for _, i := range []int{4, 0, 1, 2, 3, 5, 6, 7, 8} {
+		if errs[i] != nil {
+			slog.DebugContext(ctx, fmt.Sprintf("Ignoring neighbor of %v that failed: %v", tileRequest, errs[i]))
+			continue
+		}
+
+		if imgs[i] == nil {
+			continue
+		}
+
+		decoded, _, err := image.Decode(bytes.NewReader(imgs[i].Content))
+		if err != nil {
+			if i == 4 {
+				return nil, err
+			}
+
+			slog.DebugContext(ctx, fmt.Sprintf("Ignoring neighbor of %v that can't be decoded: %v", tileRequest, err))
+			continue
+		}
+
+		size := decoded.Bounds().Size()
+		if i == 4 {
+			if size.X != size.Y {
+				return nil, fmt.Errorf("elevation tiles must be square but got %v", size)
+			}
+			result.size = size.X
+		} else if size.X != result.size || size.Y != result.size {
+			continue
+		}
+
+		result.tiles[i] = decodeElevation(decoded, encoding)
+	}
+
+	return result, nil
+}
+
+// at reads the elevation of a pixel of the requested tile by its position, reaching into the
+// neighbors for positions up to a tile beyond the edge. Missing neighbors repeat the nearest pixel
+// of the requested tile
+func (e *elevationTiles) at(x, y int) float64 {
+	size := e.size
+
+	col, row := 1, 1
+	if x < 0 {
+		col, x = 0, x+size
+	} else if x >= size {
+		col, x = 2, x-size
+	}
+	if y < 0 {
+		row, y = 0, y+size
+	} else if y >= size {
+		row, y = 2, y-size
+	}
+
+	if tile := e.tiles[row*3+col]; tile != nil {
+		return tile[y*size+x]
+	}
+
+	x = pkg.Ternary(col == 0, 0, pkg.Ternary(col == 2, size-1, x))
+	y = pkg.Ternary(row == 0, 0, pkg.Ternary(row == 2, size-1, y))
+	return e.tiles[4][y*size+x]
+}
+
+// decodeElevation unpacks the elevation in meters of each pixel, row by row
+func decodeElevation(img image.Image, encoding string) []float64 {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+
+	elevations := make([]float64, bounds.Dx()*bounds.Dy())
+	for i := range elevations {
+		r, g, b := float64(nrgba.Pix[i*4]), float64(nrgba.Pix[i*4+1]), float64(nrgba.Pix[i*4+2])
+
+		if encoding == elevationTerrarium {
+			elevations[i] = r*256 + g + b/256 - 32768
+		} else {
+			elevations[i] = -10000 + (r*65536+g*256+b)*0.1
+		}
+	}
+
+	return elevations
+}
@@ -0,0 +1,221 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/gen2brain/webp"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	formatPng  = "png"
+	formatPng8 = "png8"
+	formatJpeg = "jpeg"
+	formatWebp = "webp"
+)
+
+var allFormats = []string{formatPng, formatPng8, formatJpeg, formatWebp}
+
+var formatContentTypes = map[string]string{
+	formatPng:  mimePng,
+	formatPng8: mimePng,
+	formatJpeg: mimeJpeg,
+	formatWebp: mimeWebp,
+}
+
+const (
+	formatDefaultJpegQuality = 85
+	formatDefaultWebpQuality = 80
+	formatMaxColors          = 256
+)
+
+type FormatConfig struct {
+	Format    string
+	Quality   int      // For jpeg and lossy webp
+	Lossless  bool     // For webp
+	Colors    int      // For png8
+	Dither    bool     // For png8
+	Negotiate []string // Formats to pick from by the Accept header, in order of preference
+	Provider  map[string]interface{}
+}
+
+type Format struct {
+	FormatConfig
+	provider layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(FormatRegistration{})
+}
+
+type FormatRegistration struct {
+}
+
+func (s FormatRegistration) InitializeConfig() any {
+	return FormatConfig{}
+}
+
+func (s FormatRegistration) Name() string {
+	return "format"
+}
+
+func (s FormatRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(FormatConfig)
+
+	if cfg.Format == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.format.format")
+	}
+
+	if !slices.Contains(allFormats, cfg.Format) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.format.format", cfg.Format, allFormats)
+	}
+
+	for i, f := range cfg.Negotiate {
+		if !slices.Contains(allFormats, f) {
+			return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.format.negotiate["+strconv.Itoa(i)+"]", f, allFormats)
+		}
+	}
+
+	if cfg.Quality != 0 && (cfg.Quality < 1 || cfg.Quality > 100) {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.format.quality", 1, 100)
+	}
+
+	if cfg.Colors == 0 {
+		cfg.Colors = formatMaxColors
+	}
+
+	if cfg.Colors < 2 || cfg.Colors > formatMaxColors {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.format.colors", 2, formatMaxColors)
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Negotiate) > 0 {
+		deps.VaryCache(func(ctx context.Context) string {
+			return negotiateFormat(ctx, cfg.Negotiate, cfg.Format)
+		}, "Accept")
+	}
+
+	return &Format{cfg, provider}, nil
+}
+
+func (t Format) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Format holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Format) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Format) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	img, err := t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil || img == nil || isMVT(img) {
+		return img, err
+	}
+
+	format := t.Format
+	if len(t.Negotiate) > 0 {
+		format = negotiateFormat(ctx, t.Negotiate, t.Format)
+		slog.DebugContext(ctx, "Negotiated format "+format)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	switch format {
+	case formatPng:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, decoded)
+	case formatPng8:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, quantizeImage(decoded, t.Colors, t.Dither))
+	case formatJpeg:
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: pkg.Ternary(t.Quality == 0, formatDefaultJpegQuality, t.Quality)})
+	case formatWebp:
+		err = webp.Encode(&buf, toNRGBA(decoded), webp.Options{Lossless: t.Lossless, Quality: pkg.Ternary(t.Quality == 0, formatDefaultWebpQuality, t.Quality), Method: webp.DefaultMethod})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: formatContentTypes[format], ForceSkipCache: img.ForceSkipCache}, nil
+}
+
+// toNRGBA copies the image into one starting at the origin. The webp encoder reads the pixels of an
+// RGBA image as they're stored, so they have to be unpremultiplied and without any offset first
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+
+	return nrgba
+}
+
+// negotiateFormat returns the first of the formats whose content type the request explicitly
+// accepts. Wildcards are ignored since browsers send */* for formats they can't display
+func negotiateFormat(ctx context.Context, formats []string, fallback string) string {
+	req, ok := pkg.ReqFromContext(ctx)
+	if !ok {
+		return fallback
+	}
+
+	accepted := make(map[string]bool)
+
+	for _, header := range req.Header.Values("Accept") {
+		for _, entry := range strings.Split(header, ",") {
+			params := strings.Split(entry, ";")
+			mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+			accepted[mediaType] = true
+
+			for _, param := range params[1:] {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if q, err := strconv.ParseFloat(val, 64); strings.TrimSpace(key) == "q" && err == nil && q <= 0 {
+					accepted[mediaType] = false
+				}
+			}
+		}
+	}
+
+	for _, f := range formats {
+		if accepted[formatContentTypes[f]] {
+			return f
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,215 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+func makeFormat(t *testing.T, cfg FormatConfig, img *pkg.Image) *Format {
+	t.Helper()
+
+	cfg.Provider = map[string]interface{}{"name": "static", "color": "F00"}
+	p, err := FormatRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	f := p.(*Format)
+	f.provider = &recordingProvider{img: img}
+	return f
+}
+
+// makeNoisyImage gives an image with far more than 256 colors, some of them translucent, that PNG
+// can't compress well
+func makeNoisyImage(t *testing.T) *pkg.Image {
+	t.Helper()
+
+	r := rand.New(rand.NewSource(1)) // #nosec G404 -- deterministic test data
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := range 256 {
+		for x := range 256 {
+			noise := uint8(r.Intn(24))
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x) ^ noise, uint8(y) ^ noise, 100 + noise, pkg.Ternary(y < 32, uint8(128), uint8(255))})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng}
+}
+
+func Test_FormatValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := FormatRegistration{}.Initialize(FormatConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = FormatRegistration{}.Initialize(FormatConfig{Format: "gif", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = FormatRegistration{}.Initialize(FormatConfig{Format: "webp", Negotiate: []string{"avif"}, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = FormatRegistration{}.Initialize(FormatConfig{Format: "jpeg", Quality: 101, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = FormatRegistration{}.Initialize(FormatConfig{Format: "png8", Colors: 1, Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := FormatRegistration{}.Initialize(FormatConfig{Format: "png8", Provider: s}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, 256, p.(*Format).Colors)
+}
+
+func Test_FormatWebp(t *testing.T) {
+	src := makeNoisyImage(t)
+	original, err := png.Decode(bytes.NewReader(src.Content))
+	require.NoError(t, err)
+
+	encode := func(cfg FormatConfig) (*pkg.Image, image.Image) {
+		t.Helper()
+
+		img, err := makeFormat(t, cfg, src).GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+		require.NoError(t, err)
+		assert.Equal(t, mimeWebp, img.ContentType)
+		assert.False(t, img.ForceSkipCache)
+
+		decoded, err := webp.Decode(bytes.NewReader(img.Content))
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 256, 256), decoded.Bounds())
+
+		return img, decoded
+	}
+
+	lossless, decoded := encode(FormatConfig{Format: "webp", Lossless: true})
+
+	// Translucent pixels included
+	for _, pt := range []image.Point{{10, 10}, {200, 20}, {100, 200}} {
+		assert.Equal(t, color.NRGBAModel.Convert(original.At(pt.X, pt.Y)), color.NRGBAModel.Convert(decoded.At(pt.X, pt.Y)), pt)
+	}
+
+	lossy, decoded := encode(FormatConfig{Format: "webp"})
+	_, _, _, a := decoded.At(10, 10).RGBA()
+	assert.InDelta(t, 128*0x101, a, 4*0x101)
+	assert.Less(t, len(lossy.Content), len(lossless.Content))
+
+	low, _ := encode(FormatConfig{Format: "webp", Quality: 20})
+	assert.Less(t, len(low.Content), len(lossy.Content))
+}
+
+func Test_FormatJpeg(t *testing.T) {
+	src := makeQuadrantImage(t)
+	src.ForceSkipCache = true
+
+	f := makeFormat(t, FormatConfig{Format: "jpeg", Quality: 50}, src)
+
+	img, err := f.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimeJpeg, img.ContentType)
+	assert.True(t, img.ForceSkipCache)
+
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	r, g, b, _ := decoded.At(200, 200).RGBA()
+	assert.InDelta(t, 255, r>>8, 3)
+	assert.InDelta(t, 255, g>>8, 3)
+	assert.InDelta(t, 0, b>>8, 3)
+}
+
+func Test_FormatPng8(t *testing.T) {
+	src := makeNoisyImage(t)
+
+	for _, dither := range []bool{false, true} {
+		f := makeFormat(t, FormatConfig{Format: "png8", Colors: 16, Dither: dither}, src)
+
+		img, err := f.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+		require.NoError(t, err)
+		assert.Equal(t, mimePng, img.ContentType)
+		assert.Less(t, len(img.Content), len(src.Content))
+
+		decoded, err := png.Decode(bytes.NewReader(img.Content))
+		require.NoError(t, err)
+
+		paletted, ok := decoded.(*image.Paletted)
+		require.True(t, ok)
+		assert.LessOrEqual(t, len(paletted.Palette), 16)
+	}
+}
+
+func Test_FormatPng8KeepsFewColorsExact(t *testing.T) {
+	f := makeFormat(t, FormatConfig{Format: "png8"}, makeQuadrantImage(t))
+
+	img, err := f.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	assert.Len(t, decoded.(*image.Paletted).Palette, 4)
+	for i, c := range metatileColors {
+		r1, g1, b1, a1 := decoded.At((i%2)*128+5, (i/2)*128+5).RGBA()
+		r2, g2, b2, a2 := c.RGBA()
+		assert.Equal(t, [4]uint32{r2, g2, b2, a2}, [4]uint32{r1, g1, b1, a1})
+	}
+}
+
+func Test_FormatNegotiate(t *testing.T) {
+	f := makeFormat(t, FormatConfig{Format: "png8", Negotiate: []string{"webp", "jpeg"}}, makeQuadrantImage(t))
+
+	for accept, expected := range map[string]string{
+		"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8": mimeWebp,
+		"image/jpeg, image/webp;q=0":                                       mimeJpeg,
+		"image/png,image/*;q=0.8,*/*;q=0.5":                                mimePng,
+		"":                                                                 mimePng,
+	} {
+		req := httptest.NewRequest("GET", "/tiles/l/1/0/0", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		img, err := f.GenerateTile(pkg.NewRequestContext(req), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+		require.NoError(t, err)
+		assert.Equal(t, expected, img.ContentType, accept)
+		assert.False(t, img.ForceSkipCache)
+	}
+
+	img, err := f.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+}
+
+func Test_FormatPassesThroughMVT(t *testing.T) {
+	src := &pkg.Image{Content: []byte{0x1a, 0x00}, ContentType: mvtContentType}
+	f := makeFormat(t, FormatConfig{Format: "webp"}, src)
+
+	img, err := f.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Same(t, src, img)
+}
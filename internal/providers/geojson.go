@@ -0,0 +1,374 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/fsnotify/fsnotify"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+)
+
+// fsnotify can send events before a file has finished writing, so reloads wait this long for it to
+// settle. Events within this long of the last reload are treated as duplicates
+const geojsonReloadDelay = time.Second
+
+type GeoJSONFile struct {
+	File       string
+	Layer      string   // Name of the layer in the vector tile, defaults to the file name without extension
+	Properties []string // Properties to include, all are included when empty
+}
+
+type GeoJSONConfig struct {
+	Files    []GeoJSONFile
+	Extent   uint32
+	Buffer   uint32
+	Simplify *float64
+}
+
+type GeoJSON struct {
+	GeoJSONConfig
+	tolerance float64
+
+	dataMutex sync.RWMutex
+	data      []*geojsonData
+
+	reloadDelay time.Duration
+	watcher     *fsnotify.Watcher
+	// Closed by Close to cut short reloads waiting for a file to settle
+	closing   chan struct{}
+	closeOnce sync.Once
+	// The event loop and any reloads in progress, which Close waits for
+	background sync.WaitGroup
+}
+
+// geojsonData is the contents of one file, ready for lookups by tile
+type geojsonData struct {
+	features []*geojson.Feature
+	index    *spatialIndex
+}
+
+func init() {
+	layer.RegisterProvider(GeoJSONRegistration{})
+}
+
+type GeoJSONRegistration struct {
+}
+
+func (s GeoJSONRegistration) InitializeConfig() any {
+	return GeoJSONConfig{}
+}
+
+func (s GeoJSONRegistration) Name() string {
+	return "geojson"
+}
+
+func (s GeoJSONRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	t, err := newGeoJSON(cfgAny.(GeoJSONConfig), deps, geojsonReloadDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func newGeoJSON(cfg GeoJSONConfig, deps layer.ProviderDeps, reloadDelay time.Duration) (*GeoJSON, error) {
+
+	if len(cfg.Files) == 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.geojson.files")
+	}
+
+	if cfg.Extent == 0 {
+		cfg.Extent = mvt.DefaultExtent
+	}
+
+	if cfg.Buffer == 0 {
+		cfg.Buffer = 64
+	}
+
+	tolerance := 1.0
+	if cfg.Simplify != nil {
+		if *cfg.Simplify < 0 {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.geojson.simplify", *cfg.Simplify)
+		}
+		tolerance = *cfg.Simplify
+	}
+
+	for i := range cfg.Files {
+		if cfg.Files[i].File == "" {
+			return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.geojson.files["+strconv.Itoa(i)+"].file")
+		}
+
+		if cfg.Files[i].Layer == "" {
+			base := filepath.Base(cfg.Files[i].File)
+			cfg.Files[i].Layer = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+
+	t := &GeoJSON{GeoJSONConfig: cfg, tolerance: tolerance, data: make([]*geojsonData, len(cfg.Files)), reloadDelay: reloadDelay, closing: make(chan struct{})}
+
+	for i := range cfg.Files {
+		data, err := loadGeoJSON(cfg.Files[i])
+		if err != nil {
+			return nil, err
+		}
+
+		t.data[i] = data
+	}
+
+	err := t.watch()
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func loadGeoJSON(file GeoJSONFile) (*geojsonData, error) {
+	content, err := os.ReadFile(file.File)
+	if err != nil {
+		return nil, err
+	}
+
+	fc, err := geojson.UnmarshalFeatureCollection(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", file.File, err)
+	}
+
+	features := make([]*geojson.Feature, 0, len(fc.Features))
+	bounds := make([]orb.Bound, 0, len(fc.Features))
+
+	for _, f := range fc.Features {
+		if f.Geometry == nil {
+			continue
+		}
+
+		properties := make(geojson.Properties, len(f.Properties))
+		for key, val := range f.Properties {
+			if len(file.Properties) > 0 && !slices.Contains(file.Properties, key) {
+				continue
+			}
+
+			if val, ok := geojsonPropertyValue(val); ok {
+				properties[key] = val
+			}
+		}
+
+		f.Properties = properties
+		features = append(features, f)
+		bounds = append(bounds, f.Geometry.Bound())
+	}
+
+	return &geojsonData{features: features, index: newSpatialIndex(bounds)}, nil
+}
+
+// geojsonPropertyValue converts a property into something a vector tile can hold. Vector tiles
+// have no nested values, so objects and arrays are kept as their JSON text
+func geojsonPropertyValue(val any) (any, bool) {
+	switch val.(type) {
+	case nil:
+		return nil, false
+	case string, float64, bool:
+		return val, true
+	default:
+		text, err := json.Marshal(val)
+		if err != nil {
+			return nil, false
+		}
+
+		return string(text), true
+	}
+}
+
+// watch reloads a file whenever it changes. The directories are watched rather than the files so
+// that editors and deployments that replace a file, rather than writing to it, are picked up
+func (t *GeoJSON) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, f := range t.Files {
+		dir := filepath.Dir(filepath.Clean(f.File))
+		if !dirs[dir] {
+			dirs[dir] = true
+
+			err = watcher.Add(dir)
+			if err != nil {
+				watcher.Close()
+				return err
+			}
+		}
+	}
+
+	t.watcher = watcher
+
+	t.background.Add(1)
+	go t.handleEvents(watcher)
+
+	return nil
+}
+
+func (t *GeoJSON) handleEvents(watcher *fsnotify.Watcher) {
+	defer t.background.Done()
+
+	lastReload := make([]time.Time, len(t.Files))
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+
+			for i, f := range t.Files {
+				if filepath.Clean(event.Name) != filepath.Clean(f.File) || time.Since(lastReload[i]) < t.reloadDelay {
+					continue
+				}
+
+				lastReload[i] = time.Now()
+
+				// Reload in a separate goroutine so the delay doesn't hold up the dedupe check above
+				t.background.Add(1)
+				go func() {
+					defer t.background.Done()
+					t.reload(i)
+				}()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			slog.Warn(fmt.Sprintf("Error watching GeoJSON files: %v", err))
+		}
+	}
+}
+
+func (t *GeoJSON) reload(i int) {
+	select {
+	case <-time.After(t.reloadDelay):
+	case <-t.closing:
+		return
+	}
+
+	data, err := loadGeoJSON(t.Files[i])
+	if err != nil {
+		// Keep serving what was there before rather than failing every tile over a bad edit
+		slog.Error(fmt.Sprintf("Unable to reload %v: %v", t.Files[i].File, err))
+		return
+	}
+
+	t.dataMutex.Lock()
+	t.data[i] = data
+	t.dataMutex.Unlock()
+
+	slog.Info(fmt.Sprintf("Reloaded %v with %v features", t.Files[i].File, len(data.features)))
+}
+
+// Close stops watching the files for changes, waiting for any reload in progress to finish
+func (t *GeoJSON) Close(_ context.Context) error {
+	if t.watcher == nil {
+		return nil
+	}
+
+	err := t.watcher.Close()
+	t.closeOnce.Do(func() { close(t.closing) })
+	t.background.Wait()
+
+	return err
+}
+
+func (t *GeoJSON) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthBypass: true}, nil
+}
+
+func (t *GeoJSON) GenerateTile(ctx context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	bounds, err := tileRequest.GetBounds()
+	if err != nil {
+		return nil, err
+	}
+
+	// Look for features in the area covered by the buffer as well as the tile itself
+	bufferRatio := float64(t.Buffer) / float64(t.Extent)
+	search := orb.Bound{
+		Min: orb.Point{bounds.West - bounds.Width()*bufferRatio, bounds.South - bounds.Height()*bufferRatio},
+		Max: orb.Point{bounds.East + bounds.Width()*bufferRatio, bounds.North + bounds.Height()*bufferRatio},
+	}
+
+	tile := maptile.New(uint32(tileRequest.X), uint32(tileRequest.Y), maptile.Zoom(tileRequest.Z))
+	buffer := float64(t.Buffer)
+	clip := orb.Bound{Min: orb.Point{-buffer, -buffer}, Max: orb.Point{float64(t.Extent) + buffer, float64(t.Extent) + buffer}}
+
+	t.dataMutex.RLock()
+	data := append([]*geojsonData{}, t.data...)
+	t.dataMutex.RUnlock()
+
+	layers := make(mvt.Layers, 0, len(data))
+
+	for i, d := range data {
+		matches := d.index.search(search)
+		if len(matches) == 0 {
+			continue
+		}
+
+		features := make([]*geojson.Feature, 0, len(matches))
+		for _, m := range matches {
+			f := d.features[m]
+			features = append(features, &geojson.Feature{ID: f.ID, Geometry: orb.Clone(f.Geometry), Properties: f.Properties})
+		}
+
+		l := &mvt.Layer{Name: t.Files[i].Layer, Version: 2, Extent: t.Extent, Features: features}
+		l.ProjectToTile(tile)
+		l.Clip(clip)
+
+		if t.tolerance > 0 {
+			l.Simplify(simplify.DouglasPeucker(t.tolerance))
+		}
+
+		// Snap to the integer grid of the tile, dropping whatever collapses to nothing along the way
+		transformMVTLayer(l, func(p orb.Point) orb.Point { return p })
+		l.RemoveEmpty(1, 1)
+
+		if len(l.Features) > 0 {
+			layers = append(layers, l)
+		}
+	}
+
+	slog.DebugContext(ctx, fmt.Sprintf("Found features in %v of %v GeoJSON files", len(layers), len(data)))
+
+	return encodeMVT(layers, false)
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFacilities = `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"name": "North", "capacity": 40, "tags": ["a", "b"], "secret": "x"}, "geometry": {"type": "Point", "coordinates": [10.5, 50.5]}},
+	{"type": "Feature", "properties": {"name": "South", "capacity": 12, "secret": "y"}, "geometry": {"type": "Point", "coordinates": [-60.5, -30.5]}}
+]}`
+
+const testRegions = `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"region": "east"}, "geometry": {"type": "Polygon", "coordinates": [[[-10, 0], [90, 0], [90, 60], [-10, 60], [-10, 0]]]}}
+]}`
+
+func writeGeoJSON(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	return file
+}
+
+func Test_SpatialIndexMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	bounds := make([]orb.Bound, 1000)
+	for i := range bounds {
+		x, y := r.Float64()*360-180, r.Float64()*170-85
+		bounds[i] = orb.Bound{Min: orb.Point{x, y}, Max: orb.Point{x + r.Float64()*5, y + r.Float64()*5}}
+	}
+
+	idx := newSpatialIndex(bounds)
+
+	for range 50 {
+		x, y := r.Float64()*360-180, r.Float64()*170-85
+		search := orb.Bound{Min: orb.Point{x, y}, Max: orb.Point{x + 20, y + 10}}
+
+		expected := make([]int, 0)
+		for i, b := range bounds {
+			if b.Intersects(search) {
+				expected = append(expected, i)
+			}
+		}
+
+		assert.Equal(t, expected, idx.search(search))
+	}
+
+	assert.Empty(t, newSpatialIndex(nil).search(orb.Bound{Max: orb.Point{1, 1}}))
+}
+
+func Test_GeoJSONValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+
+	_, err := GeoJSONRegistration{}.Initialize(GeoJSONConfig{}, deps)
+	require.Error(t, err)
+
+	_, err = GeoJSONRegistration{}.Initialize(GeoJSONConfig{Files: []GeoJSONFile{{File: filepath.Join(t.TempDir(), "missing.geojson")}}}, deps)
+	require.Error(t, err)
+
+	file := writeGeoJSON(t, t.TempDir(), "bad.geojson", `{"type": "FeatureCollection", "features": [`)
+	_, err = GeoJSONRegistration{}.Initialize(GeoJSONConfig{Files: []GeoJSONFile{{File: file}}}, deps)
+	require.Error(t, err)
+}
+
+func Test_GeoJSONGeneratesTile(t *testing.T) {
+	dir := t.TempDir()
+	facilities := writeGeoJSON(t, dir, "facilities.geojson", testFacilities)
+	regions := writeGeoJSON(t, dir, "regions.json", testRegions)
+
+	p, err := GeoJSONRegistration{}.Initialize(GeoJSONConfig{Files: []GeoJSONFile{
+		{File: facilities, Properties: []string{"name", "capacity", "tags"}},
+		{File: regions, Layer: "sales"},
+	}}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer p.(*GeoJSON).Close(context.Background())
+
+	pc, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.True(t, pc.AuthBypass)
+
+	// The tile containing the northern facility, inside the region
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 8, Y: 5})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+
+	assert.Equal(t, "facilities", layers[0].Name)
+	require.Len(t, layers[0].Features, 1)
+	f := layers[0].Features[0]
+	assert.Equal(t, "North", f.Properties["name"])
+	assert.InDelta(t, 40, f.Properties["capacity"], 0)
+	assert.Equal(t, `["a","b"]`, f.Properties["tags"])
+	assert.NotContains(t, f.Properties, "secret")
+
+	point := f.Geometry.(orb.Point)
+	assert.Equal(t, point, orb.Point{math.Round(point[0]), math.Round(point[1])})
+	assert.True(t, point[0] >= 0 && point[0] <= 4096 && point[1] >= 0 && point[1] <= 4096)
+
+	// The region covers the whole tile, so it's clipped down to the tile and buffer
+	assert.Equal(t, "sales", layers[1].Name)
+	require.Len(t, layers[1].Features, 1)
+	assert.Equal(t, orb.Bound{Min: orb.Point{-64, -64}, Max: orb.Point{4160, 4160}}, layers[1].Features[0].Geometry.Bound())
+
+	// Nowhere near anything
+	img, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 1, Y: 1})
+	require.NoError(t, err)
+	assert.Empty(t, img.Content)
+}
+
+func Test_GeoJSONReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	file := writeGeoJSON(t, dir, "facilities.geojson", testFacilities)
+
+	p, err := newGeoJSON(GeoJSONConfig{Files: []GeoJSONFile{{File: file}}}, layer.ProviderDeps{ErrorMessages: testErrMessages}, 50*time.Millisecond)
+	require.NoError(t, err)
+	defer p.Close(context.Background())
+
+	tile := pkg.TileRequest{LayerName: "l", Z: 4, X: 1, Y: 3}
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+	require.NoError(t, err)
+	assert.Empty(t, img.Content)
+
+	writeGeoJSON(t, dir, "facilities.geojson", `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "Arctic"}, "geometry": {"type": "Point", "coordinates": [-140, 70]}}
+	]}`)
+
+	require.Eventually(t, func() bool {
+		img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		return err == nil && len(img.Content) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// A broken file leaves the last good contents in place
+	writeGeoJSON(t, dir, "facilities.geojson", `{"type": `)
+	time.Sleep(200 * time.Millisecond)
+
+	img, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+	require.NoError(t, err)
+	assert.NotEmpty(t, img.Content)
+}
@@ -0,0 +1,205 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"slices"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/anthonynsimon/bild/parallel"
+)
+
+const (
+	hillshadeGrayscale = "grayscale"
+	hillshadeAlpha     = "alpha"
+)
+
+var allHillshadeOutputs = []string{hillshadeGrayscale, hillshadeAlpha}
+
+// Circumference of the earth at the equator in EPSG:3857 meters
+const mercatorCircumference = 2 * math.Pi * 6378137
+
+type HillshadeConfig struct {
+	Encoding string   // How elevation is packed into the pixels of the child's tiles
+	Azimuth  *float64 // Direction of the light in degrees clockwise from north
+	Altitude *float64 // Angle of the light in degrees above the horizon
+	ZFactor  float64  // Vertical exaggeration
+	Output   string
+	Provider map[string]interface{}
+}
+
+type Hillshade struct {
+	HillshadeConfig
+	provider  layer.Provider
+	elevation *elevationCache
+}
+
+func init() {
+	layer.RegisterProvider(HillshadeRegistration{})
+}
+
+type HillshadeRegistration struct {
+}
+
+func (s HillshadeRegistration) InitializeConfig() any {
+	return HillshadeConfig{}
+}
+
+func (s HillshadeRegistration) Name() string {
+	return "hillshade"
+}
+
+func (s HillshadeRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(HillshadeConfig)
+
+	if cfg.Encoding == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.hillshade.encoding")
+	}
+
+	if !slices.Contains(allElevationEncodings, cfg.Encoding) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.hillshade.encoding", cfg.Encoding, allElevationEncodings)
+	}
+
+	if cfg.Azimuth == nil {
+		azimuth := 315.0
+		cfg.Azimuth = &azimuth
+	}
+
+	if *cfg.Azimuth < 0 || *cfg.Azimuth > 360 {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.hillshade.azimuth", 0, 360)
+	}
+
+	if cfg.Altitude == nil {
+		altitude := 45.0
+		cfg.Altitude = &altitude
+	}
+
+	if *cfg.Altitude < 0 || *cfg.Altitude > 90 {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.hillshade.altitude", 0, 90)
+	}
+
+	if cfg.ZFactor == 0 {
+		cfg.ZFactor = 1
+	}
+
+	if cfg.ZFactor < 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.hillshade.zfactor", cfg.ZFactor)
+	}
+
+	if cfg.Output == "" {
+		cfg.Output = hillshadeGrayscale
+	}
+
+	if !slices.Contains(allHillshadeOutputs, cfg.Output) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.hillshade.output", cfg.Output, allHillshadeOutputs)
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	elevation, err := newElevationCache(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hillshade{cfg, provider, elevation}, nil
+}
+
+func (t Hillshade) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Hillshade holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Hillshade) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Hillshade) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	elevation, err := fetchElevation(ctx, t.provider, t.elevation, providerContext, tileRequest, t.Encoding)
+	if err != nil || elevation == nil {
+		return nil, err
+	}
+
+	shade := t.shade(tileRequest, elevation)
+
+	var out image.Image
+	if t.Output == hillshadeAlpha {
+		// Black with the opacity of the shadow, for laying over other imagery
+		mask := image.NewNRGBA(shade.Rect)
+		for i, v := range shade.Pix {
+			mask.Pix[i*4+3] = 255 - v
+		}
+		out = mask
+	} else {
+		out = shade
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng, ForceSkipCache: elevation.forceSkipCache}, nil
+}
+
+// shade computes the illumination of each pixel from the slope and aspect of the surface around
+// it, using Horn's method over the 3x3 neighborhood of each pixel
+func (t Hillshade) shade(tileRequest pkg.TileRequest, elevation *elevationTiles) *image.Gray {
+	size := elevation.size
+	at := elevation.at
+
+	zenith := (90 - *t.Altitude) * math.Pi / 180
+	azimuth := math.Mod(360-*t.Azimuth+90, 360) * math.Pi / 180
+	tileCount := float64(int(1) << tileRequest.Z)
+
+	out := image.NewGray(image.Rect(0, 0, size, size))
+
+	parallel.Line(size, func(start, end int) {
+		for y := start; y < end; y++ {
+			// A mercator pixel covers less ground the further it is from the equator
+			n := math.Pi - 2*math.Pi*(float64(tileRequest.Y)+(float64(y)+0.5)/float64(size))/tileCount
+			lat := math.Atan(math.Sinh(n))
+			cellSize := mercatorCircumference / (float64(size) * tileCount) * math.Cos(lat)
+
+			for x := range size {
+				a, b, c := at(x-1, y-1), at(x, y-1), at(x+1, y-1)
+				d, f := at(x-1, y), at(x+1, y)
+				g, h, i := at(x-1, y+1), at(x, y+1), at(x+1, y+1)
+
+				dzdx := ((c + 2*f + i) - (a + 2*d + g)) / (8 * cellSize)
+				dzdy := ((g + 2*h + i) - (a + 2*b + c)) / (8 * cellSize)
+
+				slope := math.Atan(t.ZFactor * math.Hypot(dzdx, dzdy))
+				aspect := math.Atan2(dzdy, -dzdx)
+
+				v := math.Cos(zenith)*math.Cos(slope) + math.Sin(zenith)*math.Sin(slope)*math.Cos(azimuth-aspect)
+				out.Pix[y*out.Stride+x] = uint8(math.Round(255 * min(max(v, 0), 1)))
+			}
+		}
+	})
+
+	return out
+}
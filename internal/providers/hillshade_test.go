@@ -0,0 +1,235 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// elevationProvider renders terrarium tiles of an elevation function of the global pixel position,
+// so that neighboring tiles line up. Terrarium only covers about 32km either side of sea level so
+// the tests keep their functions near zero around the tiles they use
+type elevationProvider struct {
+	size      int
+	elevation func(x, y int) float64
+	fail      map[pkg.TileRequest]bool
+	calls     atomic.Int32
+}
+
+func (p *elevationProvider) PreAuth(_ context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return providerContext, nil
+}
+
+func (p *elevationProvider) GenerateTile(_ context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	p.calls.Add(1)
+	if p.fail[tileRequest] {
+		return nil, errors.New("unavailable")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, p.size, p.size))
+	for y := range p.size {
+		for x := range p.size {
+			v := p.elevation(tileRequest.X*p.size+x, tileRequest.Y*p.size+y) + 32768
+			img.SetNRGBA(x, y, color.NRGBA{uint8(int(v) / 256), uint8(int(v) % 256), uint8((v - math.Floor(v)) * 256), 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng}, nil
+}
+
+func makeHillshade(t *testing.T, cfg HillshadeConfig, provider layer.Provider) *Hillshade {
+	t.Helper()
+
+	cfg.Encoding = elevationTerrarium
+	cfg.Provider = map[string]interface{}{"name": "static", "color": "F00"}
+	p, err := HillshadeRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	h := p.(*Hillshade)
+	h.provider = provider
+	return h
+}
+
+func renderHillshade(t *testing.T, h *Hillshade, tileRequest pkg.TileRequest) image.Image {
+	t.Helper()
+
+	img, err := h.GenerateTile(context.Background(), layer.ProviderContext{}, tileRequest)
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	return decoded
+}
+
+func Test_HillshadeValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+	negative := -10.0
+
+	_, err := HillshadeRegistration{}.Initialize(HillshadeConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "srtm", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "terrainrgb", Azimuth: &negative, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "terrainrgb", Altitude: &negative, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "terrainrgb", ZFactor: -1, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "terrainrgb", Output: "color", Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := HillshadeRegistration{}.Initialize(HillshadeConfig{Encoding: "terrainrgb", Provider: s}, deps)
+	require.NoError(t, err)
+	assert.InDelta(t, 315.0, *p.(*Hillshade).Azimuth, 0)
+	assert.InDelta(t, 45.0, *p.(*Hillshade).Altitude, 0)
+	assert.InDelta(t, 1.0, p.(*Hillshade).ZFactor, 0)
+	assert.Equal(t, "grayscale", p.(*Hillshade).Output)
+}
+
+func Test_HillshadeDecodeElevation(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0x80, 0x64, 0x80, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{0x01, 0x86, 0xa0, 255})
+
+	assert.InDelta(t, 100.5, decodeElevation(img, elevationTerrarium)[0], 0.001)
+	assert.InDelta(t, 0, decodeElevation(img, elevationTerrainRGB)[1], 0.001)
+}
+
+func Test_HillshadeFlat(t *testing.T) {
+	h := makeHillshade(t, HillshadeConfig{}, &elevationProvider{size: 64, elevation: func(_, _ int) float64 { return 500 }})
+
+	img := renderHillshade(t, h, pkg.TileRequest{LayerName: "l", Z: 10, X: 100, Y: 200})
+	gray, ok := img.(*image.Gray)
+	require.True(t, ok)
+
+	// Flat ground facing straight up is lit by the cosine of the angle from the light to overhead
+	for _, v := range gray.Pix {
+		require.Equal(t, uint8(180), v)
+	}
+}
+
+func Test_HillshadeDirection(t *testing.T) {
+	// Rising towards the east, so facing west
+	slope := &elevationProvider{size: 64, elevation: func(x, _ int) float64 { return float64(x-2000*64) * 5 }}
+	tile := pkg.TileRequest{LayerName: "l", Z: 12, X: 2000, Y: 1500}
+
+	west, east := 270.0, 90.0
+	fromWest := renderHillshade(t, makeHillshade(t, HillshadeConfig{Azimuth: &west}, slope), tile).(*image.Gray)
+	fromEast := renderHillshade(t, makeHillshade(t, HillshadeConfig{Azimuth: &east}, slope), tile).(*image.Gray)
+
+	assert.Greater(t, fromWest.GrayAt(32, 32).Y, uint8(180))
+	assert.Less(t, fromEast.GrayAt(32, 32).Y, uint8(180))
+
+	exaggerated := renderHillshade(t, makeHillshade(t, HillshadeConfig{Azimuth: &west, ZFactor: 3}, slope), tile).(*image.Gray)
+	assert.Greater(t, exaggerated.GrayAt(32, 32).Y, fromWest.GrayAt(32, 32).Y)
+}
+
+func Test_HillshadeLatitude(t *testing.T) {
+	// The same slope per pixel is steeper on the ground nearer the poles where pixels are smaller
+	slope := &elevationProvider{size: 64, elevation: func(x, _ int) float64 { return float64(x-2000*64) * 5 }}
+	west := 270.0
+	h := makeHillshade(t, HillshadeConfig{Azimuth: &west}, slope)
+
+	equator := renderHillshade(t, h, pkg.TileRequest{LayerName: "l", Z: 12, X: 2000, Y: 2048}).(*image.Gray)
+	north := renderHillshade(t, h, pkg.TileRequest{LayerName: "l", Z: 12, X: 2000, Y: 600}).(*image.Gray)
+
+	assert.Greater(t, north.GrayAt(32, 32).Y, equator.GrayAt(32, 32).Y)
+}
+
+func Test_HillshadeSeamless(t *testing.T) {
+	slope := &elevationProvider{size: 64, elevation: func(x, y int) float64 { return float64(x-2000*64)*3 + float64(y-1500*64)*2 }}
+	tile := pkg.TileRequest{LayerName: "l", Z: 12, X: 2000, Y: 1500}
+
+	img := renderHillshade(t, makeHillshade(t, HillshadeConfig{}, slope), tile).(*image.Gray)
+
+	// A plane is shaded the same everywhere, edges included, apart from the slight change in latitude
+	for _, p := range []image.Point{{0, 32}, {63, 32}, {32, 0}, {32, 63}, {0, 0}, {63, 63}} {
+		assert.InDelta(t, img.GrayAt(32, 32).Y, img.GrayAt(p.X, p.Y).Y, 1, p)
+	}
+
+	// Without the neighbor the edge is repeated, flattening the slope along it
+	slope.fail = map[pkg.TileRequest]bool{{LayerName: "l", Z: 12, X: 2001, Y: 1500}: true}
+	img = renderHillshade(t, makeHillshade(t, HillshadeConfig{}, slope), tile).(*image.Gray)
+	assert.NotEqual(t, img.GrayAt(32, 32).Y, img.GrayAt(63, 32).Y)
+	assert.Equal(t, img.GrayAt(32, 32).Y, img.GrayAt(0, 32).Y)
+}
+
+func Test_HillshadeWrapsAntimeridian(t *testing.T) {
+	provider := &recordingProvider{img: &pkg.Image{Content: makeQuadrantImage(t).Content, ContentType: mimePng}}
+	h := makeHillshade(t, HillshadeConfig{}, provider)
+
+	_, err := h.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 2, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	// Nothing above the top row, and the column to the west is the far east of the map
+	assert.Len(t, provider.requested, 6)
+	assert.Contains(t, provider.requested, pkg.TileRequest{LayerName: "l", Z: 2, X: 3, Y: 1})
+}
+
+func Test_HillshadeAlpha(t *testing.T) {
+	h := makeHillshade(t, HillshadeConfig{Output: "alpha"}, &elevationProvider{size: 16, elevation: func(_, _ int) float64 { return 0 }})
+
+	img := renderHillshade(t, h, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1})
+	assert.Equal(t, color.NRGBA{0, 0, 0, 75}, color.NRGBAModel.Convert(img.At(5, 5)))
+}
+
+func Test_HillshadeErrors(t *testing.T) {
+	h := makeHillshade(t, HillshadeConfig{}, &recordingProvider{err: errors.New("down")})
+	_, err := h.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1})
+	require.Error(t, err)
+
+	h = makeHillshade(t, HillshadeConfig{}, &recordingProvider{img: &pkg.Image{Content: []byte{0x1a, 0x00}, ContentType: mvtContentType}})
+	_, err = h.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1})
+	require.Error(t, err)
+}
+
+func Test_HillshadeFetchesNeighborsOnce(t *testing.T) {
+	flat := &elevationProvider{size: 32, elevation: func(_, _ int) float64 { return 500 }}
+	h := makeHillshade(t, HillshadeConfig{}, flat)
+
+	for y := 200; y < 203; y++ {
+		for x := 100; x < 103; x++ {
+			renderHillshade(t, h, pkg.TileRequest{LayerName: "l", Z: 10, X: x, Y: y})
+		}
+	}
+
+	// The 3x3 tiles and the ring around them, rather than nine fetches for each tile
+	assert.Equal(t, int32(25), flat.calls.Load())
+}
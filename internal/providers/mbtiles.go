@@ -0,0 +1,141 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+
+	_ "modernc.org/sqlite"
+)
+
+// Maps the `format` value in an MBTiles metadata table to the content type to serve
+var mbtilesFormats = map[string]string{
+	"png":  mimePng,
+	"jpg":  mimeJpeg,
+	"jpeg": mimeJpeg,
+	"webp": mimeWebp,
+	"pbf":  mvtContentType,
+	"mvt":  mvtContentType,
+}
+
+type MBTilesConfig struct {
+	File string // Path to the .mbtiles file
+}
+
+type MBTiles struct {
+	MBTilesConfig
+	db          *sql.DB
+	contentType string
+}
+
+func init() {
+	layer.RegisterProvider(MBTilesRegistration{})
+}
+
+type MBTilesRegistration struct {
+}
+
+func (s MBTilesRegistration) InitializeConfig() any {
+	return MBTilesConfig{}
+}
+
+func (s MBTilesRegistration) Name() string {
+	return "mbtiles"
+}
+
+func (s MBTilesRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(MBTilesConfig)
+
+	if cfg.File == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.mbtiles.file")
+	}
+
+	// SQLite happily creates a brand new empty database for a path that doesn't exist, which would
+	// turn a typo into a layer that 404s every tile instead of a startup error
+	if _, err := os.Stat(cfg.File); err != nil {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.mbtiles.file", cfg.File)
+	}
+
+	// Escaped so a ? or # in the path isn't taken as the start of the options
+	dsn := url.URL{Scheme: "file", Opaque: (&url.URL{Path: cfg.File}).EscapedPath(), RawQuery: "mode=ro&_pragma=query_only(1)"}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var format string
+	err = db.QueryRowContext(context.Background(), "SELECT value FROM metadata WHERE name = 'format'").Scan(&format)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		db.Close()
+		return nil, fmt.Errorf("unable to read metadata from mbtiles file %v: %w", cfg.File, err)
+	}
+
+	// The format is optional in the spec. Leaving the content type empty lets it be detected from the
+	// tile itself, which works for raster formats
+	contentType, ok := mbtilesFormats[format]
+	if !ok {
+		slog.Warn(fmt.Sprintf("Unrecognized format %q in mbtiles file %v, content type will be inferred", format, cfg.File))
+	}
+
+	return &MBTiles{cfg, db, contentType}, nil
+}
+
+func (t MBTiles) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthBypass: true}, nil
+}
+
+func (t MBTiles) GenerateTile(ctx context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	if _, err := tileRequest.GetBounds(); err != nil {
+		return nil, err
+	}
+
+	// MBTiles stores rows in TMS order, counting up from the south
+	row := int(math.Exp2(float64(tileRequest.Z))) - tileRequest.Y - 1
+
+	var content []byte
+	err := t.db.QueryRowContext(ctx, "SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?", tileRequest.Z, tileRequest.X, row).Scan(&content)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.contentType == mvtContentType {
+		content, err = decompressIfGzipped(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pkg.Image{Content: content, ContentType: t.contentType}, nil
+}
+
+// Close releases the handle on the mbtiles file
+func (t MBTiles) Close(_ context.Context) error {
+	return t.db.Close()
+}
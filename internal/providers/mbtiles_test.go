@@ -0,0 +1,146 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Michad/tilegroxy/internal/images"
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeMBTiles writes an mbtiles file with the given format and tiles keyed by TMS z/x/row
+func makeMBTiles(t *testing.T, format string, tiles map[[3]int][]byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, "CREATE TABLE metadata (name text, value text)")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob)")
+	require.NoError(t, err)
+
+	if format != "" {
+		_, err = db.ExecContext(ctx, "INSERT INTO metadata VALUES ('format', ?)", format)
+		require.NoError(t, err)
+	}
+
+	for k, v := range tiles {
+		_, err = db.ExecContext(ctx, "INSERT INTO tiles VALUES (?, ?, ?, ?)", k[0], k[1], k[2], v)
+		require.NoError(t, err)
+	}
+
+	return path
+}
+
+func Test_MBTiles_Validate(t *testing.T) {
+	p, err := MBTilesRegistration{}.Initialize(MBTilesConfig{}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	assert.Nil(t, p)
+	require.Error(t, err)
+
+	p, err = MBTilesRegistration{}.Initialize(MBTilesConfig{File: filepath.Join(t.TempDir(), "missing.mbtiles")}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	assert.Nil(t, p)
+	require.Error(t, err)
+}
+
+func Test_MBTiles_ExecutePng(t *testing.T) {
+	red, err := images.GetStaticImage(images.KeyImageRed)
+	require.NoError(t, err)
+
+	// z2 y1 is TMS row 2
+	path := makeMBTiles(t, "png", map[[3]int][]byte{{2, 3, 2}: *red})
+
+	p, err := MBTilesRegistration{}.Initialize(MBTilesConfig{File: path}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer p.(*MBTiles).Close(context.Background())
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 2, X: 3, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, *red, img.Content)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 2, X: 3, Y: 2})
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+}
+
+func Test_MBTiles_PathWithURLCharacters(t *testing.T) {
+	red, err := images.GetStaticImage(images.KeyImageRed)
+	require.NoError(t, err)
+
+	path := makeMBTiles(t, "png", map[[3]int][]byte{{0, 0, 0}: *red})
+	oddPath := filepath.Join(filepath.Dir(path), "tiles?v=1#50%.mbtiles")
+	require.NoError(t, os.Rename(path, oddPath))
+
+	p, err := MBTilesRegistration{}.Initialize(MBTilesConfig{File: oddPath}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer p.(*MBTiles).Close(context.Background())
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, *red, img.Content)
+}
+
+func Test_MBTiles_ExecuteGzippedPbf(t *testing.T) {
+	box, err := images.GetStaticImage(images.KeyMvtBox)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(*box)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	path := makeMBTiles(t, "pbf", map[[3]int][]byte{{0, 0, 0}: buf.Bytes()})
+
+	p, err := MBTilesRegistration{}.Initialize(MBTilesConfig{File: path}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, *box, img.Content)
+	assert.Equal(t, mvtContentType, img.ContentType)
+}
+
+// A sparse archive is the common case, so tiles missing from it have to fall through to the
+// secondary of a fallback rather than surfacing as an error
+func Test_MBTiles_FallbackOnMissingTile(t *testing.T) {
+	path := makeMBTiles(t, "png", map[[3]int][]byte{})
+
+	f, err := FallbackRegistration{}.Initialize(FallbackConfig{
+		Primary:   map[string]interface{}{"name": "mbtiles", "file": path},
+		Secondary: map[string]interface{}{"name": "static", "color": "0F0"},
+	}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer f.(*Fallback).Close(context.Background())
+
+	exp, _ := images.GetStaticImage("color:0F0")
+
+	img, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 4, X: 3, Y: 3})
+	require.NoError(t, err)
+	assert.Equal(t, *exp, img.Content)
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/Michad/tilegroxy/pkg"
+)
+
+const maxMetatile = 16
+const metatileJpegQuality = 90
+
+// Placeholders a url has to use for a metatile to be requested as a single image
+var metatileBoundsPlaceholders = []string{"{xmin}", "{xmax}", "{ymin}", "{ymax}"}
+
+// metatileBlock returns the tile in the top left corner of the size x size block containing
+// tileRequest, along with the size of the block. The block shrinks at zooms too low to fit it
+func metatileBlock(tileRequest pkg.TileRequest, size int) (pkg.TileRequest, int) {
+	size = min(size, int(math.Exp2(float64(tileRequest.Z))))
+
+	return pkg.TileRequest{
+		LayerName: tileRequest.LayerName,
+		Z:         tileRequest.Z,
+		X:         tileRequest.X - tileRequest.X%size,
+		Y:         tileRequest.Y - tileRequest.Y%size,
+	}, size
+}
+
+// metatileBounds returns the bounds of the whole block of tiles starting at origin
+func metatileBounds(origin pkg.TileRequest, size int, srid uint) (*pkg.Bounds, error) {
+	topLeft, err := origin.GetBoundsProjection(srid)
+	if err != nil {
+		return nil, err
+	}
+
+	bottomRight, err := pkg.TileRequest{LayerName: origin.LayerName, Z: origin.Z, X: origin.X + size - 1, Y: origin.Y + size - 1}.GetBoundsProjection(srid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Bounds{South: bottomRight.South, North: topLeft.North, West: topLeft.West, East: bottomRight.East, SRID: srid}, nil
+}
+
+// sliceMetatile cuts an image covering a size x size block of tiles into the individual tiles. The
+// tiles are encoded in the same format as the metatile when it's JPEG and as PNG otherwise
+func sliceMetatile(img *pkg.Image, origin pkg.TileRequest, size int) (map[pkg.TileRequest]*pkg.Image, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	if bounds.Dx()%size != 0 || bounds.Dy()%size != 0 {
+		return nil, fmt.Errorf("metatile of %vx%v pixels can't be split evenly into %vx%v tiles", bounds.Dx(), bounds.Dy(), size, size)
+	}
+
+	sub, ok := decoded.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("unable to slice metatile of type %T", decoded)
+	}
+
+	width := bounds.Dx() / size
+	height := bounds.Dy() / size
+	isJpeg := img.ContentType == mimeJpeg
+	result := make(map[pkg.TileRequest]*pkg.Image, size*size)
+
+	for row := range size {
+		for col := range size {
+			tile := sub.SubImage(image.Rect(bounds.Min.X+col*width, bounds.Min.Y+row*height, bounds.Min.X+(col+1)*width, bounds.Min.Y+(row+1)*height))
+
+			var buf bytes.Buffer
+			if isJpeg {
+				err = jpeg.Encode(&buf, tile, &jpeg.Options{Quality: metatileJpegQuality})
+			} else {
+				err = png.Encode(&buf, tile)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			tileRequest := pkg.TileRequest{LayerName: origin.LayerName, Z: origin.Z, X: origin.X + col, Y: origin.Y + row}
+			result[tileRequest] = &pkg.Image{Content: buf.Bytes(), ContentType: pkg.Ternary(isJpeg, mimeJpeg, mimePng), ForceSkipCache: img.ForceSkipCache}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCache never hits and remembers every tile saved to it
+type recordingCache struct {
+	mu    sync.Mutex
+	saved map[pkg.TileRequest]*pkg.Image
+}
+
+func (c *recordingCache) Lookup(_ context.Context, _ pkg.TileRequest) (*pkg.Image, error) {
+	return nil, nil
+}
+
+func (c *recordingCache) Save(_ context.Context, t pkg.TileRequest, img *pkg.Image) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saved[t] = img
+	return nil
+}
+
+func (c *recordingCache) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.saved)
+}
+
+var metatileColors = []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 0, 255}}
+
+// metatileServer answers every request with a 2x2 block of solid colored tiles, sized by the width
+// and height query parameters
+func metatileServer(t *testing.T, calls *atomic.Int32, urls chan<- string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if urls != nil {
+			urls <- r.URL.String()
+		}
+
+		// Give concurrent requests for the same block time to pile up
+		time.Sleep(50 * time.Millisecond)
+
+		img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+		for y := range 512 {
+			for x := range 512 {
+				img.SetNRGBA(x, y, metatileColors[(y/256)*2+x/256])
+			}
+		}
+
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img)
+		w.Header().Set("Content-Type", mimePng)
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		_, _ = w.Write(buf.Bytes())
+	}))
+}
+
+func Test_MetatileBlock(t *testing.T) {
+	origin, size := metatileBlock(pkg.TileRequest{LayerName: "l", Z: 5, X: 13, Y: 6}, 4)
+	assert.Equal(t, pkg.TileRequest{LayerName: "l", Z: 5, X: 12, Y: 4}, origin)
+	assert.Equal(t, 4, size)
+
+	origin, size = metatileBlock(pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1}, 4)
+	assert.Equal(t, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0}, origin)
+	assert.Equal(t, 2, size)
+}
+
+func Test_Proxy_MetatileValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+
+	_, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", Metatile: 4}, deps)
+	require.Error(t, err)
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/?bbox={xmin},{ymin},{xmax},{ymax}", Metatile: 64}, deps)
+	require.Error(t, err)
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/?bbox={xmin},{ymin},{xmax},{ymax}", Metatile: 3}, deps)
+	require.Error(t, err)
+
+	_, err = URLTemplateRegistration{}.Initialize(URLTemplateConfig{Template: "http://example.com/?bbox=$xmin,$ymin,$xmax,$ymax", Metatile: 4}, deps)
+	require.NoError(t, err)
+}
+
+func Test_Proxy_MetatileSlicesAndCachesSiblings(t *testing.T) {
+	var calls atomic.Int32
+	urls := make(chan string, 10)
+	server := metatileServer(t, &calls, urls)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "wms", Provider: map[string]any{
+			"name":     "url template",
+			"template": server.URL + "/wms?bbox=$xmin,$ymin,$xmax,$ymax&width=$width&height=$height",
+			"srid":     3857,
+			"metatile": 2,
+		}},
+	}
+
+	c := &recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	img, err := lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "wms", Z: 3, X: 5, Y: 2})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), decoded.Bounds())
+	// 5,2 is the top right of the block starting at 4,2
+	assert.Equal(t, metatileColors[1], color.NRGBAModel.Convert(decoded.At(10, 10)))
+
+	url := <-urls
+	assert.Contains(t, url, "width=512&height=512")
+
+	bounds, err := metatileBounds(pkg.TileRequest{Z: 3, X: 4, Y: 2}, 2, pkg.SRIDPsuedoMercator)
+	require.NoError(t, err)
+	assert.Contains(t, url, fmt.Sprintf("bbox=%f,%f,%f,%f", bounds.West, bounds.South, bounds.East, bounds.North))
+
+	// The requested tile plus its three siblings all end up in the cache
+	require.Eventually(t, func() bool { return c.count() == 4 }, time.Second, 10*time.Millisecond)
+
+	sibling := c.saved[pkg.TileRequest{LayerName: "wms", Z: 3, X: 4, Y: 3}]
+	require.NotNil(t, sibling)
+	decoded, err = png.Decode(bytes.NewReader(sibling.Content))
+	require.NoError(t, err)
+	assert.Equal(t, metatileColors[2], color.NRGBAModel.Convert(decoded.At(10, 10)))
+}
+
+func Test_Proxy_MetatileNestedDoesntCacheSiblings(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "wms", Provider: map[string]any{
+			"name": "fallback",
+			"primary": map[string]any{
+				"name":     "proxy",
+				"url":      server.URL + "/?bbox={xmin},{ymin},{xmax},{ymax}",
+				"metatile": 2,
+			},
+			"secondary": map[string]any{"name": "static", "color": "FFF"},
+		}},
+	}
+
+	c := &recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	_, err = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "wms", Z: 3, X: 5, Y: 2})
+	require.NoError(t, err)
+
+	// Only the tile the layer rendered, the siblings haven't been through the rest of the layer
+	require.Eventually(t, func() bool { return c.count() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, c.count())
+	assert.NotNil(t, c.saved[pkg.TileRequest{LayerName: "wms", Z: 3, X: 5, Y: 2}])
+}
+
+func Test_Proxy_MetatileCachesSiblingsAfterDisconnect(t *testing.T) {
+	var calls atomic.Int32
+	inner := metatileServer(t, &calls, nil)
+	defer inner.Close()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "wms", Provider: map[string]any{
+			"name":     "proxy",
+			"url":      server.URL + "/?bbox={xmin},{ymin},{xmax},{ymax}&width={width}&height={height}",
+			"metatile": 2,
+		}},
+	}
+
+	c := &recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	p, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: server.URL + "/?bbox={xmin},{ymin},{xmax},{ymax}&width={width}&height={height}", Metatile: 2}, layer.ProviderDeps{
+		ErrorMessages: testErrMessages,
+		ClientConfig:  config.ClientConfig{StatusCodes: []int{200}, ContentTypes: []string{mimePng}, MaxLength: 10 * 1024 * 1024, Timeout: 5},
+		LayerGroup:    lg,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(pkg.BackgroundContext())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		close(release)
+	}()
+
+	_, err = p.GenerateTile(ctx, layer.ProviderContext{}, pkg.TileRequest{LayerName: "wms", Z: 3, X: 5, Y: 2})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The client gave up on its own tile but the rest of the block is still cached
+	require.Eventually(t, func() bool { return c.count() == 3 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_Proxy_MetatileCoalescesConcurrentRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	p, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: server.URL + "/?bbox={xmin},{ymin},{xmax},{ymax}", Metatile: 2}, layer.ProviderDeps{
+		ErrorMessages: testErrMessages,
+		ClientConfig:  config.ClientConfig{StatusCodes: []int{200}, ContentTypes: []string{mimePng}, MaxLength: 10 * 1024 * 1024, Timeout: 5},
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	results := make([]*pkg.Image, 4)
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: i % 2, Y: i / 2})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for i, img := range results {
+		require.NotNil(t, img)
+		decoded, err := png.Decode(bytes.NewReader(img.Content))
+		require.NoError(t, err)
+		assert.Equal(t, metatileColors[i], color.NRGBAModel.Convert(decoded.At(128, 128)))
+	}
+}
+
+func Test_Proxy_MetatileRespectsSkipCache(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "wms", SkipCache: true, Provider: map[string]any{
+			"name":     "proxy",
+			"url":      server.URL + "/?bbox={xmin},{ymin},{xmax},{ymax}",
+			"metatile": 2,
+		}},
+	}
+
+	c := &recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	_, err = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "wms", Z: 3, X: 5, Y: 2})
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, c.count())
+}
@@ -0,0 +1,249 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+type MVTFilterRename struct {
+	From string
+	To   string
+}
+
+// MVTFilterCondition matches features whose attribute has one of the values. Values are compared
+// as strings so a number or boolean attribute can be matched by its usual text form
+type MVTFilterCondition struct {
+	Attribute string
+	Values    []string
+	Exclude   bool // Drop matching features rather than keeping only them
+}
+
+type MVTFilterGeometry struct {
+	Zoom     string  // Zoom levels these settings are used at
+	Simplify float64 // Douglas-Peucker tolerance in the layer's extent units
+	MinArea  float64 // Polygons under this area, in the layer's extent units squared, are dropped
+}
+
+type MVTFilterRule struct {
+	Layer             string // Layer the rule applies to, all layers if empty
+	Attributes        []string
+	ExcludeAttributes []string
+	Rename            []MVTFilterRename
+	Filter            []MVTFilterCondition
+	Geometry          []MVTFilterGeometry
+}
+
+type MVTFilterConfig struct {
+	Provider      map[string]interface{}
+	Layers        []string
+	ExcludeLayers []string
+	Rules         []MVTFilterRule
+}
+
+type MVTFilter struct {
+	MVTFilterConfig
+	// geometryZooms[i][j] holds the zoom levels of Rules[i].Geometry[j]
+	geometryZooms [][][]int
+	provider      layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(MVTFilterRegistration{})
+}
+
+type MVTFilterRegistration struct {
+}
+
+func (s MVTFilterRegistration) InitializeConfig() any {
+	return MVTFilterConfig{}
+}
+
+func (s MVTFilterRegistration) Name() string {
+	return "mvtfilter"
+}
+
+func (s MVTFilterRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(MVTFilterConfig)
+	errs := make([]error, 0)
+	geometryZooms := make([][][]int, len(cfg.Rules))
+
+	for i, rule := range cfg.Rules {
+		param := "provider.mvtfilter.rules[" + strconv.Itoa(i) + "]"
+
+		for j, r := range rule.Rename {
+			if r.From == "" {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamRequired, param+".rename["+strconv.Itoa(j)+"].from"))
+			}
+			if r.To == "" {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamRequired, param+".rename["+strconv.Itoa(j)+"].to"))
+			}
+		}
+
+		for j, c := range rule.Filter {
+			if c.Attribute == "" {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamRequired, param+".filter["+strconv.Itoa(j)+"].attribute"))
+			}
+		}
+
+		geometryZooms[i] = make([][]int, len(rule.Geometry))
+		for j, g := range rule.Geometry {
+			geometryParam := param + ".geometry[" + strconv.Itoa(j) + "]"
+
+			zooms, err := pkg.ParseZoomString(g.Zoom)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, geometryParam+".zoom", g.Zoom))
+			}
+			geometryZooms[i][j] = zooms
+
+			if g.Simplify < 0 {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, geometryParam+".simplify", g.Simplify))
+			}
+			if g.MinArea < 0 {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, geometryParam+".minarea", g.MinArea))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MVTFilter{cfg, geometryZooms, provider}, nil
+}
+
+func (t MVTFilter) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. MVTFilter holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t MVTFilter) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t MVTFilter) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	img, err := t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMVT(img) {
+		return nil, fmt.Errorf("mvtfilter requires a vector tile but received %v", img.ContentType)
+	}
+
+	layers, err := decodeMVT(img)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(mvt.Layers, 0, len(layers))
+
+	for _, l := range layers {
+		if len(t.Layers) > 0 && !slices.Contains(t.Layers, l.Name) {
+			continue
+		}
+
+		if slices.Contains(t.ExcludeLayers, l.Name) {
+			continue
+		}
+
+		for i, rule := range t.Rules {
+			if rule.Layer == "" || rule.Layer == l.Name {
+				t.applyRule(l, tileRequest.Z, i)
+			}
+		}
+
+		if len(l.Features) > 0 {
+			result = append(result, l)
+		}
+	}
+
+	return encodeMVT(result, img.ForceSkipCache)
+}
+
+// applyRule filters the features of a layer, then trims and renames their attributes, then
+// simplifies what's left
+func (t MVTFilter) applyRule(l *mvt.Layer, z int, ruleIndex int) {
+	rule := t.Rules[ruleIndex]
+
+	l.Features = slices.DeleteFunc(l.Features, func(f *geojson.Feature) bool {
+		return !matchesConditions(f, rule.Filter)
+	})
+
+	for _, f := range l.Features {
+		if f.Properties == nil {
+			continue
+		}
+
+		for key := range f.Properties {
+			if (len(rule.Attributes) > 0 && !slices.Contains(rule.Attributes, key)) || slices.Contains(rule.ExcludeAttributes, key) {
+				delete(f.Properties, key)
+			}
+		}
+
+		for _, r := range rule.Rename {
+			if val, ok := f.Properties[r.From]; ok {
+				delete(f.Properties, r.From)
+				f.Properties[r.To] = val
+			}
+		}
+	}
+
+	for j, g := range rule.Geometry {
+		if !slices.Contains(t.geometryZooms[ruleIndex][j], z) {
+			continue
+		}
+
+		if g.Simplify > 0 {
+			l.Simplify(simplify.DouglasPeucker(g.Simplify))
+		}
+
+		if g.MinArea > 0 {
+			l.RemoveEmpty(0, g.MinArea)
+		}
+
+		break
+	}
+}
+
+func matchesConditions(f *geojson.Feature, conditions []MVTFilterCondition) bool {
+	for _, c := range conditions {
+		val, ok := f.Properties[c.Attribute]
+		matches := ok && slices.Contains(c.Values, fmt.Sprint(val))
+
+		if matches == c.Exclude {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeMVTFilterSource(t *testing.T) *recordingProvider {
+	t.Helper()
+
+	primary := geojson.NewFeature(orb.LineString{{0, 0}, {50, 1}, {100, 0}})
+	primary.Properties["kind"] = "primary"
+	primary.Properties["name"] = "Main St"
+	primary.Properties["internal_id"] = 12
+	service := geojson.NewFeature(orb.LineString{{0, 10}, {100, 10}})
+	service.Properties["kind"] = "service"
+	service.Properties["name"] = "Alley"
+	service.Properties["internal_id"] = 13
+
+	big := geojson.NewFeature(orb.Polygon{{{0, 0}, {100, 0}, {100, 100}, {0, 100}, {0, 0}}})
+	small := geojson.NewFeature(orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}})
+
+	secret := geojson.NewFeature(orb.Point{1, 1})
+
+	content := makeCompositeTile(t, 4096, map[string][]*geojson.Feature{
+		"roads":     {primary, service},
+		"buildings": {big, small},
+		"secret":    {secret},
+	})
+
+	return &recordingProvider{img: &pkg.Image{Content: content, ContentType: mvtContentType}}
+}
+
+func Test_MVTFilterValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "image": "embedded:box.mvt"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := MVTFilterRegistration{}.Initialize(MVTFilterConfig{Provider: s, Rules: []MVTFilterRule{{Geometry: []MVTFilterGeometry{{Zoom: "fish"}}}}}, deps)
+	require.Error(t, err)
+
+	_, err = MVTFilterRegistration{}.Initialize(MVTFilterConfig{Provider: s, Rules: []MVTFilterRule{{Filter: []MVTFilterCondition{{Values: []string{"a"}}}}}}, deps)
+	require.Error(t, err)
+
+	_, err = MVTFilterRegistration{}.Initialize(MVTFilterConfig{Provider: s, Rules: []MVTFilterRule{{Rename: []MVTFilterRename{{From: "a"}}}}}, deps)
+	require.Error(t, err)
+
+	_, err = MVTFilterRegistration{}.Initialize(MVTFilterConfig{Provider: s, Rules: []MVTFilterRule{{Geometry: []MVTFilterGeometry{{Zoom: "0-10", Simplify: 4}}}}}, deps)
+	require.NoError(t, err)
+}
+
+func Test_MVTFilterLayersAndAttributes(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "image": "embedded:box.mvt"}
+	p, err := MVTFilterRegistration{}.Initialize(MVTFilterConfig{
+		Provider:      s,
+		ExcludeLayers: []string{"secret"},
+		Rules: []MVTFilterRule{
+			{
+				Layer:             "roads",
+				ExcludeAttributes: []string{"internal_id"},
+				Rename:            []MVTFilterRename{{From: "kind", To: "class"}},
+				Filter:            []MVTFilterCondition{{Attribute: "kind", Values: []string{"service"}, Exclude: true}},
+			},
+		},
+	}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	f := p.(*MVTFilter)
+	f.provider = makeMVTFilterSource(t)
+
+	img, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 12, X: 1, Y: 1})
+	require.NoError(t, err)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	assert.Equal(t, "buildings", layers[0].Name)
+	assert.Len(t, layers[0].Features, 2)
+
+	assert.Equal(t, "roads", layers[1].Name)
+	require.Len(t, layers[1].Features, 1)
+	assert.Equal(t, geojson.Properties{"class": "primary", "name": "Main St"}, layers[1].Features[0].Properties)
+}
+
+func Test_MVTFilterIncludeLists(t *testing.T) {
+	f := MVTFilter{
+		MVTFilterConfig: MVTFilterConfig{
+			Layers: []string{"roads"},
+			Rules: []MVTFilterRule{
+				{Attributes: []string{"name"}},
+				{Filter: []MVTFilterCondition{{Attribute: "name", Values: []string{"Alley"}}}},
+			},
+		},
+		geometryZooms: [][][]int{{}, {}},
+		provider:      makeMVTFilterSource(t),
+	}
+
+	img, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 12, X: 1, Y: 1})
+	require.NoError(t, err)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	require.Len(t, layers[0].Features, 1)
+	assert.Equal(t, geojson.Properties{"name": "Alley"}, layers[0].Features[0].Properties)
+}
+
+func Test_MVTFilterGeometryByZoom(t *testing.T) {
+	f := MVTFilter{
+		MVTFilterConfig: MVTFilterConfig{
+			Rules: []MVTFilterRule{
+				{Geometry: []MVTFilterGeometry{{Zoom: "0-10", Simplify: 2, MinArea: 100}}},
+			},
+		},
+		geometryZooms: [][][]int{{{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}},
+	}
+
+	// Outside the zoom range nothing changes
+	f.provider = makeMVTFilterSource(t)
+	img, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 12, X: 1, Y: 1})
+	require.NoError(t, err)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+	assert.Len(t, layers[0].Features, 2)
+	assert.Len(t, layers[1].Features[0].Geometry.(orb.LineString), 3)
+
+	f.provider = makeMVTFilterSource(t)
+	img, err = f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 8, X: 1, Y: 1})
+	require.NoError(t, err)
+
+	layers, err = mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+
+	// The small building is dropped and the bump in the road smoothed out
+	assert.Len(t, layers[0].Features, 1)
+	assert.Equal(t, orb.LineString{{0, 0}, {100, 0}}, layers[1].Features[0].Geometry)
+}
+
+func Test_MVTFilterRejectsRaster(t *testing.T) {
+	f := MVTFilter{provider: &recordingProvider{img: makeQuadrantImage(t)}}
+
+	_, err := f.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 8, X: 1, Y: 1})
+	require.Error(t, err)
+}
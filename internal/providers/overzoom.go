@@ -0,0 +1,197 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+)
+
+const overzoomJpegQuality = 90
+
+// How far outside the tile vector geometry is kept, as a fraction of the extent. Matches the
+// customary 64 unit buffer of a 4096 extent tile so lines and polygons don't visibly end at the edge
+const overzoomMVTBuffer = 1.0 / 64
+
+type OverzoomConfig struct {
+	MaxZoom    uint
+	Resampling string
+	Provider   map[string]interface{}
+}
+
+type Overzoom struct {
+	OverzoomConfig
+	filter   transform.ResampleFilter
+	provider layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(OverzoomRegistration{})
+}
+
+type OverzoomRegistration struct {
+}
+
+func (s OverzoomRegistration) InitializeConfig() any {
+	return OverzoomConfig{}
+}
+
+func (s OverzoomRegistration) Name() string {
+	return "overzoom"
+}
+
+func (s OverzoomRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(OverzoomConfig)
+
+	if cfg.MaxZoom < 1 || cfg.MaxZoom > pkg.MaxZoom {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.overzoom.maxzoom", 1, pkg.MaxZoom)
+	}
+
+	if cfg.Resampling == "" {
+		cfg.Resampling = "bilinear"
+	}
+
+	filter, ok := resamplingFilters[cfg.Resampling]
+	if !ok {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.overzoom.resampling", cfg.Resampling, allResamplingFilters)
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Overzoom{cfg, filter, provider}, nil
+}
+
+func (t Overzoom) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Overzoom holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Overzoom) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Overzoom) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	if tileRequest.Z <= int(t.MaxZoom) {
+		return t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	}
+
+	levels := tileRequest.Z - int(t.MaxZoom)
+	parent := pkg.TileRequest{LayerName: tileRequest.LayerName, Z: int(t.MaxZoom), X: tileRequest.X >> levels, Y: tileRequest.Y >> levels}
+	scale := 1 << levels
+	col := tileRequest.X - parent.X*scale
+	row := tileRequest.Y - parent.Y*scale
+
+	slog.DebugContext(ctx, fmt.Sprintf("Overzooming %v from %v", tileRequest, parent))
+
+	img, err := t.provider.GenerateTile(ctx, providerContext, parent)
+	if err != nil || img == nil {
+		return img, err
+	}
+
+	if isMVT(img) {
+		return overzoomMVT(img, scale, col, row)
+	}
+
+	return overzoomImage(img, scale, col, row, t.filter)
+}
+
+// overzoomImage cuts the col/row square out of a parent image split into scale x scale squares and
+// resizes it back up to the size of the parent
+func overzoomImage(img *pkg.Image, scale int, col int, row int, filter transform.ResampleFilter) (*pkg.Image, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Past the point where the square is under a pixel this keeps scaling up a single pixel
+	x0 := col * width / scale
+	x1 := max((col+1)*width/scale, x0+1)
+	y0 := row * height / scale
+	y1 := max((row+1)*height/scale, y0+1)
+
+	cropped := transform.Crop(decoded, image.Rect(bounds.Min.X+x0, bounds.Min.Y+y0, bounds.Min.X+x1, bounds.Min.Y+y1))
+	resized := transform.Resize(cropped, width, height, filter)
+
+	var buf bytes.Buffer
+	isJpeg := img.ContentType == mimeJpeg
+	if isJpeg {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: overzoomJpegQuality})
+	} else {
+		err = png.Encode(&buf, resized)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: pkg.Ternary(isJpeg, mimeJpeg, mimePng), ForceSkipCache: img.ForceSkipCache}, nil
+}
+
+// overzoomMVT clips the geometry of a parent vector tile to the col/row square of it and scales it
+// up to fill the extent of the tile
+func overzoomMVT(img *pkg.Image, scale int, col int, row int) (*pkg.Image, error) {
+	layers, err := decodeMVT(img)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(mvt.Layers, 0, len(layers))
+	factor := float64(scale)
+
+	for _, l := range layers {
+		extent := float64(mvtExtent(l))
+		offsetX := float64(col) * extent / factor
+		offsetY := float64(row) * extent / factor
+		buffer := extent * overzoomMVTBuffer / factor
+
+		// Clip before scaling so coordinates far outside the square can't overflow the encoding
+		l.Clip(orb.Bound{
+			Min: orb.Point{offsetX - buffer, offsetY - buffer},
+			Max: orb.Point{offsetX + extent/factor + buffer, offsetY + extent/factor + buffer},
+		})
+
+		if len(l.Features) == 0 {
+			continue
+		}
+
+		transformMVTLayer(l, func(p orb.Point) orb.Point {
+			return orb.Point{(p[0] - offsetX) * factor, (p[1] - offsetY) * factor}
+		})
+
+		result = append(result, l)
+	}
+
+	return encodeMVT(result, img.ForceSkipCache)
+}
@@ -0,0 +1,155 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingProvider returns a fixed image or error and remembers the tiles asked of it. Providers
+// fetching neighbors, like hillshade, ask for tiles concurrently
+type recordingProvider struct {
+	img       *pkg.Image
+	err       error
+	mutex     sync.Mutex
+	requested []pkg.TileRequest
+}
+
+func (p *recordingProvider) PreAuth(_ context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return providerContext, nil
+}
+
+func (p *recordingProvider) GenerateTile(_ context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	p.mutex.Lock()
+	p.requested = append(p.requested, tileRequest)
+	p.mutex.Unlock()
+
+	return p.img, p.err
+}
+
+func makeQuadrantImage(t *testing.T) *pkg.Image {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := range 256 {
+		for x := range 256 {
+			img.SetNRGBA(x, y, metatileColors[(y/128)*2+x/128])
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng}
+}
+
+func Test_OverzoomValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := OverzoomRegistration{}.Initialize(OverzoomConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = OverzoomRegistration{}.Initialize(OverzoomConfig{MaxZoom: 14, Resampling: "cubic", Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := OverzoomRegistration{}.Initialize(OverzoomConfig{MaxZoom: 14, Provider: s}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, "bilinear", p.(*Overzoom).Resampling)
+}
+
+func Test_OverzoomPassesThroughAtMaxZoom(t *testing.T) {
+	child := &recordingProvider{img: makeQuadrantImage(t)}
+	o := Overzoom{OverzoomConfig: OverzoomConfig{MaxZoom: 5}, filter: resamplingFilters["nearest"], provider: child}
+
+	img, err := o.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 5, X: 3, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, child.img, img)
+	assert.Equal(t, []pkg.TileRequest{{LayerName: "l", Z: 5, X: 3, Y: 1}}, child.requested)
+}
+
+func Test_OverzoomScalesImage(t *testing.T) {
+	child := &recordingProvider{img: makeQuadrantImage(t)}
+	o := Overzoom{OverzoomConfig: OverzoomConfig{MaxZoom: 5}, filter: resamplingFilters["nearest"], provider: child}
+
+	// 7,4 at z6 is the top right quarter of 3,2 at z5
+	img, err := o.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 6, X: 7, Y: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.TileRequest{{LayerName: "l", Z: 5, X: 3, Y: 2}}, child.requested)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), decoded.Bounds())
+	assert.Equal(t, metatileColors[1], color.NRGBAModel.Convert(decoded.At(0, 0)))
+	assert.Equal(t, metatileColors[1], color.NRGBAModel.Convert(decoded.At(255, 255)))
+
+	// Several levels past the source the square is a fraction of a pixel
+	child.requested = nil
+	img, err = o.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 15, X: 3*1024 + 1000, Y: 2*1024 + 1000})
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.TileRequest{{LayerName: "l", Z: 5, X: 3, Y: 2}}, child.requested)
+
+	decoded, err = png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	assert.Equal(t, metatileColors[3], color.NRGBAModel.Convert(decoded.At(128, 128)))
+}
+
+func Test_OverzoomClipsMVT(t *testing.T) {
+	roads := geojson.NewFeature(orb.LineString{{0, 0}, {4096, 4096}})
+	roads.Properties["name"] = "diagonal"
+	pois := geojson.NewFeature(orb.Point{100, 100})
+
+	content, err := mvt.Marshal(mvt.Layers{
+		{Name: "roads", Version: 2, Extent: 4096, Features: []*geojson.Feature{roads}},
+		{Name: "pois", Version: 2, Extent: 4096, Features: []*geojson.Feature{pois}},
+	})
+	require.NoError(t, err)
+
+	child := &recordingProvider{img: &pkg.Image{Content: content, ContentType: mvtContentType}}
+	o := Overzoom{OverzoomConfig: OverzoomConfig{MaxZoom: 5}, provider: child}
+
+	img, err := o.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 6, X: 7, Y: 5})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := mvt.Unmarshal(img.Content)
+	require.NoError(t, err)
+
+	// The point is in the top left quarter, so its whole layer is gone
+	require.Len(t, layers, 1)
+	assert.Equal(t, "roads", layers[0].Name)
+	require.Len(t, layers[0].Features, 1)
+	assert.Equal(t, "diagonal", layers[0].Features[0].Properties["name"])
+
+	// The bottom right quarter of the diagonal doubled, kept a little past the top left edge where
+	// it continues into the neighboring tile
+	line := layers[0].Features[0].Geometry.(orb.LineString)
+	assert.Equal(t, orb.LineString{{-64, -64}, {4096, 4096}}, line)
+}
@@ -0,0 +1,406 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+
+	"github.com/maypok86/otter"
+)
+
+// The spec guarantees the header and root directory both fit in the first 16 KiB
+const pmtilesHeaderAndRootLength = 16384
+const pmtilesHeaderLength = 127
+const pmtilesMaxDirectoryDepth = 4
+const defaultPmtilesCacheSize = 64
+const minPmtilesCacheSize = 10
+
+const (
+	pmtilesCompressionUnknown = 0
+	pmtilesCompressionNone    = 1
+	pmtilesCompressionGzip    = 2
+)
+
+// Maps the tile type in a PMTiles header to the content type to serve
+var pmtilesTileTypes = map[uint8]string{
+	1: mvtContentType,
+	2: mimePng,
+	3: mimeJpeg,
+	4: mimeWebp,
+	5: "image/avif",
+}
+
+type PMTilesConfig struct {
+	File      string // Path to a .pmtiles file on the local filesystem
+	URL       string // URL of a .pmtiles file on a server supporting HTTP range requests
+	CacheSize uint16 // Maximum number of leaf directories to hold in memory. Defaults to 64
+}
+
+type PMTiles struct {
+	PMTilesConfig
+	reader rangeReader
+	// Guards header and root, which are loaded on first use so an unreachable archive doesn't stop startup
+	mu     sync.Mutex
+	header *pmtilesHeader
+	root   []pmtilesEntry
+	leaves otter.Cache[uint64, []pmtilesEntry]
+}
+
+type pmtilesHeader struct {
+	rootOffset          uint64
+	rootLength          uint64
+	leafOffset          uint64
+	tileDataOffset      uint64
+	internalCompression uint8
+	tileCompression     uint8
+	tileType            uint8
+	minZoom             uint8
+	maxZoom             uint8
+}
+
+// An entry in a PMTiles directory. A run length of 0 means the entry points at a leaf directory
+// rather than tile data
+type pmtilesEntry struct {
+	tileID    uint64
+	offset    uint64
+	length    uint64
+	runLength uint64
+}
+
+func init() {
+	layer.RegisterProvider(PMTilesRegistration{})
+}
+
+type PMTilesRegistration struct {
+}
+
+func (s PMTilesRegistration) InitializeConfig() any {
+	return PMTilesConfig{}
+}
+
+func (s PMTilesRegistration) Name() string {
+	return "pmtiles"
+}
+
+func (s PMTilesRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(PMTilesConfig)
+
+	if cfg.CacheSize == 0 {
+		cfg.CacheSize = defaultPmtilesCacheSize
+	}
+	if cfg.CacheSize < minPmtilesCacheSize {
+		cfg.CacheSize = minPmtilesCacheSize
+	}
+
+	reader, err := newRangeReader(cfg.File, cfg.URL, deps.ClientConfig, deps.ErrorMessages, "provider.pmtiles")
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, err := otter.MustBuilder[uint64, []pmtilesEntry](int(cfg.CacheSize)).Build()
+	if err != nil {
+		return nil, errors.Join(err, reader.Close())
+	}
+
+	return &PMTiles{PMTilesConfig: cfg, reader: reader, leaves: leaves}, nil
+}
+
+func (t *PMTiles) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthBypass: true}, nil
+}
+
+func (t *PMTiles) GenerateTile(ctx context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	if _, err := tileRequest.GetBounds(); err != nil {
+		return nil, err
+	}
+
+	header, root, err := t.loadRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tileRequest.Z < int(header.minZoom) || tileRequest.Z > int(header.maxZoom) {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	tileID := pmtilesTileID(tileRequest.Z, tileRequest.X, tileRequest.Y)
+	entries := root
+
+	for range pmtilesMaxDirectoryDepth {
+		entry, ok := findPmtilesEntry(entries, tileID)
+		if !ok {
+			return nil, pkg.TileNotFoundError{Tile: tileRequest}
+		}
+
+		if entry.runLength > 0 {
+			content, err := t.reader.ReadRange(ctx, header.tileDataOffset+entry.offset, entry.length)
+			if err != nil {
+				return nil, err
+			}
+
+			content, err = pmtilesDecompress(content, header.tileCompression)
+			if err != nil {
+				return nil, err
+			}
+
+			return &pkg.Image{Content: content, ContentType: pmtilesTileTypes[header.tileType]}, nil
+		}
+
+		entries, err = t.loadLeaf(ctx, header, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("pmtiles directories nested deeper than %v levels", pmtilesMaxDirectoryDepth)
+}
+
+// Close releases the handle on the archive
+func (t *PMTiles) Close(_ context.Context) error {
+	t.leaves.Close()
+	return t.reader.Close()
+}
+
+func (t *PMTiles) loadRoot(ctx context.Context) (*pmtilesHeader, []pmtilesEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.header != nil {
+		return t.header, t.root, nil
+	}
+
+	slog.DebugContext(ctx, "Loading pmtiles header")
+
+	// Read separately from the root directory since a small archive can be shorter than 16 KiB in total
+	data, err := t.reader.ReadRange(ctx, 0, pmtilesHeaderLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := parsePmtilesHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.rootOffset+header.rootLength > pmtilesHeaderAndRootLength {
+		return nil, nil, errors.New("pmtiles root directory lies outside the first 16 KiB")
+	}
+
+	data, err = t.reader.ReadRange(ctx, header.rootOffset, header.rootLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := parsePmtilesDirectory(data, header.internalCompression)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.header = header
+	t.root = root
+
+	return t.header, t.root, nil
+}
+
+func (t *PMTiles) loadLeaf(ctx context.Context, header *pmtilesHeader, entry pmtilesEntry) ([]pmtilesEntry, error) {
+	if leaf, ok := t.leaves.Get(entry.offset); ok {
+		return leaf, nil
+	}
+
+	data, err := t.reader.ReadRange(ctx, header.leafOffset+entry.offset, entry.length)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := parsePmtilesDirectory(data, header.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	t.leaves.Set(entry.offset, leaf)
+
+	return leaf, nil
+}
+
+func parsePmtilesHeader(data []byte) (*pmtilesHeader, error) {
+	if len(data) < pmtilesHeaderLength || string(data[0:7]) != "PMTiles" {
+		return nil, errors.New("not a pmtiles archive")
+	}
+
+	if data[7] != 3 {
+		return nil, fmt.Errorf("unsupported pmtiles version %v", data[7])
+	}
+
+	h := pmtilesHeader{
+		rootOffset:          binary.LittleEndian.Uint64(data[8:16]),
+		rootLength:          binary.LittleEndian.Uint64(data[16:24]),
+		leafOffset:          binary.LittleEndian.Uint64(data[40:48]),
+		tileDataOffset:      binary.LittleEndian.Uint64(data[56:64]),
+		internalCompression: data[97],
+		tileCompression:     data[98],
+		tileType:            data[99],
+		minZoom:             data[100],
+		maxZoom:             data[101],
+	}
+
+	if h.internalCompression != pmtilesCompressionNone && h.internalCompression != pmtilesCompressionGzip {
+		return nil, fmt.Errorf("unsupported pmtiles directory compression %v", h.internalCompression)
+	}
+
+	if h.tileCompression != pmtilesCompressionUnknown && h.tileCompression != pmtilesCompressionNone && h.tileCompression != pmtilesCompressionGzip {
+		return nil, fmt.Errorf("unsupported pmtiles tile compression %v", h.tileCompression)
+	}
+
+	return &h, nil
+}
+
+func parsePmtilesDirectory(data []byte, compression uint8) ([]pmtilesEntry, error) {
+	data, err := pmtilesDecompress(data, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(data)
+
+	numEntries, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every entry takes at least four bytes, this keeps a corrupt count from allocating wildly
+	if numEntries > uint64(len(data)) {
+		return nil, errors.New("invalid pmtiles directory")
+	}
+
+	entries := make([]pmtilesEntry, numEntries)
+
+	// Each column is stored in turn. Tile IDs are deltas from the previous entry
+	lastID := uint64(0)
+	for i := range entries {
+		v, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		lastID += v
+		entries[i].tileID = lastID
+	}
+
+	for i := range entries {
+		entries[i].runLength, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range entries {
+		entries[i].length, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// An offset of 0 means the entry directly follows the previous one, otherwise it's stored plus one
+	for i := range entries {
+		v, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if v == 0 && i > 0 {
+			entries[i].offset = entries[i-1].offset + entries[i-1].length
+		} else {
+			entries[i].offset = v - 1
+		}
+	}
+
+	return entries, nil
+}
+
+func pmtilesDecompress(data []byte, compression uint8) ([]byte, error) {
+	if compression != pmtilesCompressionGzip {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// findPmtilesEntry finds the entry covering tileID: either the tile itself, a run of identical
+// tiles containing it, or the leaf directory it lives in
+func findPmtilesEntry(entries []pmtilesEntry, tileID uint64) (pmtilesEntry, bool) {
+	// Index of the first entry past tileID, the one before it is the only candidate
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].tileID > tileID })
+
+	if i == 0 {
+		return pmtilesEntry{}, false
+	}
+
+	entry := entries[i-1]
+
+	if entry.runLength == 0 || tileID-entry.tileID < entry.runLength {
+		return entry, true
+	}
+
+	return pmtilesEntry{}, false
+}
+
+// pmtilesTileID orders tiles by zoom then by their position along a Hilbert curve, which is how
+// PMTiles keys its directories
+func pmtilesTileID(z int, x int, y int) uint64 {
+	// The number of tiles in all lower zoom levels
+	id := ((uint64(1) << (2 * uint(z))) - 1) / 3 // #nosec G115 -- zoom is validated
+
+	n := uint64(1) << uint(z)      // #nosec G115 -- zoom is validated
+	tx, ty := uint64(x), uint64(y) // #nosec G115 -- coordinates are validated
+
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if tx&s > 0 {
+			rx = 1
+		}
+		if ty&s > 0 {
+			ry = 1
+		}
+
+		id += s * s * ((3 * rx) ^ ry)
+
+		if ry == 0 {
+			if rx == 1 {
+				tx = n - 1 - tx
+				ty = n - 1 - ty
+			}
+			tx, ty = ty, tx
+		}
+	}
+
+	return id
+}
@@ -0,0 +1,195 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/internal/images"
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePmtilesDirectory(entries []pmtilesEntry) []byte {
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+
+	lastID := uint64(0)
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.tileID-lastID)
+		lastID = e.tileID
+	}
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.runLength)
+	}
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.length)
+	}
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.offset+1)
+	}
+
+	return buf
+}
+
+// makePmtiles builds an uncompressed png archive. The z1 tiles are reached through a leaf
+// directory to cover both levels of lookup
+func makePmtiles(t *testing.T, tile []byte) []byte {
+	t.Helper()
+
+	leaf := encodePmtilesDirectory([]pmtilesEntry{
+		{tileID: pmtilesTileID(1, 0, 0), offset: 0, length: uint64(len(tile)), runLength: 2},
+	})
+	root := encodePmtilesDirectory([]pmtilesEntry{
+		{tileID: pmtilesTileID(0, 0, 0), offset: 0, length: uint64(len(tile)), runLength: 1},
+		{tileID: pmtilesTileID(1, 0, 0), offset: 0, length: uint64(len(leaf)), runLength: 0},
+	})
+
+	header := make([]byte, pmtilesHeaderLength)
+	copy(header, "PMTiles")
+	header[7] = 3
+	rootOffset := uint64(pmtilesHeaderLength)
+	leafOffset := rootOffset + uint64(len(root))
+	tileOffset := leafOffset + uint64(len(leaf))
+	binary.LittleEndian.PutUint64(header[8:], rootOffset)
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(root)))
+	binary.LittleEndian.PutUint64(header[40:], leafOffset)
+	binary.LittleEndian.PutUint64(header[48:], uint64(len(leaf)))
+	binary.LittleEndian.PutUint64(header[56:], tileOffset)
+	binary.LittleEndian.PutUint64(header[64:], uint64(len(tile)))
+	header[97] = pmtilesCompressionNone
+	header[98] = pmtilesCompressionNone
+	header[99] = 2
+	header[100] = 0
+	header[101] = 2
+
+	return bytes.Join([][]byte{header, root, leaf, tile}, nil)
+}
+
+func Test_PMTiles_TileID(t *testing.T) {
+	assert.Equal(t, uint64(0), pmtilesTileID(0, 0, 0))
+	assert.Equal(t, uint64(1), pmtilesTileID(1, 0, 0))
+	assert.Equal(t, uint64(2), pmtilesTileID(1, 0, 1))
+	assert.Equal(t, uint64(3), pmtilesTileID(1, 1, 1))
+	assert.Equal(t, uint64(4), pmtilesTileID(1, 1, 0))
+	assert.Equal(t, uint64(5), pmtilesTileID(2, 0, 0))
+	assert.Equal(t, uint64(19078479), pmtilesTileID(12, 3423, 1763))
+}
+
+func Test_PMTiles_Validate(t *testing.T) {
+	p, err := PMTilesRegistration{}.Initialize(PMTilesConfig{}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	assert.Nil(t, p)
+	require.Error(t, err)
+
+	p, err = PMTilesRegistration{}.Initialize(PMTilesConfig{File: "a", URL: "b"}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	assert.Nil(t, p)
+	require.Error(t, err)
+
+	p, err = PMTilesRegistration{}.Initialize(PMTilesConfig{File: filepath.Join(t.TempDir(), "missing.pmtiles")}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	assert.Nil(t, p)
+	require.Error(t, err)
+}
+
+func checkPmtilesArchive(t *testing.T, p layer.Provider, red []byte) {
+	t.Helper()
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, red, img.Content)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	// In the run inside the leaf
+	img, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, red, img.Content)
+
+	// Past the end of the run
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+
+	// Above the max zoom
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 5, X: 1, Y: 1})
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+}
+
+func Test_PMTiles_ExecuteFile(t *testing.T) {
+	red, err := images.GetStaticImage(images.KeyImageRed)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "test.pmtiles")
+	require.NoError(t, os.WriteFile(path, makePmtiles(t, *red), 0600))
+
+	p, err := PMTilesRegistration{}.Initialize(PMTilesConfig{File: path}, layer.ProviderDeps{ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+	defer p.(*PMTiles).Close(context.Background())
+
+	checkPmtilesArchive(t, p, *red)
+}
+
+func Test_PMTiles_ExecuteHTTP(t *testing.T) {
+	red, err := images.GetStaticImage(images.KeyImageRed)
+	require.NoError(t, err)
+
+	archive := makePmtiles(t, *red)
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "test.pmtiles", time.Time{}, bytes.NewReader(archive))
+	}))
+	defer srv.Close()
+
+	p, err := PMTilesRegistration{}.Initialize(PMTilesConfig{URL: srv.URL}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	checkPmtilesArchive(t, p, *red)
+
+	// Header, root, and leaf are only read once
+	before := requests
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, before+1, requests)
+}
+
+// A server that ignores the Range header sends the whole archive back with a 200, which mustn't
+// be mistaken for the bytes that were asked for
+func Test_PMTiles_HTTPRequiresRangeSupport(t *testing.T) {
+	red, err := images.GetStaticImage(images.KeyImageRed)
+	require.NoError(t, err)
+
+	archive := makePmtiles(t, *red)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	p, err := PMTilesRegistration{}.Initialize(PMTilesConfig{URL: srv.URL}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	var remoteErr *pkg.RemoteServerError
+	require.ErrorAs(t, err, &remoteErr)
+}
@@ -0,0 +1,714 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/anthonynsimon/bild/parallel"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+)
+
+// How a tile relates to a mask
+type maskRelation int
+
+const (
+	maskOutside maskRelation = iota
+	maskPartial
+	maskInside
+)
+
+// maskEdge is one side of a ring, from the first point to the second
+type maskEdge [2]orb.Point
+
+// polygonMask is an area made up of polygons, filled with the even-odd rule so holes and
+// overlapping polygons cancel out. It's held in web mercator scaled to the unit square, with y
+// increasing southward the same as tile rows, so a tile's area within it is a simple scale away
+type polygonMask struct {
+	edges []maskEdge
+	index *spatialIndex
+	bound orb.Bound
+}
+
+// loadPolygonMask reads a mask given either inline as GeoJSON in the config, under param, or in
+// a GeoJSON file, under param with a "file" suffix. Neither being set gives no mask
+func loadPolygonMask(inline map[string]interface{}, file string, param string, deps layer.ProviderDeps) (*polygonMask, error) {
+	if inline == nil && file == "" {
+		return nil, nil
+	}
+
+	if inline != nil && file != "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamsMutuallyExclusive, param, param+"file")
+	}
+
+	if file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		mask, err := parsePolygonMask(content)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %v: %w", file, err)
+		}
+
+		return mask, nil
+	}
+
+	content, err := json.Marshal(inline)
+	if err != nil {
+		return nil, err
+	}
+
+	mask, err := parsePolygonMask(content)
+	if err != nil {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, param, err)
+	}
+
+	return mask, nil
+}
+
+// parsePolygonMask reads a mask from GeoJSON, which may be a geometry, a feature or a feature
+// collection. Everything in it must be a polygon or multipolygon
+func parsePolygonMask(content []byte) (*polygonMask, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, err
+	}
+
+	var geometries []orb.Geometry
+
+	switch header.Type {
+	case "FeatureCollection":
+		fc, err := geojson.UnmarshalFeatureCollection(content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fc.Features {
+			geometries = append(geometries, f.Geometry)
+		}
+	case "Feature":
+		f, err := geojson.UnmarshalFeature(content)
+		if err != nil {
+			return nil, err
+		}
+
+		geometries = append(geometries, f.Geometry)
+	default:
+		g, err := geojson.UnmarshalGeometry(content)
+		if err != nil {
+			return nil, err
+		}
+
+		geometries = append(geometries, g.Geometry())
+	}
+
+	rings := make([]orb.Ring, 0)
+	for _, g := range geometries {
+		if err := collectMaskRings(g, &rings); err != nil {
+			return nil, err
+		}
+	}
+
+	return newPolygonMask(rings)
+}
+
+func collectMaskRings(g orb.Geometry, rings *[]orb.Ring) error {
+	switch g := g.(type) {
+	case orb.Polygon:
+		*rings = append(*rings, g...)
+	case orb.MultiPolygon:
+		for _, p := range g {
+			*rings = append(*rings, p...)
+		}
+	case orb.Collection:
+		for _, child := range g {
+			if err := collectMaskRings(child, rings); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		return fmt.Errorf("mask must be made of polygons but contains a %v", g.GeoJSONType())
+	}
+
+	return nil
+}
+
+// newPolygonMask builds a mask from rings in longitude and latitude
+func newPolygonMask(rings []orb.Ring) (*polygonMask, error) {
+	m := &polygonMask{}
+	bounds := make([]orb.Bound, 0)
+
+	for _, r := range rings {
+		for i := range r {
+			e := maskEdge{unitMercator(r[i]), unitMercator(r[(i+1)%len(r)])}
+
+			// Closed rings repeat their first point at the end
+			if e[0] == e[1] {
+				continue
+			}
+
+			m.edges = append(m.edges, e)
+			bounds = append(bounds, orb.MultiPoint(e[:]).Bound())
+		}
+	}
+
+	if len(m.edges) == 0 {
+		return nil, errors.New("mask has no area")
+	}
+
+	m.index = newSpatialIndex(bounds)
+	m.bound = bounds[0]
+	for _, b := range bounds[1:] {
+		m.bound = m.bound.Union(b)
+	}
+
+	return m, nil
+}
+
+// unitMercator projects a longitude and latitude into web mercator scaled so the world spans 0 to 1
+func unitMercator(p orb.Point) orb.Point {
+	lat := math.Max(math.Min(p.Lat(), 85.0511287798), -85.0511287798) * math.Pi / 180
+	sin := math.Sin(lat)
+
+	return orb.Point{(p.Lon() + 180) / 360, 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)}
+}
+
+// unitTileBound is the area of a tile in the same space as the mask
+func unitTileBound(tileRequest pkg.TileRequest) orb.Bound {
+	n := float64(int(1) << tileRequest.Z)
+	x, y := float64(tileRequest.X), float64(tileRequest.Y)
+
+	return orb.Bound{Min: orb.Point{x / n, y / n}, Max: orb.Point{(x + 1) / n, (y + 1) / n}}
+}
+
+// contains reports whether a point, in the mask's space, falls inside by counting the edges
+// crossed by a ray from it towards the east
+func (m *polygonMask) contains(p orb.Point) bool {
+	inside := false
+
+	for _, i := range m.index.search(orb.Bound{Min: p, Max: orb.Point{math.Inf(1), p[1]}}) {
+		if x, ok := m.edges[i].crossingAt(p[1]); ok && x > p[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// crossingAt gives where the edge crosses a horizontal line. An edge touching the line at its
+// lower end counts but one touching it at its upper end doesn't, so a line through a vertex
+// shared by two edges crosses exactly one of them
+func (e maskEdge) crossingAt(y float64) (float64, bool) {
+	a, b := e[0], e[1]
+	if (a[1] > y) == (b[1] > y) {
+		return 0, false
+	}
+
+	return a[0] + (y-a[1])*(b[0]-a[0])/(b[1]-a[1]), true
+}
+
+// relate works out whether a tile is fully inside the mask, fully outside it, or crossed by its
+// edge
+func (m *polygonMask) relate(tileRequest pkg.TileRequest) maskRelation {
+	tile := unitTileBound(tileRequest)
+
+	if !m.bound.Intersects(tile) {
+		return maskOutside
+	}
+
+	for _, i := range m.index.search(tile) {
+		if segmentIntersectsBound(m.edges[i], tile) {
+			return maskPartial
+		}
+	}
+
+	// Nothing crosses the tile so any point in it stands for the whole tile
+	return pkg.Ternary(m.contains(tile.Center()), maskInside, maskOutside)
+}
+
+// segmentIntersectsBound clips the segment to the bound, using Liang-Barsky, to see if any of it
+// is left
+func segmentIntersectsBound(e maskEdge, bound orb.Bound) bool {
+	a := e[0]
+	dx, dy := e[1][0]-a[0], e[1][1]-a[1]
+	t0, t1 := 0.0, 1.0
+
+	for _, pq := range [4][2]float64{{-dx, a[0] - bound.Min[0]}, {dx, bound.Max[0] - a[0]}, {-dy, a[1] - bound.Min[1]}, {dy, bound.Max[1] - a[1]}} {
+		p, q := pq[0], pq[1]
+		if p == 0 {
+			if q < 0 {
+				return false
+			}
+			continue
+		}
+
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return false
+			}
+			t0 = max(t0, r)
+		} else {
+			if r < t0 {
+				return false
+			}
+			t1 = min(t1, r)
+		}
+	}
+
+	return true
+}
+
+// rasterize gives a mask of the pixels of a tile whose centers are inside, opaque inside and
+// transparent outside
+func (m *polygonMask) rasterize(tileRequest pkg.TileRequest, width int, height int) *image.Alpha {
+	out := image.NewAlpha(image.Rect(0, 0, width, height))
+	n := float64(int(1) << tileRequest.Z)
+
+	parallel.Line(height, func(start, end int) {
+		xs := make([]float64, 0)
+
+		for row := start; row < end; row++ {
+			y := (float64(tileRequest.Y) + (float64(row)+0.5)/float64(height)) / n
+
+			xs = xs[:0]
+			for _, i := range m.index.search(orb.Bound{Min: orb.Point{math.Inf(-1), y}, Max: orb.Point{math.Inf(1), y}}) {
+				if x, ok := m.edges[i].crossingAt(y); ok {
+					xs = append(xs, (x*n-float64(tileRequest.X))*float64(width))
+				}
+			}
+			slices.Sort(xs)
+
+			// Each pair of crossings bounds a span inside the mask
+			for k := 0; k+1 < len(xs); k += 2 {
+				from := max(int(math.Ceil(xs[k]-0.5)), 0)
+				to := min(int(math.Ceil(xs[k+1]-0.5)), width)
+
+				for x := from; x < to; x++ {
+					out.Pix[row*out.Stride+x] = 255
+				}
+			}
+		}
+	})
+
+	return out
+}
+
+// clipLayers cuts the features of a vector tile down to the parts inside the mask, or outside it
+// if inside is false. Layers left without features are dropped
+func (m *polygonMask) clipLayers(layers mvt.Layers, tileRequest pkg.TileRequest, inside bool) mvt.Layers {
+	n := float64(int(1) << tileRequest.Z)
+	tx, ty := float64(tileRequest.X), float64(tileRequest.Y)
+	result := make(mvt.Layers, 0, len(layers))
+
+	for _, l := range layers {
+		extent := float64(mvtExtent(l))
+		toMask := func(p orb.Point) orb.Point { return orb.Point{(p[0]/extent + tx) / n, (p[1]/extent + ty) / n} }
+		toTile := func(p orb.Point) orb.Point { return orb.Point{(p[0]*n - tx) * extent, (p[1]*n - ty) * extent} }
+		keep := func(p orb.Point) bool { return m.contains(toMask(p)) == inside }
+
+		features := l.Features[:0]
+		for _, f := range l.Features {
+			if f.Geometry == nil {
+				continue
+			}
+
+			bound := f.Geometry.Bound()
+			nearby := m.index.search(orb.Bound{Min: toMask(bound.Min), Max: toMask(bound.Max)})
+
+			var g orb.Geometry
+			if len(nearby) == 0 {
+				// The edge of the mask doesn't pass through the feature, so it's all in or all out
+				g = pkg.Ternary(keep(bound.Center()), f.Geometry, nil)
+			} else {
+				edges := make([]maskEdge, len(nearby))
+				for i, e := range nearby {
+					edges[i] = maskEdge{toTile(m.edges[e][0]), toTile(m.edges[e][1])}
+				}
+
+				g = clipGeometry(f.Geometry, edges, keep)
+			}
+
+			if g != nil {
+				f.Geometry = g
+				features = append(features, f)
+			}
+		}
+		l.Features = features
+
+		transformMVTLayer(l, func(p orb.Point) orb.Point { return p })
+		l.RemoveEmpty(1, 1)
+
+		if len(l.Features) > 0 {
+			result = append(result, l)
+		}
+	}
+
+	return result
+}
+
+// clipGeometry keeps the parts of a geometry where keep is true, given the edges of the mask
+// around it. It returns nil if nothing is left
+func clipGeometry(g orb.Geometry, edges []maskEdge, keep func(orb.Point) bool) orb.Geometry {
+	switch g := g.(type) {
+	case orb.Point:
+		return pkg.Ternary[orb.Geometry](keep(g), g, nil)
+	case orb.MultiPoint:
+		points := slices.DeleteFunc(g, func(p orb.Point) bool { return !keep(p) })
+		return pkg.Ternary[orb.Geometry](len(points) > 0, points, nil)
+	case orb.LineString:
+		return toLineGeometry(clipLine(g, edges, keep))
+	case orb.MultiLineString:
+		lines := make([]orb.LineString, 0)
+		for _, ls := range g {
+			lines = append(lines, clipLine(ls, edges, keep)...)
+		}
+		return toLineGeometry(lines)
+	case orb.Polygon:
+		return toPolygonGeometry(clipPolygon(g, edges, keep))
+	case orb.MultiPolygon:
+		rings := make([]orb.Ring, 0)
+		for _, p := range g {
+			rings = append(rings, p...)
+		}
+		return toPolygonGeometry(clipPolygon(rings, edges, keep))
+	}
+
+	return g
+}
+
+func toLineGeometry(lines []orb.LineString) orb.Geometry {
+	switch len(lines) {
+	case 0:
+		return nil
+	case 1:
+		return lines[0]
+	}
+
+	return orb.MultiLineString(lines)
+}
+
+func toPolygonGeometry(polygons []orb.Polygon) orb.Geometry {
+	switch len(polygons) {
+	case 0:
+		return nil
+	case 1:
+		return polygons[0]
+	}
+
+	return orb.MultiPolygon(polygons)
+}
+
+func clipLine(ls orb.LineString, edges []maskEdge, keep func(orb.Point) bool) []orb.LineString {
+	segments := make([]maskEdge, 0, len(ls))
+	for i := 1; i < len(ls); i++ {
+		segments = append(segments, maskEdge{ls[i-1], ls[i]})
+	}
+
+	pieces, _ := splitEdges(segments, edges)
+
+	lines := make([]orb.LineString, 0)
+	var current orb.LineString
+
+	for _, p := range pieces {
+		if !keep(midpoint(p)) {
+			if len(current) > 1 {
+				lines = append(lines, current)
+			}
+			current = nil
+			continue
+		}
+
+		if len(current) > 0 && current[len(current)-1] == p[0] {
+			current = append(current, p[1])
+		} else {
+			if len(current) > 1 {
+				lines = append(lines, current)
+			}
+			current = orb.LineString{p[0], p[1]}
+		}
+	}
+
+	if len(current) > 1 {
+		lines = append(lines, current)
+	}
+
+	return lines
+}
+
+// clipPolygon finds the area of the rings, filled even-odd, where keep is true. The outline of
+// the result is made of the pieces of the rings that are kept and the pieces of the mask's edge
+// that fall within the rings, which are then joined back up into rings
+func clipPolygon(rings []orb.Ring, edges []maskEdge, keep func(orb.Point) bool) []orb.Polygon {
+	subject := make([]maskEdge, 0)
+	for _, r := range rings {
+		for i := range r {
+			e := maskEdge{r[i], r[(i+1)%len(r)]}
+			if e[0] != e[1] {
+				subject = append(subject, e)
+			}
+		}
+	}
+
+	subjectPieces, maskPieces := splitEdges(subject, edges)
+
+	inSubject := func(p orb.Point) bool {
+		inside := false
+		for _, e := range subject {
+			if x, ok := e.crossingAt(p[1]); ok && x > p[0] {
+				inside = !inside
+			}
+		}
+		return inside
+	}
+
+	outline := make([]maskEdge, 0)
+	for _, p := range subjectPieces {
+		if keep(midpoint(p)) {
+			outline = append(outline, p)
+		}
+	}
+	for _, p := range maskPieces {
+		if inSubject(midpoint(p)) {
+			outline = append(outline, p)
+		}
+	}
+
+	return assemblePolygons(joinRings(outline))
+}
+
+func midpoint(e maskEdge) orb.Point {
+	return orb.Point{(e[0][0] + e[1][0]) / 2, (e[0][1] + e[1][1]) / 2}
+}
+
+// splitEdges cuts both sets of edges at every point where an edge of one crosses an edge of the
+// other. Each crossing point is shared exactly by the pieces on either side so they can be joined
+// back together
+func splitEdges(subject []maskEdge, clip []maskEdge) ([]maskEdge, []maskEdge) {
+	type cut struct {
+		t float64
+		p orb.Point
+	}
+
+	subjectCuts := make([][]cut, len(subject))
+	clipCuts := make([][]cut, len(clip))
+
+	for i, s := range subject {
+		sBound := orb.MultiPoint(s[:]).Bound()
+
+		for j, c := range clip {
+			if !sBound.Intersects(orb.MultiPoint(c[:]).Bound()) {
+				continue
+			}
+
+			r := orb.Point{s[1][0] - s[0][0], s[1][1] - s[0][1]}
+			q := orb.Point{c[1][0] - c[0][0], c[1][1] - c[0][1]}
+			denom := r[0]*q[1] - r[1]*q[0]
+			if denom == 0 {
+				continue
+			}
+
+			w := orb.Point{c[0][0] - s[0][0], c[0][1] - s[0][1]}
+			t := (w[0]*q[1] - w[1]*q[0]) / denom
+			u := (w[0]*r[1] - w[1]*r[0]) / denom
+			if t < 0 || t > 1 || u < 0 || u > 1 {
+				continue
+			}
+
+			p := orb.Point{s[0][0] + t*r[0], s[0][1] + t*r[1]}
+			subjectCuts[i] = append(subjectCuts[i], cut{t, p})
+			clipCuts[j] = append(clipCuts[j], cut{u, p})
+		}
+	}
+
+	pieces := func(edges []maskEdge, cuts [][]cut) []maskEdge {
+		result := make([]maskEdge, 0, len(edges))
+
+		for i, e := range edges {
+			slices.SortFunc(cuts[i], func(a, b cut) int { return cmp.Compare(a.t, b.t) })
+
+			prev := e[0]
+			for _, c := range cuts[i] {
+				if c.p != prev {
+					result = append(result, maskEdge{prev, c.p})
+					prev = c.p
+				}
+			}
+
+			if prev != e[1] {
+				result = append(result, maskEdge{prev, e[1]})
+			}
+		}
+
+		return result
+	}
+
+	return pieces(subject, subjectCuts), pieces(clip, clipCuts)
+}
+
+// joinRings chains edges that share end points into closed rings. Chains that can't be closed are
+// dropped
+func joinRings(edges []maskEdge) []orb.Ring {
+	byPoint := make(map[orb.Point][]int, len(edges)*2)
+	for i, e := range edges {
+		byPoint[e[0]] = append(byPoint[e[0]], i)
+		byPoint[e[1]] = append(byPoint[e[1]], i)
+	}
+
+	used := make([]bool, len(edges))
+	rings := make([]orb.Ring, 0)
+
+	for i, e := range edges {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+
+		ring := orb.Ring{e[0], e[1]}
+		closed := false
+
+		for current := e[1]; ; {
+			if current == e[0] {
+				closed = true
+				break
+			}
+
+			next := -1
+			for _, j := range byPoint[current] {
+				if !used[j] {
+					next = j
+					break
+				}
+			}
+
+			if next < 0 {
+				break
+			}
+
+			used[next] = true
+			current = pkg.Ternary(edges[next][0] == current, edges[next][1], edges[next][0])
+			ring = append(ring, current)
+		}
+
+		if closed && len(ring) >= 4 {
+			rings = append(rings, ring)
+		}
+	}
+
+	return rings
+}
+
+// assemblePolygons sorts rings into polygons by how deeply each is nested in the others. Rings
+// inside an even number of others are exteriors and the rest are holes in the smallest ring around
+// them. Rings are wound the way vector tiles expect: exteriors with a positive area, in tile
+// coordinates, and holes negative
+func assemblePolygons(rings []orb.Ring) []orb.Polygon {
+	areas := make([]float64, len(rings))
+	for i, r := range rings {
+		areas[i] = signedArea(r)
+	}
+
+	polygons := make([]orb.Polygon, 0)
+	polygonOf := make(map[int]int)
+	parents := make([]int, len(rings))
+	depths := make([]int, len(rings))
+
+	for i, r := range rings {
+		parents[i] = -1
+		if areas[i] == 0 {
+			continue
+		}
+
+		point := midpoint(maskEdge{r[0], r[1]})
+		for j, other := range rings {
+			if i == j || areas[j] == 0 || !ringContains(other, point) {
+				continue
+			}
+
+			depths[i]++
+			if parents[i] < 0 || math.Abs(areas[j]) < math.Abs(areas[parents[i]]) {
+				parents[i] = j
+			}
+		}
+	}
+
+	for i, r := range rings {
+		if areas[i] == 0 || depths[i]%2 == 1 {
+			continue
+		}
+
+		if areas[i] < 0 {
+			r.Reverse()
+		}
+
+		polygonOf[i] = len(polygons)
+		polygons = append(polygons, orb.Polygon{r})
+	}
+
+	for i, r := range rings {
+		if areas[i] == 0 || depths[i]%2 == 0 {
+			continue
+		}
+
+		p, ok := polygonOf[parents[i]]
+		if !ok {
+			continue
+		}
+
+		if areas[i] > 0 {
+			r.Reverse()
+		}
+
+		polygons[p] = append(polygons[p], r)
+	}
+
+	return polygons
+}
+
+func signedArea(r orb.Ring) float64 {
+	area := 0.0
+	for i := range len(r) - 1 {
+		area += r[i][0]*r[i+1][1] - r[i+1][0]*r[i][1]
+	}
+
+	return area / 2
+}
+
+func ringContains(r orb.Ring, p orb.Point) bool {
+	inside := false
+	for i := range len(r) - 1 {
+		if x, ok := (maskEdge{r[i], r[i+1]}).crossingAt(p[1]); ok && x > p[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
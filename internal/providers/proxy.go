@@ -17,21 +17,57 @@ package providers
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/sync/singleflight"
 )
 
+// How a mirror is chosen for each tile
+const (
+	proxySelectionRoundRobin = "round-robin"
+	proxySelectionHash       = "hash"
+)
+
+var allProxySelections = []string{proxySelectionRoundRobin, proxySelectionHash}
+
+var defaultSubdomains = []string{"a", "b", "c"}
+
 type ProxyConfig struct {
-	URL     string
-	InvertY bool // Used for TMS
-	Srid    uint
+	URL        string
+	URLs       []string // Mirrors serving the same tiles, used instead of URL
+	Selection  string   // How a mirror is chosen for each tile, either round-robin or hash
+	Subdomains []string // Values for the {s} placeholder
+	InvertY    bool     // Used for TMS
+	Srid       uint
+	Width      uint16 // The width of a single tile in pixels, used for the {width} placeholder
+	Height     uint16 // The height of a single tile in pixels, used for the {height} placeholder
+	Metatile   uint16 // Fetch blocks of Metatile x Metatile tiles in a single request. 0 or 1 to request tiles individually
+	// Consecutive failures before a mirror is taken out of rotation
+	MaxFailures uint
+	// Seconds a mirror stays out of rotation once it reaches MaxFailures
+	Cooldown uint
+	// Authenticates with a bearer token from an OAuth2 server. nil to make requests without one
+	OAuth2 *OAuth2Config
 }
 
 type Proxy struct {
 	ProxyConfig
 	clientConfig config.ClientConfig
+	// Where the rest of a metatile is saved. nil when nested in another provider, since the layer's
+	// cache holds that provider's output rather than this one's
+	layerGroup *layer.LayerGroup
+	// Collapses concurrent requests for tiles in the same metatile into a single upstream request
+	metatileFlight *singleflight.Group
+	mirrors        *proxyMirrors
+	// nil if OAuth2 isn't configured
+	oauth2 *clientcredentials.Config
 }
 
 func init() {
@@ -51,7 +87,10 @@ func (s ProxyRegistration) Name() string {
 
 func (s ProxyRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
 	cfg := cfgAny.(ProxyConfig)
-	if cfg.URL == "" {
+	if cfg.URL != "" && len(cfg.URLs) > 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamsMutuallyExclusive, "provider.proxy.url", "provider.proxy.urls")
+	}
+	if cfg.URL == "" && len(cfg.URLs) == 0 {
 		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.proxy.url", "")
 	}
 
@@ -62,18 +101,173 @@ func (s ProxyRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (laye
 		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.proxy.srid", cfg.Srid, []int{pkg.SRIDPsuedoMercator, pkg.SRIDWGS84})
 	}
 
-	return &Proxy{cfg, deps.ClientConfig}, nil
+	return newProxy(cfg, deps, "provider.proxy")
 }
 
-func (t Proxy) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
-	return layer.ProviderContext{AuthBypass: true}, nil
+// newProxy applies the defaults and validation shared by proxy and url template. paramPrefix is
+// used to name the parameters in errors
+func newProxy(cfg ProxyConfig, deps layer.ProviderDeps, paramPrefix string) (*Proxy, error) {
+	if cfg.Width == 0 {
+		cfg.Width = 256
+	}
+
+	if cfg.Height == 0 {
+		cfg.Height = 256
+	}
+
+	if cfg.Selection == "" {
+		cfg.Selection = proxySelectionRoundRobin
+	}
+	if !slices.Contains(allProxySelections, cfg.Selection) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, paramPrefix+".selection", cfg.Selection, allProxySelections)
+	}
+
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = 3
+	}
+
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = 30
+	}
+
+	if cfg.Metatile > maxMetatile {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, paramPrefix+".metatile", 0, maxMetatile)
+	}
+
+	// Blocks only line up with the tile grid at every zoom when the size is a power of two
+	if cfg.Metatile&(cfg.Metatile-1) != 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, paramPrefix+".metatile", cfg.Metatile, []int{0, 1, 2, 4, 8, 16})
+	}
+
+	urls := cfg.URLs
+	if cfg.URL != "" {
+		urls = []string{cfg.URL}
+	}
+
+	for i, url := range urls {
+		if url == "" {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, paramPrefix+".urls["+strconv.Itoa(i)+"]", "")
+		}
+
+		if cfg.Subdomains == nil && strings.Contains(url, "{s}") {
+			cfg.Subdomains = defaultSubdomains
+		}
+
+		if cfg.Metatile > 1 {
+			for _, placeholder := range metatileBoundsPlaceholders {
+				if !strings.Contains(url, placeholder) {
+					return nil, fmt.Errorf("%v requires the url to include the bounding box placeholders %v", paramPrefix+".metatile", metatileBoundsPlaceholders)
+				}
+			}
+		}
+	}
+
+	oauth2, err := newOAuth2(cfg.OAuth2, deps, paramPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrors := newProxyMirrors(urls, cfg.Selection == proxySelectionHash, cfg.MaxFailures, time.Duration(cfg.Cooldown)*time.Second)
+
+	layerGroup := deps.LayerGroup
+	if deps.Nested() {
+		layerGroup = nil
+	}
+
+	return &Proxy{cfg, deps.ClientConfig, layerGroup, &singleflight.Group{}, mirrors, oauth2}, nil
+}
+
+func (t Proxy) PreAuth(ctx context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	if t.oauth2 == nil {
+		return layer.ProviderContext{AuthBypass: true}, nil
+	}
+
+	return fetchOAuth2Token(ctx, t.clientConfig, t.oauth2)
+}
+
+func (t Proxy) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	headers := oauth2Headers(providerContext)
+
+	if t.Metatile > 1 && tileRequest.Z > 0 {
+		img, err := t.generateMetatile(ctx, tileRequest, headers)
+		return img, oauth2Error(t.oauth2, err)
+	}
+
+	img, err := t.mirrors.fetch(ctx, t.clientConfig, tileRequest, headers, func(rawURL string) (string, error) {
+		return replaceURLPlaceholders(ctx, tileRequest, t.sizedURL(rawURL, 1), t.InvertY, t.Srid, t.Subdomains)
+	})
+
+	return img, oauth2Error(t.oauth2, err)
+}
+
+// sizedURL fills in the size placeholders of a URL for an image spanning size x size tiles
+func (t Proxy) sizedURL(rawURL string, size int) string {
+	url := strings.ReplaceAll(rawURL, "{width}", strconv.Itoa(int(t.Width)*size))
+	return strings.ReplaceAll(url, "{height}", strconv.Itoa(int(t.Height)*size))
 }
 
-func (t Proxy) GenerateTile(ctx context.Context, _ layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
-	url, err := replaceURLPlaceholders(ctx, tileRequest, t.URL, t.InvertY, t.Srid)
+// generateMetatile requests the whole block of tiles containing tileRequest as one image and slices
+// it up. The tile asked for is returned and the rest are written to the layer's cache
+func (t Proxy) generateMetatile(ctx context.Context, tileRequest pkg.TileRequest, headers map[string]string) (*pkg.Image, error) {
+	origin, size := metatileBlock(tileRequest, int(t.Metatile))
+
+	bounds, err := metatileBounds(origin, size, t.Srid)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bounds are swapped in before the rest of the placeholders so they cover the whole block
+	// rather than the tile at its origin
+	blockURL := func(rawURL string) (string, error) {
+		rawURL = t.sizedURL(rawURL, size)
+		rawURL = strings.ReplaceAll(rawURL, "{xmin}", fmt.Sprintf("%f", bounds.West))
+		rawURL = strings.ReplaceAll(rawURL, "{xmax}", fmt.Sprintf("%f", bounds.East))
+		rawURL = strings.ReplaceAll(rawURL, "{ymin}", fmt.Sprintf("%f", bounds.South))
+		rawURL = strings.ReplaceAll(rawURL, "{ymax}", fmt.Sprintf("%f", bounds.North))
+
+		return replaceURLPlaceholders(ctx, origin, rawURL, t.InvertY, t.Srid, t.Subdomains)
+	}
+
+	// Requests are shared by the URL of the first mirror, whichever mirror ends up answering
+	key, err := blockURL(t.mirrors.urls[0])
 	if err != nil {
 		return nil, err
 	}
 
-	return getTile(ctx, t.clientConfig, url, make(map[string]string))
+	// The request runs detached from any one caller so a client disconnecting doesn't fail the
+	// block for everyone else waiting on it, or stop the rest of the block being cached. The client
+	// timeout still applies
+	detached := context.WithoutCancel(ctx)
+	resultChan := t.metatileFlight.DoChan(origin.String()+" "+key, func() (any, error) {
+		img, err := t.mirrors.fetch(detached, t.clientConfig, origin, headers, blockURL)
+		if err != nil {
+			return nil, err
+		}
+
+		tiles, err := sliceMetatile(img, origin, size)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.layerGroup != nil {
+			for sibling, img := range tiles {
+				if sibling != tileRequest {
+					t.layerGroup.SaveTile(detached, sibling, img)
+				}
+			}
+		}
+
+		return tiles, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-resultChan:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.(map[pkg.TileRequest]*pkg.Image)[tileRequest], nil
+	}
 }
@@ -0,0 +1,163 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+)
+
+// proxyMirrors spreads requests over URLs serving the same tiles and keeps track of which are
+// healthy. Mirrors that fail maxFailures times in a row are skipped until cooldown has passed.
+// It's shared by every copy of a Proxy
+type proxyMirrors struct {
+	urls        []string
+	hash        bool
+	maxFailures uint
+	cooldown    time.Duration
+
+	next atomic.Uint64
+
+	mu sync.Mutex
+	// Consecutive failures of each mirror. Not reset when a mirror comes back after its cooldown,
+	// so a single further failure takes it out again
+	failures  []uint
+	downUntil []time.Time
+}
+
+func newProxyMirrors(urls []string, hash bool, maxFailures uint, cooldown time.Duration) *proxyMirrors {
+	return &proxyMirrors{
+		urls:        urls,
+		hash:        hash,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		failures:    make([]uint, len(urls)),
+		downUntil:   make([]time.Time, len(urls)),
+	}
+}
+
+// order gives the mirrors to try for a tile: the healthy ones, starting from the one selected for
+// the tile. If none are healthy then all of them are tried rather than failing outright
+func (m *proxyMirrors) order(tileRequest pkg.TileRequest) []int {
+	n := len(m.urls)
+
+	var start int
+	if m.hash {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(tileRequest.String()))
+		start = int(hash.Sum32() % uint32(n)) // #nosec G115 -- n is the number of configured urls
+	} else {
+		start = int((m.next.Add(1) - 1) % uint64(n)) // #nosec G115 -- n is the number of configured urls
+	}
+
+	now := time.Now()
+	all := make([]int, 0, n)
+	healthy := make([]int, 0, n)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k := range n {
+		i := (start + k) % n
+		all = append(all, i)
+
+		if !m.downUntil[i].After(now) {
+			healthy = append(healthy, i)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return all
+	}
+
+	return healthy
+}
+
+// record updates the health of a mirror after a request to it
+func (m *proxyMirrors) record(ctx context.Context, i int, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !failed {
+		m.failures[i] = 0
+		return
+	}
+
+	m.failures[i]++
+	if m.failures[i] >= m.maxFailures {
+		if len(m.urls) > 1 && !m.downUntil[i].After(time.Now()) {
+			slog.WarnContext(ctx, fmt.Sprintf("Taking %v out of rotation for %v after %v consecutive failures", pkg.RedactURLForLog(m.urls[i]), m.cooldown, m.failures[i]))
+		}
+
+		m.downUntil[i] = time.Now().Add(m.cooldown)
+	}
+}
+
+// fetch requests the tile from each mirror in turn until one of them works, using urlFor to turn
+// the mirror's URL into the one to call. Errors that aren't the mirror's fault, such as a 404, are
+// returned straight away
+func (m *proxyMirrors) fetch(ctx context.Context, clientConfig config.ClientConfig, tileRequest pkg.TileRequest, authHeaders map[string]string, urlFor func(rawURL string) (string, error)) (*pkg.Image, error) {
+	var err error
+
+	for _, i := range m.order(tileRequest) {
+		var url string
+		url, err = urlFor(m.urls[i])
+		if err != nil {
+			return nil, err
+		}
+
+		var img *pkg.Image
+		img, err = getTile(ctx, clientConfig, url, authHeaders)
+
+		failed := isMirrorFailure(ctx, err)
+		m.record(ctx, i, failed)
+
+		if !failed {
+			return img, err
+		}
+
+		if len(m.urls) > 1 {
+			slog.DebugContext(ctx, fmt.Sprintf("Mirror %v failed: %v", pkg.RedactURLForLog(m.urls[i]), err))
+		}
+	}
+
+	return nil, err
+}
+
+// isMirrorFailure decides whether an error means the mirror itself is having trouble. The server
+// erroring or being unreachable counts, the tile being missing, the layer being over its limits, or
+// the caller giving up doesn't
+func isMirrorFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.As(err, new(pkg.RateLimitError)) {
+		return false
+	}
+
+	var remoteErr *pkg.RemoteServerError
+	if errors.As(err, &remoteErr) {
+		return remoteErr.StatusCode >= http.StatusInternalServerError || remoteErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
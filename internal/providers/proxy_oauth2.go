@@ -0,0 +1,120 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// How long before a token expires to replace it, at most. Keeps tiles already on their way from
+// going out with a token that expires before they arrive
+const oauth2ExpiryMargin = 30 * time.Second
+
+// OAuth2Config gets a token for the remote server using the OAuth2 client credentials flow
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Audience     string // Sent as the audience parameter for servers that require one
+}
+
+// newOAuth2 validates the configuration and returns the client credentials config used to get
+// tokens with it, or nil if OAuth2 isn't configured
+func newOAuth2(cfg *OAuth2Config, deps layer.ProviderDeps, paramPrefix string) (*clientcredentials.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	if cfg.TokenURL == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, paramPrefix+".oauth2.tokenurl")
+	}
+
+	if tokenURL, err := neturl.Parse(cfg.TokenURL); err != nil || tokenURL.Host == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, paramPrefix+".oauth2.tokenurl", cfg.TokenURL)
+	}
+
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, paramPrefix+".oauth2.clientid")
+	}
+
+	var params neturl.Values
+	if cfg.Audience != "" {
+		params = neturl.Values{"audience": {cfg.Audience}}
+	}
+
+	return &clientcredentials.Config{
+		ClientID:       cfg.ClientID,
+		ClientSecret:   cfg.ClientSecret,
+		TokenURL:       cfg.TokenURL,
+		Scopes:         cfg.Scopes,
+		EndpointParams: params,
+	}, nil
+}
+
+// fetchOAuth2Token gets a new token, to be used until shortly before it expires. Tokens that come
+// without an expiration are used until the remote server rejects them
+func fetchOAuth2Token(ctx context.Context, clientConfig config.ClientConfig, credentials *clientcredentials.Config) (layer.ProviderContext, error) {
+	transport, err := pkg.ClientTransport(clientConfig)
+	if err != nil {
+		return layer.ProviderContext{}, err
+	}
+
+	client := &http.Client{Transport: transport, Timeout: time.Duration(clientConfig.Timeout) * time.Second}
+
+	token, err := credentials.Token(context.WithValue(ctx, oauth2.HTTPClient, client))
+	if err != nil {
+		return layer.ProviderContext{}, pkg.ProviderAuthError{Message: "unable to get oauth2 token: " + err.Error()}
+	}
+
+	expiration := time.Now().AddDate(100, 0, 0)
+	if !token.Expiry.IsZero() {
+		expiration = token.Expiry.Add(-min(oauth2ExpiryMargin, time.Until(token.Expiry)/2))
+	}
+
+	return layer.ProviderContext{AuthToken: token.AccessToken, AuthExpiration: expiration}, nil
+}
+
+// oauth2Headers gives the headers to send the token from PreAuth with
+func oauth2Headers(providerContext layer.ProviderContext) map[string]string {
+	if providerContext.AuthToken == "" {
+		return nil
+	}
+
+	return map[string]string{"Authorization": "Bearer " + providerContext.AuthToken}
+}
+
+// oauth2Error turns the remote server rejecting the token into a ProviderAuthError so a new token
+// is fetched and the tile tried again. Errors are left alone when OAuth2 isn't configured, since
+// there's no token to replace
+func oauth2Error(credentials *clientcredentials.Config, err error) error {
+	var remoteErr *pkg.RemoteServerError
+	if credentials != nil && errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusUnauthorized {
+		return pkg.ProviderAuthError{Message: "oauth2 token rejected by the remote server"}
+	}
+
+	return err
+}
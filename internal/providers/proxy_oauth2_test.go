@@ -0,0 +1,182 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer hands out tok1, tok2, ... to the client credentials it expects
+func tokenServer(t *testing.T, issued *atomic.Int32, expiresIn int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "tilegroxy" || secret != "hunter2" || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		assert.Equal(t, "tiles:read", r.Form.Get("scope"))
+		assert.Equal(t, "https://tiles.example.com", r.Form.Get("audience"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"Bearer","expires_in":%d}`, issued.Add(1), expiresIn)
+	}))
+}
+
+// bearerTileServer only serves tiles to requests with the given token
+func bearerTileServer(token *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimePng)
+		_, _ = w.Write([]byte("tile"))
+	}))
+}
+
+func Test_ProxyOAuth2Validate(t *testing.T) {
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+
+	_, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", OAuth2: &OAuth2Config{ClientID: "id"}}, deps)
+	require.ErrorContains(t, err, "oauth2.tokenurl")
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", OAuth2: &OAuth2Config{TokenURL: "not a url", ClientID: "id"}}, deps)
+	require.ErrorContains(t, err, "oauth2.tokenurl")
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", OAuth2: &OAuth2Config{TokenURL: "https://auth.example.com/token"}}, deps)
+	require.ErrorContains(t, err, "oauth2.clientid")
+
+	p, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png"}, deps)
+	require.NoError(t, err)
+
+	ctx, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.True(t, ctx.AuthBypass)
+}
+
+func Test_ProxyOAuth2(t *testing.T) {
+	var issued atomic.Int32
+	auth := tokenServer(t, &issued, 3600)
+	defer auth.Close()
+
+	var accepted atomic.Value
+	accepted.Store("tok1")
+	tiles := bearerTileServer(&accepted)
+	defer tiles.Close()
+
+	oauth2Cfg := &OAuth2Config{TokenURL: auth.URL, ClientID: "tilegroxy", ClientSecret: "hunter2", Scopes: []string{"tiles:read"}, Audience: "https://tiles.example.com"}
+	p := makeMirrorProxy(t, ProxyConfig{URL: tiles.URL + "/{z}/{x}/{y}.png", OAuth2: oauth2Cfg})
+
+	providerContext, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.False(t, providerContext.AuthBypass)
+	assert.Equal(t, "tok1", providerContext.AuthToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour-oauth2ExpiryMargin), providerContext.AuthExpiration, 5*time.Second)
+
+	img, err := p.GenerateTile(context.Background(), providerContext, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tile"), img.Content)
+
+	// The token being rejected is an auth error so the layer gets a new one
+	accepted.Store("tok2")
+	_, err = p.GenerateTile(context.Background(), providerContext, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.ErrorAs(t, err, new(pkg.ProviderAuthError))
+
+	providerContext, err = p.PreAuth(context.Background(), providerContext)
+	require.NoError(t, err)
+	assert.Equal(t, "tok2", providerContext.AuthToken)
+
+	img, err = p.GenerateTile(context.Background(), providerContext, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tile"), img.Content)
+}
+
+func Test_ProxyOAuth2Failures(t *testing.T) {
+	var issued atomic.Int32
+	auth := tokenServer(t, &issued, 20)
+	defer auth.Close()
+
+	p := makeMirrorProxy(t, ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", OAuth2: &OAuth2Config{TokenURL: auth.URL, ClientID: "tilegroxy", ClientSecret: "wrong"}})
+
+	_, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.ErrorAs(t, err, new(pkg.ProviderAuthError))
+
+	// Short lived tokens are replaced halfway through rather than before they're issued
+	p = makeMirrorProxy(t, ProxyConfig{URL: "http://example.com/{z}/{x}/{y}.png", OAuth2: &OAuth2Config{TokenURL: auth.URL, ClientID: "tilegroxy", ClientSecret: "hunter2", Scopes: []string{"tiles:read"}, Audience: "https://tiles.example.com"}})
+
+	providerContext, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), providerContext.AuthExpiration, 2*time.Second)
+}
+
+func Test_ProxyUnauthorizedWithoutOAuth2(t *testing.T) {
+	var accepted atomic.Value
+	accepted.Store("tok1")
+	tiles := bearerTileServer(&accepted)
+	defer tiles.Close()
+
+	// Without OAuth2 there's no token to replace, so a 401 is just the remote server failing
+	p := makeMirrorProxy(t, ProxyConfig{URL: tiles.URL + "/{z}/{x}/{y}.png"})
+
+	_, err := p.GenerateTile(context.Background(), layer.ProviderContext{AuthBypass: true}, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, new(pkg.ProviderAuthError))
+
+	var remoteErr *pkg.RemoteServerError
+	require.ErrorAs(t, err, &remoteErr)
+	assert.Equal(t, http.StatusUnauthorized, remoteErr.StatusCode)
+}
+
+func Test_UrlTemplateOAuth2(t *testing.T) {
+	var issued atomic.Int32
+	auth := tokenServer(t, &issued, 3600)
+	defer auth.Close()
+
+	var accepted atomic.Value
+	accepted.Store("tok1")
+	tiles := bearerTileServer(&accepted)
+	defer tiles.Close()
+
+	clientConfig := config.ClientConfig{StatusCodes: []int{200}, ContentTypes: []string{mimePng}, MaxLength: 1024, Timeout: 5}
+	p, err := URLTemplateRegistration{}.Initialize(URLTemplateConfig{
+		Template: tiles.URL + "?bbox=$xmin,$ymin,$xmax,$ymax",
+		OAuth2:   &OAuth2Config{TokenURL: auth.URL, ClientID: "tilegroxy", ClientSecret: "hunter2", Scopes: []string{"tiles:read"}, Audience: "https://tiles.example.com"},
+	}, layer.ProviderDeps{ClientConfig: clientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	providerContext, err := p.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.Equal(t, "tok1", providerContext.AuthToken)
+
+	img, err := p.GenerateTile(context.Background(), providerContext, pkg.TileRequest{LayerName: "l", Z: 1, X: 1, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tile"), img.Content)
+}
@@ -0,0 +1,154 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mirrorServer answers with its name as the tile, or the given status code instead if it's set
+func mirrorServer(name string, status *atomic.Int32, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+
+		if code := int(status.Load()); code != 0 {
+			w.WriteHeader(code)
+			return
+		}
+
+		w.Header().Set("Content-Type", mimePng)
+		_, _ = w.Write([]byte(name))
+	}))
+}
+
+func makeMirrorProxy(t *testing.T, cfg ProxyConfig) *Proxy {
+	t.Helper()
+
+	p, err := ProxyRegistration{}.Initialize(cfg, layer.ProviderDeps{
+		ErrorMessages: testErrMessages,
+		ClientConfig:  config.ClientConfig{StatusCodes: []int{200}, ContentTypes: []string{mimePng}, MaxLength: 1024, Timeout: 5},
+	})
+	require.NoError(t, err)
+
+	return p.(*Proxy)
+}
+
+func Test_ProxyMirrorsValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ErrorMessages: testErrMessages}
+
+	_, err := ProxyRegistration{}.Initialize(ProxyConfig{}, deps)
+	require.Error(t, err)
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://a.example.com/{z}/{x}/{y}.png", URLs: []string{"http://b.example.com/{z}/{x}/{y}.png"}}, deps)
+	require.Error(t, err)
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URLs: []string{"http://a.example.com/{z}/{x}/{y}.png", ""}}, deps)
+	require.ErrorContains(t, err, "urls[1]")
+
+	_, err = ProxyRegistration{}.Initialize(ProxyConfig{URLs: []string{"http://a.example.com/{z}/{x}/{y}.png"}, Selection: "random"}, deps)
+	require.Error(t, err)
+
+	p, err := ProxyRegistration{}.Initialize(ProxyConfig{URL: "http://{s}.example.com/{z}/{x}/{y}.png"}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, p.(*Proxy).Subdomains)
+}
+
+func Test_ProxyMirrorsFailover(t *testing.T) {
+	var firstStatus, secondStatus, firstCalls, secondCalls atomic.Int32
+	first := mirrorServer("first", &firstStatus, &firstCalls)
+	defer first.Close()
+	second := mirrorServer("second", &secondStatus, &secondCalls)
+	defer second.Close()
+
+	p := makeMirrorProxy(t, ProxyConfig{URLs: []string{first.URL + "/{z}/{x}/{y}", second.URL + "/{z}/{x}/{y}"}, MaxFailures: 2})
+	tile := pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0}
+
+	// Round robin alternates between the two
+	seen := map[string]int{}
+	for range 4 {
+		img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		require.NoError(t, err)
+		seen[string(img.Content)]++
+	}
+	assert.Equal(t, map[string]int{"first": 2, "second": 2}, seen)
+
+	// Requests to a broken mirror move on to the next one
+	firstStatus.Store(http.StatusBadGateway)
+	firstCalls.Store(0)
+	for range 4 {
+		img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(img.Content))
+	}
+
+	// After two failures in a row it's out of rotation
+	assert.Equal(t, int32(2), firstCalls.Load())
+
+	// A tile that doesn't exist isn't the mirror's fault
+	secondStatus.Store(http.StatusNotFound)
+	secondCalls.Store(0)
+	_, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), secondCalls.Load())
+	assert.Equal(t, int32(2), firstCalls.Load())
+
+	// With every mirror out of rotation they're all still tried
+	secondStatus.Store(http.StatusServiceUnavailable)
+	for range 2 {
+		_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		require.Error(t, err)
+	}
+
+	firstStatus.Store(0)
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(img.Content))
+}
+
+func Test_ProxyMirrorsHash(t *testing.T) {
+	var status, firstCalls, secondCalls atomic.Int32
+	first := mirrorServer("first", &status, &firstCalls)
+	defer first.Close()
+	second := mirrorServer("second", &status, &secondCalls)
+	defer second.Close()
+
+	p := makeMirrorProxy(t, ProxyConfig{URLs: []string{first.URL + "/{z}/{x}/{y}", second.URL + "/{z}/{x}/{y}"}, Selection: "hash"})
+
+	seen := map[string]bool{}
+	for x := range 8 {
+		tile := pkg.TileRequest{LayerName: "l", Z: 3, X: x, Y: 0}
+
+		img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		require.NoError(t, err)
+
+		// The same tile always goes to the same mirror
+		again, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, tile)
+		require.NoError(t, err)
+		assert.Equal(t, string(img.Content), string(again.Content))
+
+		seen[string(img.Content)] = true
+	}
+
+	assert.Len(t, seen, 2)
+}
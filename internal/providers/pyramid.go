@@ -0,0 +1,254 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"github.com/anthonynsimon/bild/transform"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	pyramidJpegQuality           = 90
+	pyramidDefaultMaxConcurrency = 16
+)
+
+type PyramidConfig struct {
+	SourceZoom     uint
+	MinZoom        uint
+	Resampling     string
+	MaxConcurrency uint // The most tiles requested from the wrapped provider at once while building lower levels
+	Provider       map[string]interface{}
+}
+
+type Pyramid struct {
+	PyramidConfig
+	filter   transform.ResampleFilter
+	provider layer.Provider
+	// Holds a place for each source tile being requested to build a lower level, shared by every
+	// request so deep levels don't fan out into thousands of requests at once
+	slots chan struct{}
+	// Children are rendered through this when set. nil when nested in another provider, since going
+	// through the layer would run them through that provider too
+	layerGroup *layer.LayerGroup
+}
+
+func init() {
+	layer.RegisterProvider(PyramidRegistration{})
+}
+
+type PyramidRegistration struct {
+}
+
+func (s PyramidRegistration) InitializeConfig() any {
+	return PyramidConfig{}
+}
+
+func (s PyramidRegistration) Name() string {
+	return "pyramid"
+}
+
+func (s PyramidRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(PyramidConfig)
+
+	if cfg.SourceZoom < 1 || cfg.SourceZoom > pkg.MaxZoom {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.pyramid.sourcezoom", 1, pkg.MaxZoom)
+	}
+
+	if cfg.MinZoom >= cfg.SourceZoom {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.pyramid.minzoom", 0, cfg.SourceZoom-1)
+	}
+
+	if cfg.Resampling == "" {
+		cfg.Resampling = "box"
+	}
+
+	filter, ok := resamplingFilters[cfg.Resampling]
+	if !ok {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.pyramid.resampling", cfg.Resampling, allResamplingFilters)
+	}
+
+	if cfg.MaxConcurrency == 0 {
+		cfg.MaxConcurrency = pyramidDefaultMaxConcurrency
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	layerGroup := deps.LayerGroup
+	if deps.Nested() {
+		layerGroup = nil
+	}
+
+	return &Pyramid{cfg, filter, provider, make(chan struct{}, cfg.MaxConcurrency), layerGroup}, nil
+}
+
+func (t Pyramid) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Pyramid holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Pyramid) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Pyramid) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	if tileRequest.Z >= int(t.SourceZoom) {
+		return t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	}
+
+	if tileRequest.Z < int(t.MinZoom) {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	slog.DebugContext(ctx, fmt.Sprintf("Building %v from its children", tileRequest))
+
+	children := make([]*pkg.Image, 4)
+
+	// Only source tiles take a place. The levels in between wait on their children, so holding one
+	// while doing that could leave every place taken by tiles waiting for a place
+	limited := tileRequest.Z+1 >= int(t.SourceZoom)
+
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+	for i := range children {
+		child := pkg.TileRequest{LayerName: tileRequest.LayerName, Z: tileRequest.Z + 1, X: tileRequest.X*2 + i%2, Y: tileRequest.Y*2 + i/2}
+
+		errGroup.Go(func() error {
+			if limited {
+				select {
+				case t.slots <- struct{}{}:
+					defer func() { <-t.slots }()
+				case <-groupCtx.Done():
+					return groupCtx.Err()
+				}
+			}
+
+			img, err := t.renderChild(groupCtx, providerContext, child)
+
+			var notFound pkg.TileNotFoundError
+			if errors.As(err, &notFound) {
+				return nil
+			}
+
+			children[i] = img
+			return err
+		})
+	}
+
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	return stitchPyramid(tileRequest, children, t.filter)
+}
+
+// renderChild goes through the layer, rather than straight back to this provider, so every level in
+// between the source zoom and the request is cached and concurrent requests sharing a child only
+// build it once. That isn't possible when nested in another provider, so children are built
+// directly instead
+func (t Pyramid) renderChild(ctx context.Context, providerContext layer.ProviderContext, child pkg.TileRequest) (*pkg.Image, error) {
+	if t.layerGroup == nil {
+		return t.GenerateTile(ctx, providerContext, child)
+	}
+
+	// The parent already passed the permission check and a child is the same for every user, so this
+	// resets the request context the same way ref does rather than limiting children to the caller's
+	// allowed area. Building on ctx keeps its span and cancellation
+	req, ok := pkg.ReqFromContext(ctx)
+	if ok && req != nil {
+		req = req.WithContext(ctx)
+	} else {
+		req, _ = http.NewRequestWithContext(ctx, "", "", nil)
+	}
+
+	return t.layerGroup.RenderTile(pkg.NewRequestContext(req), child)
+}
+
+// stitchPyramid lays out four children, ordered top left, top right, bottom left, bottom right,
+// into one image twice their size then shrinks it to the size of a single child. Missing children
+// are left transparent
+func stitchPyramid(tileRequest pkg.TileRequest, children []*pkg.Image, filter transform.ResampleFilter) (*pkg.Image, error) {
+	decoded := make([]image.Image, len(children))
+	size := image.Point{}
+	allJpeg := true
+	skipCache := false
+
+	for i, child := range children {
+		if child == nil {
+			allJpeg = false
+			continue
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(child.Content))
+		if err != nil {
+			return nil, err
+		}
+
+		decoded[i] = img
+		size = image.Point{max(size.X, img.Bounds().Dx()), max(size.Y, img.Bounds().Dy())}
+		allJpeg = allJpeg && child.ContentType == mimeJpeg
+		skipCache = skipCache || child.ForceSkipCache
+	}
+
+	if size.X == 0 {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, size.X*2, size.Y*2))
+	for i, img := range decoded {
+		if img == nil {
+			continue
+		}
+
+		if img.Bounds().Size() != size {
+			img = transform.Resize(img, size.X, size.Y, filter)
+		}
+
+		origin := image.Pt(i%2*size.X, i/2*size.Y)
+		draw.Draw(canvas, image.Rectangle{Min: origin, Max: origin.Add(size)}, img, img.Bounds().Min, draw.Src)
+	}
+
+	resized := transform.Resize(canvas, size.X, size.Y, filter)
+
+	var buf bytes.Buffer
+	var err error
+	if allJpeg {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: pyramidJpegQuality})
+	} else {
+		err = png.Encode(&buf, resized)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: pkg.Ternary(allJpeg, mimeJpeg, mimePng), ForceSkipCache: skipCache}, nil
+}
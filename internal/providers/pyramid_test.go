@@ -0,0 +1,238 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCache is a recordingCache that hits for the tiles saved to it
+type memoryCache struct {
+	recordingCache
+}
+
+func (c *memoryCache) Lookup(_ context.Context, t pkg.TileRequest) (*pkg.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saved[t], nil
+}
+
+func Test_PyramidValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+
+	_, err := PyramidRegistration{}.Initialize(PyramidConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = PyramidRegistration{}.Initialize(PyramidConfig{SourceZoom: 10, MinZoom: 10, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = PyramidRegistration{}.Initialize(PyramidConfig{SourceZoom: 10, Resampling: "cubic", Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := PyramidRegistration{}.Initialize(PyramidConfig{SourceZoom: 10, Provider: s}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, "box", p.(*Pyramid).Resampling)
+	assert.Equal(t, uint(16), p.(*Pyramid).MaxConcurrency)
+}
+
+func Test_PyramidOutsideRange(t *testing.T) {
+	child := &recordingProvider{img: makeQuadrantImage(t)}
+	p := Pyramid{PyramidConfig: PyramidConfig{SourceZoom: 5, MinZoom: 2}, filter: resamplingFilters["box"], provider: child}
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 7, X: 3, Y: 1})
+	require.NoError(t, err)
+	assert.Equal(t, child.img, img)
+
+	_, err = p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+}
+
+func Test_PyramidStitchesChildren(t *testing.T) {
+	quadrants := makeQuadrantImage(t)
+
+	// Each child is the same image of four colors, so the result shows that pattern four times over
+	img, err := stitchPyramid(pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1}, []*pkg.Image{quadrants, quadrants, quadrants, nil}, resamplingFilters["nearest"])
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), decoded.Bounds())
+	assert.Equal(t, metatileColors[0], color.NRGBAModel.Convert(decoded.At(10, 10)))
+	assert.Equal(t, metatileColors[1], color.NRGBAModel.Convert(decoded.At(74, 10)))
+	assert.Equal(t, metatileColors[3], color.NRGBAModel.Convert(decoded.At(202, 74)))
+
+	// The missing bottom right child is left transparent
+	assert.Equal(t, color.NRGBA{}, color.NRGBAModel.Convert(decoded.At(200, 200)))
+
+	_, err = stitchPyramid(pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1}, make([]*pkg.Image, 4), resamplingFilters["nearest"])
+	require.ErrorAs(t, err, &pkg.TileNotFoundError{})
+}
+
+func Test_PyramidCachesIntermediateLevels(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "drone", Provider: map[string]any{
+			"name":       "pyramid",
+			"sourcezoom": 2,
+			"provider": map[string]any{
+				"name": "proxy",
+				"url":  server.URL + "/{z}/{x}/{y}.png",
+			},
+		}},
+	}
+
+	c := &memoryCache{recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	img, err := lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "drone", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.Equal(t, int32(16), calls.Load())
+
+	// z0, the four tiles at z1, and the sixteen source tiles at z2
+	require.Eventually(t, func() bool { return c.count() == 21 }, time.Second, 10*time.Millisecond)
+
+	_, err = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "drone", Z: 1, X: 1, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, int32(16), calls.Load())
+}
+
+func Test_PyramidMaxConcurrency(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Client.MaxConcurrency = 2
+	cfg.Layers = []config.LayerConfig{
+		{ID: "drone", Provider: map[string]any{
+			"name":       "pyramid",
+			"sourcezoom": 2,
+			"provider": map[string]any{
+				"name": "proxy",
+				"url":  server.URL + "/{z}/{x}/{y}.png",
+			},
+		}},
+	}
+
+	c := &memoryCache{recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	// Building the parent doesn't hold the place its children need to make their requests
+	img, err := lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "drone", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.Equal(t, int32(16), calls.Load())
+}
+
+func Test_PyramidNested(t *testing.T) {
+	var calls atomic.Int32
+	server := metatileServer(t, &calls, nil)
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "drone", Provider: map[string]any{
+			"name":   "format",
+			"format": "jpeg",
+			"provider": map[string]any{
+				"name":       "pyramid",
+				"sourcezoom": 2,
+				"provider": map[string]any{
+					"name": "proxy",
+					"url":  server.URL + "/{z}/{x}/{y}.png",
+				},
+			},
+		}},
+	}
+
+	c := &memoryCache{recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	img, err := lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "drone", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimeJpeg, img.ContentType)
+	assert.Equal(t, int32(16), calls.Load())
+
+	// Children are built inside the format rather than going through it and the layer's cache, so
+	// only the tile asked for is cached
+	require.Eventually(t, func() bool { return c.count() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, c.count())
+}
+
+// slowProvider returns its image after a delay, keeping track of the most requests it had at once
+type slowProvider struct {
+	img      *pkg.Image
+	calls    atomic.Int32
+	inFlight atomic.Int32
+	most     atomic.Int32
+}
+
+func (p *slowProvider) PreAuth(_ context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return providerContext, nil
+}
+
+func (p *slowProvider) GenerateTile(_ context.Context, _ layer.ProviderContext, _ pkg.TileRequest) (*pkg.Image, error) {
+	p.calls.Add(1)
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	for {
+		most := p.most.Load()
+		if n <= most || p.most.CompareAndSwap(most, n) {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	return p.img, nil
+}
+
+func Test_PyramidLimitsSourceRequests(t *testing.T) {
+	child := &slowProvider{img: makeQuadrantImage(t)}
+	p := Pyramid{PyramidConfig: PyramidConfig{SourceZoom: 3, MaxConcurrency: 3}, filter: resamplingFilters["box"], provider: child, slots: make(chan struct{}, 3)}
+
+	img, err := p.GenerateTile(pkg.BackgroundContext(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.Equal(t, int32(64), child.calls.Load())
+	assert.LessOrEqual(t, child.most.Load(), int32(3))
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+)
+
+// paletteColor is one distinct color of an image along with how many pixels have it
+type paletteColor struct {
+	c     [4]uint8 // Non-premultiplied RGBA
+	count int
+}
+
+// quantizeImage reduces img to at most n colors, choosing the palette by median cut
+func quantizeImage(img image.Image, n int, dither bool) *image.Paletted {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(bounds)
+	draw.Draw(nrgba, bounds, img, bounds.Min, draw.Src)
+
+	palette := medianCut(histogram(nrgba), n)
+
+	out := image.NewPaletted(bounds, palette)
+	if dither {
+		draw.FloydSteinberg.Draw(out, bounds, nrgba, bounds.Min)
+	} else {
+		draw.Draw(out, bounds, nrgba, bounds.Min, draw.Src)
+	}
+
+	return out
+}
+
+func histogram(img *image.NRGBA) []paletteColor {
+	counts := make(map[[4]uint8]int)
+
+	for y := range img.Rect.Dy() {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			c := [4]uint8{row[x], row[x+1], row[x+2], row[x+3]}
+			if c[3] == 0 {
+				// The color of a fully transparent pixel doesn't matter, so don't spend palette entries on it
+				c = [4]uint8{}
+			}
+			counts[c]++
+		}
+	}
+
+	colors := make([]paletteColor, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, paletteColor{c, count})
+	}
+
+	// Map iteration is random, sort so the same image always gets the same palette
+	slices.SortFunc(colors, func(a, b paletteColor) int {
+		return cmp.Compare(packColor(a.c), packColor(b.c))
+	})
+
+	return colors
+}
+
+func packColor(c [4]uint8) uint32 {
+	return uint32(c[0])<<24 | uint32(c[1])<<16 | uint32(c[2])<<8 | uint32(c[3])
+}
+
+// medianCut repeatedly splits the box of colors with the widest spread in any one channel at the
+// pixel-weighted median of that channel, then averages each box into a palette entry
+func medianCut(colors []paletteColor, n int) color.Palette {
+	boxes := [][]paletteColor{colors}
+
+	for len(boxes) < n {
+		widest, channel, spread := -1, 0, 0
+
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+
+			for ch := range 4 {
+				lo, hi := box[0].c[ch], box[0].c[ch]
+				for _, c := range box[1:] {
+					lo, hi = min(lo, c.c[ch]), max(hi, c.c[ch])
+				}
+
+				if int(hi-lo) > spread {
+					widest, channel, spread = i, ch, int(hi-lo)
+				}
+			}
+		}
+
+		if widest < 0 {
+			// Every box is down to a single color, the image has no more than n of them
+			break
+		}
+
+		box := boxes[widest]
+		slices.SortStableFunc(box, func(a, b paletteColor) int {
+			return cmp.Compare(a.c[channel], b.c[channel])
+		})
+
+		total := 0
+		for _, c := range box {
+			total += c.count
+		}
+
+		// Split after the color that takes the running count past half, keeping both sides non-empty
+		split, seen := 1, box[0].count
+		for split < len(box)-1 && seen*2 < total {
+			seen += box[split].count
+			split++
+		}
+
+		boxes[widest] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [4]int
+		total := 0
+
+		for _, c := range box {
+			for ch := range 4 {
+				sum[ch] += int(c.c[ch]) * c.count
+			}
+			total += c.count
+		}
+
+		if total == 0 {
+			continue
+		}
+
+		var avg [4]uint8
+		for ch := range 4 {
+			avg[ch] = uint8((sum[ch] + total/2) / total) // #nosec G115 -- an average of uint8s
+		}
+
+		palette = append(palette, color.NRGBA{avg[0], avg[1], avg[2], avg[3]})
+	}
+
+	return palette
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+)
+
+// rangeReader reads arbitrary byte ranges out of a single large archive, for providers that serve
+// tiles out of one file rather than calling a tile server. The same archive can then be read from
+// the local filesystem or from an HTTP server supporting range requests
+type rangeReader interface {
+	ReadRange(ctx context.Context, offset uint64, length uint64) ([]byte, error)
+	Close() error
+}
+
+// newRangeReader opens whichever of file or url is set. Exactly one must be, paramPrefix is used to
+// name the parameters in errors
+func newRangeReader(file string, url string, clientConfig config.ClientConfig, errorMessages config.ErrorMessages, paramPrefix string) (rangeReader, error) {
+	if file != "" && url != "" {
+		return nil, fmt.Errorf(errorMessages.ParamsMutuallyExclusive, paramPrefix+".file", paramPrefix+".url")
+	}
+
+	if url != "" {
+		return httpRangeReader{url, clientConfig}, nil
+	}
+
+	if file == "" {
+		return nil, fmt.Errorf(errorMessages.OneOfRequired, []string{paramPrefix + ".file", paramPrefix + ".url"})
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf(errorMessages.InvalidParam, paramPrefix+".file", file)
+	}
+
+	return fileRangeReader{f}, nil
+}
+
+type fileRangeReader struct {
+	file *os.File
+}
+
+func (r fileRangeReader) ReadRange(_ context.Context, offset uint64, length uint64) ([]byte, error) {
+	if offset > math.MaxInt64 || length > math.MaxInt32 {
+		return nil, pkg.RangeError{ParamName: "offset", MinValue: 0, MaxValue: math.MaxInt64}
+	}
+
+	buf := make([]byte, length)
+	n, err := r.file.ReadAt(buf, int64(offset))
+
+	// ReadAt reports EOF alongside a full read that ends exactly at the end of the file
+	if err == io.EOF && uint64(n) == length { //nolint:errorlint // ReadAt returns io.EOF unwrapped
+		err = nil
+	}
+
+	return buf[:n], err
+}
+
+func (r fileRangeReader) Close() error {
+	return r.file.Close()
+}
+
+type httpRangeReader struct {
+	url          string
+	clientConfig config.ClientConfig
+}
+
+func (r httpRangeReader) ReadRange(ctx context.Context, offset uint64, length uint64) ([]byte, error) {
+	return pkg.GetRange(ctx, r.clientConfig, r.url, offset, length)
+}
+
+func (r httpRangeReader) Close() error {
+	return nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"strconv"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/paulmach/orb/encoding/mvt"
+)
+
+type Region struct {
+	Coverage     map[string]interface{} // GeoJSON polygons the provider covers
+	CoverageFile string                 // File containing GeoJSON polygons the provider covers
+	Provider     map[string]interface{}
+}
+
+type RegionRouterConfig struct {
+	Regions   []Region
+	Default   map[string]interface{} // Provider for tiles outside every region
+	Composite bool                   // Combine providers pixel by pixel in tiles crossed by the edge of a region
+}
+
+type RegionRouter struct {
+	RegionRouterConfig
+	masks []*polygonMask
+	// One for each region, followed by the default if there is one
+	providers []layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(RegionRouterRegistration{})
+}
+
+type RegionRouterRegistration struct {
+}
+
+func (s RegionRouterRegistration) InitializeConfig() any {
+	return RegionRouterConfig{}
+}
+
+func (s RegionRouterRegistration) Name() string {
+	return "regionrouter"
+}
+
+func (s RegionRouterRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(RegionRouterConfig)
+
+	if len(cfg.Regions) == 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.regionrouter.regions")
+	}
+
+	errs := make([]error, 0)
+	masks := make([]*polygonMask, len(cfg.Regions))
+
+	for i, region := range cfg.Regions {
+		param := "provider.regionrouter.regions[" + strconv.Itoa(i) + "].coverage"
+
+		mask, err := loadPolygonMask(region.Coverage, region.CoverageFile, param, deps)
+		if err != nil {
+			errs = append(errs, err)
+		} else if mask == nil {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.OneOfRequired, []string{param, param + "file"}))
+		}
+
+		masks[i] = mask
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	providerConfigs := make([]map[string]interface{}, 0, len(cfg.Regions)+1)
+	for _, region := range cfg.Regions {
+		providerConfigs = append(providerConfigs, region.Provider)
+	}
+	if cfg.Default != nil {
+		providerConfigs = append(providerConfigs, cfg.Default)
+	}
+
+	providers := make([]layer.Provider, len(providerConfigs))
+	for i, providerConfig := range providerConfigs {
+		provider, err := layer.ConstructProvider(providerConfig, deps)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[i] = provider
+	}
+
+	return &RegionRouter{cfg, masks, providers}, nil
+}
+
+func (t RegionRouter) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return preAuthRoutes(ctx, t.providers, providerContext)
+}
+
+// Close releases the child providers. RegionRouter holds them directly rather than through a
+// Layer, so they're unreachable from LayerGroup.Close without this.
+func (t RegionRouter) Close(ctx context.Context) error {
+	return closeRoutes(ctx, t.providers)
+}
+
+func (t RegionRouter) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	// Regions the edge of the tile crosses, in order, before the one covering the rest of the tile
+	partial := make([]int, 0)
+	rest := -1
+
+	for i, mask := range t.masks {
+		relation := mask.relate(tileRequest)
+
+		if relation == maskInside || (relation == maskPartial && !t.Composite) {
+			rest = i
+			break
+		}
+
+		if relation == maskPartial {
+			partial = append(partial, i)
+		}
+	}
+
+	if rest == -1 && len(t.providers) > len(t.masks) {
+		rest = len(t.masks)
+	}
+
+	if len(partial) == 0 {
+		if rest == -1 {
+			return nil, pkg.TileNotFoundError{Tile: tileRequest}
+		}
+
+		slog.DebugContext(ctx, fmt.Sprintf("Region router sending tile to provider %v", rest))
+		return t.providers[rest].GenerateTile(ctx, routeContext(providerContext, rest), tileRequest)
+	}
+
+	return t.compositeTile(ctx, providerContext, tileRequest, partial, rest)
+}
+
+// compositeTile combines the tiles of every region the tile's edge crosses, each pixel or feature
+// coming from the first region it's in. Whatever's left comes from rest, unless that's -1 in which
+// case it's left empty
+func (t RegionRouter) compositeTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest, partial []int, rest int) (*pkg.Image, error) {
+	indices := partial
+	if rest != -1 {
+		indices = append(indices[:len(indices):len(indices)], rest)
+	}
+
+	slog.DebugContext(ctx, fmt.Sprintf("Region router compositing providers %v", indices))
+
+	imgs := make([]*pkg.Image, len(indices))
+	forceSkipCache := false
+	vectorCount := 0
+
+	for k, i := range indices {
+		img, err := t.providers[i].GenerateTile(ctx, routeContext(providerContext, i), tileRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		if img == nil {
+			return nil, errors.New("region router requires a tile from every provider covering it")
+		}
+
+		imgs[k] = img
+		forceSkipCache = forceSkipCache || img.ForceSkipCache
+		vectorCount += pkg.Ternary(isMVT(img), 1, 0)
+	}
+
+	if vectorCount == len(imgs) {
+		return t.compositeVectorTiles(imgs, tileRequest, partial, forceSkipCache)
+	}
+
+	if vectorCount > 0 {
+		return nil, fmt.Errorf("region router can't combine %v with %v", imgs[0].ContentType, imgs[len(imgs)-1].ContentType)
+	}
+
+	decoded := make([]image.Image, len(imgs))
+	var size image.Point
+
+	for k, img := range imgs {
+		realImage, _, err := image.Decode(bytes.NewReader(img.Content))
+		if err != nil {
+			return nil, err
+		}
+
+		decoded[k] = realImage
+		size.X = max(size.X, realImage.Bounds().Dx())
+		size.Y = max(size.Y, realImage.Bounds().Dy())
+	}
+
+	resultImage := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	layerImage := image.NewNRGBA(resultImage.Rect)
+
+	// Each region is painted over the ones after it so the first region to contain a pixel wins
+	for k := len(decoded) - 1; k >= 0; k-- {
+		realImage := decoded[k]
+		if realImage.Bounds().Size() != size {
+			slog.DebugContext(ctx, fmt.Sprintf("Resizing image %v from %v to %v", k, realImage.Bounds().Size(), size))
+			realImage = transform.Resize(realImage, size.X, size.Y, transform.NearestNeighbor)
+		}
+
+		if k == len(partial) {
+			draw.Draw(resultImage, resultImage.Rect, realImage, realImage.Bounds().Min, draw.Src)
+			continue
+		}
+
+		draw.Draw(layerImage, layerImage.Rect, realImage, realImage.Bounds().Min, draw.Src)
+
+		mask := t.masks[partial[k]].rasterize(tileRequest, size.X, size.Y)
+		for i, v := range mask.Pix {
+			if v != 0 {
+				copy(resultImage.Pix[i*4:i*4+4], layerImage.Pix[i*4:i*4+4])
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resultImage); err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng, ForceSkipCache: forceSkipCache}, nil
+}
+
+// compositeVectorTiles clips the features of each region's tile to the parts inside it and outside
+// every region before it. Features of the tile covering the rest are kept outside all of them.
+// Layers with the same name are combined
+func (t RegionRouter) compositeVectorTiles(imgs []*pkg.Image, tileRequest pkg.TileRequest, partial []int, forceSkipCache bool) (*pkg.Image, error) {
+	result := make(mvt.Layers, 0)
+	byName := make(map[string]*mvt.Layer)
+
+	for k, img := range imgs {
+		layers, err := decodeMVT(img)
+		if err != nil {
+			return nil, err
+		}
+
+		if k < len(partial) {
+			layers = t.masks[partial[k]].clipLayers(layers, tileRequest, true)
+		}
+
+		for _, earlier := range partial[:min(k, len(partial))] {
+			layers = t.masks[earlier].clipLayers(layers, tileRequest, false)
+		}
+
+		for _, l := range layers {
+			existing, ok := byName[l.Name]
+			if !ok {
+				byName[l.Name] = l
+				result = append(result, l)
+				continue
+			}
+
+			mergeMVTLayer(existing, l)
+		}
+	}
+
+	return encodeMVT(result, forceSkipCache)
+}
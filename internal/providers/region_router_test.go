@@ -0,0 +1,198 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCoverage gives a rectangular coverage area between two longitudes
+func testCoverage(west float64, east float64) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "Polygon",
+		"coordinates": []interface{}{
+			[]interface{}{[]interface{}{west, -80}, []interface{}{east, -80}, []interface{}{east, 80}, []interface{}{west, 80}, []interface{}{west, -80}},
+		},
+	}
+}
+
+// makeRegionRouter routes the west of the world to red and the middle to green, with everything
+// else going to blue if withDefault is set
+func makeRegionRouter(t *testing.T, composite bool, withDefault bool) *RegionRouter {
+	t.Helper()
+
+	cfg := RegionRouterConfig{
+		Regions: []Region{
+			{Coverage: testCoverage(-180, -10), Provider: map[string]interface{}{"name": "static", "color": "F00"}},
+			{Coverage: testCoverage(-90, 45), Provider: map[string]interface{}{"name": "static", "color": "0F0"}},
+		},
+		Composite: composite,
+	}
+	if withDefault {
+		cfg.Default = map[string]interface{}{"name": "static", "color": "00F"}
+	}
+
+	p, err := RegionRouterRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	// Static gives a single pixel, too small to tell where a region's edge falls
+	r := p.(*RegionRouter)
+	for i, col := range []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}[:len(r.providers)] {
+		r.providers[i] = &recordingProvider{img: makeSolidImage(t, col)}
+	}
+
+	return r
+}
+
+func makeSolidImage(t *testing.T, col color.NRGBA) *pkg.Image {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	draw.Draw(img, img.Rect, image.NewUniform(col), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: mimePng}
+}
+
+func renderRegionRouter(t *testing.T, r *RegionRouter, tileRequest pkg.TileRequest) image.Image {
+	t.Helper()
+
+	img, err := r.GenerateTile(context.Background(), layer.ProviderContext{}, tileRequest)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	return decoded
+}
+
+func Test_RegionRouterValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+
+	_, err := RegionRouterRegistration{}.Initialize(RegionRouterConfig{}, deps)
+	require.Error(t, err)
+
+	_, err = RegionRouterRegistration{}.Initialize(RegionRouterConfig{Regions: []Region{{Provider: s}}}, deps)
+	require.ErrorContains(t, err, "regions[0].coverage")
+
+	_, err = RegionRouterRegistration{}.Initialize(RegionRouterConfig{Regions: []Region{{Coverage: testCoverage(0, 10), CoverageFile: "coverage.geojson", Provider: s}}}, deps)
+	require.Error(t, err)
+
+	_, err = RegionRouterRegistration{}.Initialize(RegionRouterConfig{Regions: []Region{{Coverage: testCoverage(0, 10), Provider: s}, {Coverage: map[string]interface{}{"type": "LineString"}, Provider: s}}}, deps)
+	require.ErrorContains(t, err, "regions[1].coverage")
+
+	_, err = RegionRouterRegistration{}.Initialize(RegionRouterConfig{Regions: []Region{{CoverageFile: "missing.geojson", Provider: s}}}, deps)
+	require.Error(t, err)
+
+	_, err = RegionRouterRegistration{}.Initialize(RegionRouterConfig{Regions: []Region{{Coverage: testCoverage(0, 10), Provider: s}}, Default: map[string]interface{}{"name": "static"}}, deps)
+	require.Error(t, err)
+}
+
+func Test_RegionRouterFirstMatch(t *testing.T) {
+	r := makeRegionRouter(t, false, true)
+
+	for tile, expected := range map[pkg.TileRequest]color.Color{
+		{LayerName: "l", Z: 0, X: 0, Y: 0}: color.RGBA{255, 0, 0, 255}, // Crosses both, the first wins
+		{LayerName: "l", Z: 2, X: 0, Y: 1}: color.RGBA{255, 0, 0, 255}, // Inside the first
+		{LayerName: "l", Z: 2, X: 2, Y: 1}: color.RGBA{0, 255, 0, 255}, // Crosses only the second
+		{LayerName: "l", Z: 2, X: 3, Y: 1}: color.RGBA{0, 0, 255, 255}, // Outside both
+	} {
+		img := renderRegionRouter(t, r, tile)
+		assert.Equal(t, expected, color.RGBAModel.Convert(img.At(0, 0)), tile)
+	}
+
+	r = makeRegionRouter(t, false, false)
+	_, err := r.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 2, X: 3, Y: 1})
+
+	var notFound pkg.TileNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+func Test_RegionRouterComposite(t *testing.T) {
+	r := makeRegionRouter(t, true, true)
+	at := func(img image.Image, x, y int) color.Color { return color.RGBAModel.Convert(img.At(x, y)) }
+
+	// At zoom 0 longitude -100 is x 57, 0 is x 128 and 100 is x 199, while the equator is y 128
+	img := renderRegionRouter(t, r, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, at(img, 57, 128))
+	assert.Equal(t, color.RGBA{0, 255, 0, 255}, at(img, 128, 128))
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, at(img, 199, 128))
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, at(img, 57, 2))
+
+	// Only the second region crosses this tile, along longitude 45 down the middle
+	img = renderRegionRouter(t, r, pkg.TileRequest{LayerName: "l", Z: 2, X: 2, Y: 1})
+	assert.Equal(t, color.RGBA{0, 255, 0, 255}, at(img, 127, 100))
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, at(img, 128, 100))
+
+	// Tiles that only one region touches aren't composited
+	img = renderRegionRouter(t, r, pkg.TileRequest{LayerName: "l", Z: 2, X: 0, Y: 1})
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, at(img, 0, 0))
+
+	r = makeRegionRouter(t, true, false)
+	img = renderRegionRouter(t, r, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, at(img, 57, 128))
+	assert.Equal(t, color.RGBA{}, at(img, 199, 128))
+}
+
+func Test_RegionRouterCompositeMVT(t *testing.T) {
+	r := makeRegionRouter(t, true, true)
+
+	// Points along the equator at longitudes -100, 0 and 100
+	points := []orb.Point{{910, 2048}, {2048, 2048}, {3186, 2048}}
+	for i, name := range []string{"first", "second", "default"} {
+		l := &mvt.Layer{Name: name, Version: 2, Extent: 4096}
+		for _, p := range points {
+			l.Features = append(l.Features, geojson.NewFeature(p))
+		}
+
+		img, err := encodeMVT(mvt.Layers{l}, false)
+		require.NoError(t, err)
+		r.providers[i] = &recordingProvider{img: img}
+	}
+
+	img, err := r.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.NoError(t, err)
+	assert.Equal(t, mvtContentType, img.ContentType)
+
+	layers, err := decodeMVT(img)
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+
+	for i, l := range layers {
+		require.Len(t, l.Features, 1, l.Name)
+		assert.Equal(t, points[i], l.Features[0].Geometry, l.Name)
+	}
+
+	r.providers[2] = &recordingProvider{img: &pkg.Image{Content: []byte("png"), ContentType: mimePng}}
+	_, err = r.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 0, X: 0, Y: 0})
+	require.Error(t, err)
+}
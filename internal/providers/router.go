@@ -0,0 +1,75 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+)
+
+// preAuthRoutes runs PreAuth on every child of a provider that sends each tile to just one of
+// them, keeping each child's context in Other under its index. The combined context only bypasses
+// auth if every child does and otherwise expires along with the first child to expire. A failure
+// leaves it already expired so the next request tries again
+func preAuthRoutes(ctx context.Context, providers []layer.Provider, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	result := layer.ProviderContext{AuthBypass: true, Other: make(map[string]interface{}, len(providers))}
+	errs := make([]error, 0)
+
+	for i, p := range providers {
+		child, err := p.PreAuth(ctx, routeContext(providerContext, i))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		result.Other[strconv.Itoa(i)] = child
+
+		if child.AuthBypass && err == nil {
+			continue
+		}
+
+		if result.AuthBypass || child.AuthExpiration.Before(result.AuthExpiration) {
+			result.AuthExpiration = child.AuthExpiration
+		}
+		result.AuthBypass = false
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		result.AuthExpiration = time.Time{}
+		return result, err
+	}
+
+	return result, nil
+}
+
+// routeContext gives the context preAuthRoutes stored for a child, or an empty one before it's run
+func routeContext(providerContext layer.ProviderContext, i int) layer.ProviderContext {
+	child, _ := providerContext.Other[strconv.Itoa(i)].(layer.ProviderContext)
+	return child
+}
+
+// closeRoutes releases every child of a routing provider
+func closeRoutes(ctx context.Context, providers []layer.Provider) error {
+	errs := make([]error, 0, len(providers))
+
+	for _, p := range providers {
+		errs = append(errs, lifecycle.CloseIfCloser(ctx, p))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/paulmach/orb"
+)
+
+const spatialIndexNodeSize = 16
+
+// spatialIndex is a static R-tree packed with the Sort-Tile-Recursive algorithm. It's built once
+// from a fixed set of bounds and answers which of them intersect a given bound
+type spatialIndex struct {
+	// levels[0] holds one entry per item and each level above holds one entry per group of up to
+	// spatialIndexNodeSize entries in the level below. The last level is the root
+	levels [][]spatialIndexEntry
+}
+
+type spatialIndexEntry struct {
+	bound orb.Bound
+	// For items, start is the item's position in the slice given to newSpatialIndex. Otherwise
+	// start and end are the range of entries in the level below
+	start int
+	end   int
+}
+
+func newSpatialIndex(bounds []orb.Bound) *spatialIndex {
+	entries := make([]spatialIndexEntry, len(bounds))
+	for i, b := range bounds {
+		entries[i] = spatialIndexEntry{bound: b, start: i, end: i + 1}
+	}
+
+	idx := &spatialIndex{}
+
+	for {
+		sortSTR(entries)
+		idx.levels = append(idx.levels, entries)
+
+		if len(entries) <= 1 {
+			return idx
+		}
+
+		parents := make([]spatialIndexEntry, 0, (len(entries)+spatialIndexNodeSize-1)/spatialIndexNodeSize)
+		for i := 0; i < len(entries); i += spatialIndexNodeSize {
+			end := min(i+spatialIndexNodeSize, len(entries))
+
+			bound := entries[i].bound
+			for _, e := range entries[i+1 : end] {
+				bound = bound.Union(e.bound)
+			}
+
+			parents = append(parents, spatialIndexEntry{bound: bound, start: i, end: end})
+		}
+
+		entries = parents
+	}
+}
+
+// search returns the positions of every item intersecting bound, in ascending order
+func (idx *spatialIndex) search(bound orb.Bound) []int {
+	result := make([]int, 0)
+
+	top := len(idx.levels) - 1
+	idx.searchLevel(top, idx.levels[top], bound, &result)
+
+	slices.Sort(result)
+	return result
+}
+
+func (idx *spatialIndex) searchLevel(level int, entries []spatialIndexEntry, bound orb.Bound, result *[]int) {
+	for _, e := range entries {
+		if !e.bound.Intersects(bound) {
+			continue
+		}
+
+		if level == 0 {
+			*result = append(*result, e.start)
+		} else {
+			idx.searchLevel(level-1, idx.levels[level-1][e.start:e.end], bound, result)
+		}
+	}
+}
+
+// sortSTR orders entries so that each consecutive run of spatialIndexNodeSize covers a compact
+// area: sorted into vertical slices by x, then by y within each slice
+func sortSTR(entries []spatialIndexEntry) {
+	nodeCount := math.Ceil(float64(len(entries)) / spatialIndexNodeSize)
+	sliceSize := int(math.Ceil(math.Sqrt(nodeCount))) * spatialIndexNodeSize
+
+	slices.SortFunc(entries, func(a, b spatialIndexEntry) int {
+		return cmp.Compare(a.bound.Center().X(), b.bound.Center().X())
+	})
+
+	for i := 0; i < len(entries); i += sliceSize {
+		slices.SortFunc(entries[i:min(i+sliceSize, len(entries))], func(a, b spatialIndexEntry) int {
+			return cmp.Compare(a.bound.Center().Y(), b.bound.Center().Y())
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+)
+
+// Where a rule's key is looked up
+const (
+	switchKeyCtx   = "ctx."
+	switchKeyLayer = "layer."
+	switchKeyQuery = "query."
+)
+
+var allSwitchKeyPrefixes = []string{switchKeyCtx, switchKeyLayer, switchKeyQuery}
+
+// Percentages are bucketed to a hundredth of a percent
+const switchBuckets = 10000
+
+type SwitchRule struct {
+	Key      string   // The value to check, such as ctx.X-Customer, ctx.user, layer.version or query.variant
+	Values   []string // Matches if the value is any of these
+	Pattern  string   // Matches if the value matches this regular expression
+	Percent  *float64 // Matches this percentage of values, always the same ones for a given value
+	Provider map[string]interface{}
+}
+
+type SwitchConfig struct {
+	Rules   []SwitchRule
+	Default map[string]interface{} // Provider for requests no rule matches
+}
+
+type Switch struct {
+	SwitchConfig
+	patterns []*regexp.Regexp
+	// One for each rule, followed by the default if there is one
+	providers []layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(SwitchRegistration{})
+}
+
+type SwitchRegistration struct {
+}
+
+func (s SwitchRegistration) InitializeConfig() any {
+	return SwitchConfig{}
+}
+
+func (s SwitchRegistration) Name() string {
+	return "switch"
+}
+
+func (s SwitchRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(SwitchConfig)
+
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.switch.rules")
+	}
+
+	errs := make([]error, 0)
+	patterns := make([]*regexp.Regexp, len(cfg.Rules))
+
+	for i, rule := range cfg.Rules {
+		param := "provider.switch.rules[" + strconv.Itoa(i) + "]"
+
+		if rule.Key == "" {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamRequired, param+".key"))
+		} else if !slices.ContainsFunc(allSwitchKeyPrefixes, func(prefix string) bool { return strings.HasPrefix(rule.Key, prefix) && len(rule.Key) > len(prefix) }) {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".key", rule.Key))
+		}
+
+		conditions := make([]string, 0, 1)
+		if rule.Values != nil {
+			conditions = append(conditions, param+".values")
+		}
+		if rule.Pattern != "" {
+			conditions = append(conditions, param+".pattern")
+		}
+		if rule.Percent != nil {
+			conditions = append(conditions, param+".percent")
+		}
+
+		if len(conditions) == 0 {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.OneOfRequired, []string{param + ".values", param + ".pattern", param + ".percent"}))
+		} else if len(conditions) > 1 {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamsMutuallyExclusive, conditions[0], conditions[1]))
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param+".pattern", rule.Pattern))
+			}
+			patterns[i] = pattern
+		}
+
+		if rule.Percent != nil && (*rule.Percent < 0 || *rule.Percent > 100) {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.RangeError, param+".percent", 0, 100))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	providerConfigs := make([]map[string]interface{}, 0, len(cfg.Rules)+1)
+	for _, rule := range cfg.Rules {
+		providerConfigs = append(providerConfigs, rule.Provider)
+	}
+	if cfg.Default != nil {
+		providerConfigs = append(providerConfigs, cfg.Default)
+	}
+
+	providers := make([]layer.Provider, len(providerConfigs))
+	for i, providerConfig := range providerConfigs {
+		provider, err := layer.ConstructProvider(providerConfig, deps)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[i] = provider
+	}
+
+	sw := &Switch{cfg, patterns, providers}
+
+	// The cache is keyed by the layer name, which already includes any layer pattern values, so
+	// only a choice that depends on the rest of the request has to be kept apart
+	if slices.ContainsFunc(cfg.Rules, func(rule SwitchRule) bool { return !strings.HasPrefix(rule.Key, switchKeyLayer) }) {
+		deps.VaryCache(func(ctx context.Context) string {
+			return strconv.Itoa(sw.choose(ctx))
+		})
+	}
+
+	return sw, nil
+}
+
+func (t Switch) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return preAuthRoutes(ctx, t.providers, providerContext)
+}
+
+// Close releases the child providers. Switch holds them directly rather than through a Layer, so
+// they're unreachable from LayerGroup.Close without this.
+func (t Switch) Close(ctx context.Context) error {
+	return closeRoutes(ctx, t.providers)
+}
+
+func (t Switch) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	chosen := t.choose(ctx)
+
+	if chosen == -1 {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	slog.DebugContext(ctx, fmt.Sprintf("Switch sending request to provider %v", chosen))
+
+	return t.providers[chosen].GenerateTile(ctx, routeContext(providerContext, chosen), tileRequest)
+}
+
+// choose gives the index of the provider to send a request to, the first rule it matches or
+// otherwise the default. -1 if there's no default
+func (t Switch) choose(ctx context.Context) int {
+	for i, rule := range t.Rules {
+		if t.matches(i, switchValue(ctx, rule.Key)) {
+			return i
+		}
+	}
+
+	if len(t.providers) > len(t.Rules) {
+		return len(t.Rules)
+	}
+
+	return -1
+}
+
+// matches checks a value against a rule. Empty values, such as a missing header or a user that
+// isn't logged in, are never part of a percentage
+func (t Switch) matches(i int, value string) bool {
+	rule := t.Rules[i]
+
+	switch {
+	case rule.Values != nil:
+		return slices.Contains(rule.Values, value)
+	case t.patterns[i] != nil:
+		return t.patterns[i].MatchString(value)
+	case rule.Percent != nil:
+		if value == "" {
+			return false
+		}
+
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(value))
+
+		return float64(hash.Sum32()%switchBuckets) < *rule.Percent*switchBuckets/100
+	}
+
+	return false
+}
+
+// switchValue looks up the value of a rule's key in the request, giving an empty string for
+// anything missing
+func switchValue(ctx context.Context, key string) string {
+	switch {
+	case strings.HasPrefix(key, switchKeyCtx):
+		val := contextValue(ctx, key[len(switchKeyCtx):])
+		if val == nil {
+			return ""
+		}
+
+		return fmt.Sprint(val)
+	case strings.HasPrefix(key, switchKeyLayer):
+		lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
+		if lpm == nil {
+			return ""
+		}
+
+		return (*lpm)[key[len(switchKeyLayer):]]
+	case strings.HasPrefix(key, switchKeyQuery):
+		query, _ := ctx.Value("query").(url.Values)
+
+		return query.Get(key[len(switchKeyQuery):])
+	}
+
+	return ""
+}
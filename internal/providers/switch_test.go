@@ -0,0 +1,229 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSwitchTile = pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1}
+
+// makeSwitch builds a switch whose providers return their own name as the tile, with the default
+// named "default"
+func makeSwitch(t *testing.T, rules []SwitchRule, names ...string) *Switch {
+	t.Helper()
+
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	for i := range rules {
+		rules[i].Provider = s
+	}
+
+	p, err := SwitchRegistration{}.Initialize(SwitchConfig{Rules: rules, Default: s}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	sw := p.(*Switch)
+	for i, name := range append(names, "default") {
+		sw.providers[i] = &recordingProvider{img: &pkg.Image{Content: []byte(name), ContentType: mimePng}}
+	}
+
+	return sw
+}
+
+// switchRequest makes the context of a request to the given URL, with the header and user set
+func switchRequest(target string, header map[string]string, user string) context.Context {
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	ctx := pkg.NewRequestContext(req)
+	id, _ := pkg.UserIDFromContext(ctx)
+	*id = user
+
+	return ctx
+}
+
+func chooseSwitch(ctx context.Context, t *testing.T, s *Switch) string {
+	t.Helper()
+
+	img, err := s.GenerateTile(ctx, layer.ProviderContext{}, testSwitchTile)
+	require.NoError(t, err)
+
+	return string(img.Content)
+}
+
+func Test_SwitchValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	half := 50.0
+	tooMuch := 150.0
+
+	_, err := SwitchRegistration{}.Initialize(SwitchConfig{}, deps)
+	require.Error(t, err)
+
+	for _, rule := range []SwitchRule{
+		{Values: []string{"a"}},
+		{Key: "header.X-Customer", Values: []string{"a"}},
+		{Key: "ctx.", Values: []string{"a"}},
+		{Key: "ctx.user"},
+		{Key: "ctx.user", Values: []string{"a"}, Percent: &half},
+		{Key: "ctx.user", Pattern: "("},
+		{Key: "ctx.user", Percent: &tooMuch},
+	} {
+		rule.Provider = s
+		_, err = SwitchRegistration{}.Initialize(SwitchConfig{Rules: []SwitchRule{rule}}, deps)
+		require.ErrorContains(t, err, "rules[0]", rule)
+	}
+
+	_, err = SwitchRegistration{}.Initialize(SwitchConfig{Rules: []SwitchRule{{Key: "ctx.user", Percent: &half, Provider: map[string]interface{}{"name": "static"}}}}, deps)
+	require.Error(t, err)
+
+	_, err = SwitchRegistration{}.Initialize(SwitchConfig{Rules: []SwitchRule{{Key: "layer.version", Pattern: "^v2", Provider: s}}}, deps)
+	require.NoError(t, err)
+}
+
+func Test_SwitchRules(t *testing.T) {
+	sw := makeSwitch(t, []SwitchRule{
+		{Key: "ctx.X-Customer", Values: []string{"acme", "globex"}},
+		{Key: "query.variant", Pattern: "^beta"},
+		{Key: "ctx.user", Values: []string{"alice"}},
+	}, "customer", "beta", "alice")
+
+	for expected, ctx := range map[string]context.Context{
+		"customer": switchRequest("/tiles/l/3/1/1", map[string]string{"X-Customer": "globex"}, "alice"),
+		"beta":     switchRequest("/tiles/l/3/1/1?variant=beta-2", map[string]string{"X-Customer": "initech"}, ""),
+		"alice":    switchRequest("/tiles/l/3/1/1?variant=alpha", nil, "alice"),
+		"default":  switchRequest("/tiles/l/3/1/1", nil, "bob"),
+	} {
+		assert.Equal(t, expected, chooseSwitch(ctx, t, sw))
+	}
+
+	sw.providers = sw.providers[:3]
+	_, err := sw.GenerateTile(switchRequest("/tiles/l/3/1/1", nil, "bob"), layer.ProviderContext{}, testSwitchTile)
+
+	var notFound pkg.TileNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+func Test_SwitchLayerPattern(t *testing.T) {
+	sw := makeSwitch(t, []SwitchRule{{Key: "layer.version", Values: []string{"2"}}}, "v2")
+
+	ctx := switchRequest("/tiles/l/3/1/1", nil, "")
+	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
+	(*lpm)["version"] = "2"
+
+	assert.Equal(t, "v2", chooseSwitch(ctx, t, sw))
+
+	sw = makeSwitch(t, []SwitchRule{{Key: "ctx.user", Values: []string{"alice"}}, {Key: "layer.version", Values: []string{"2"}}}, "alice", "v2")
+	assert.Equal(t, "v2", chooseSwitch(ctx, t, sw))
+}
+
+func Test_SwitchInLayer(t *testing.T) {
+	// Slow enough that the requests are all in flight at once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", mimePng)
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Client.ContentTypes = []string{mimePng}
+	cfg.Layers = []config.LayerConfig{
+		{ID: "switched", Provider: map[string]any{
+			"name": "switch",
+			"rules": []any{
+				map[string]any{"key": "ctx.X-Customer", "values": []any{"acme"}, "provider": map[string]any{"name": "proxy", "url": server.URL + "/acme"}},
+			},
+			"default": map[string]any{"name": "proxy", "url": server.URL + "/other"},
+		}},
+	}
+
+	c := &memoryCache{recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	customers := []string{"acme", "globex", "acme", "globex", "acme", "globex"}
+	imgs := make([]*pkg.Image, len(customers))
+
+	var wg sync.WaitGroup
+	for i, customer := range customers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := switchRequest("/tiles/switched/3/1/1", map[string]string{"X-Customer": customer}, "")
+			img, err := lg.RenderTile(ctx, pkg.TileRequest{LayerName: "switched", Z: 3, X: 1, Y: 1})
+			assert.NoError(t, err)
+			imgs[i] = img
+		}()
+	}
+	wg.Wait()
+
+	for i, customer := range customers {
+		if assert.NotNil(t, imgs[i]) {
+			assert.Equal(t, map[string]string{"acme": "/acme", "globex": "/other"}[customer], string(imgs[i].Content))
+		}
+	}
+	require.Eventually(t, func() bool { return c.count() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_SwitchPercent(t *testing.T) {
+	ten, thirty := 10.0, 30.0
+	sw := makeSwitch(t, []SwitchRule{{Key: "ctx.user", Percent: &ten}, {Key: "ctx.user", Percent: &thirty}}, "new", "next")
+
+	counts := map[string]int{}
+	for i := range 2000 {
+		ctx := switchRequest("/tiles/l/3/1/1", nil, "user"+strconv.Itoa(i))
+		chosen := chooseSwitch(ctx, t, sw)
+		counts[chosen]++
+
+		// The same user always gets the same provider
+		again := chooseSwitch(ctx, t, sw)
+		assert.Equal(t, chosen, again)
+	}
+
+	// The second rule only gets the users the first didn't already take
+	assert.InDelta(t, 200, counts["new"], 60)
+	assert.InDelta(t, 400, counts["next"], 80)
+	assert.InDelta(t, 1400, counts["default"], 100)
+
+	// Raising the percentage keeps everyone who was already switched
+	twenty := 20.0
+	wider := makeSwitch(t, []SwitchRule{{Key: "ctx.user", Percent: &twenty}}, "new")
+	for i := range 2000 {
+		ctx := switchRequest("/tiles/l/3/1/1", nil, "user"+strconv.Itoa(i))
+		before := chooseSwitch(ctx, t, sw)
+		after := chooseSwitch(ctx, t, wider)
+		if before == "new" {
+			assert.Equal(t, "new", after)
+		}
+	}
+
+	chosen := chooseSwitch(switchRequest("/tiles/l/3/1/1", nil, ""), t, sw)
+	assert.Equal(t, "default", chosen)
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"image"
+	"image/color"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// newTextFace makes a face for drawing text in a font, size pixels high. A face caches glyphs
+// without any locking, so each drawing needs its own rather than sharing one between requests
+func newTextFace(parsed *opentype.Font, size float64) (font.Face, error) {
+	// At 72 DPI a point is a pixel
+	return opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// drawText draws text, one line per line break, onto a transparent image just big enough for it
+func drawText(face font.Face, col color.Color, text string) *image.NRGBA {
+	lines := strings.Split(text, "\n")
+	metrics := face.Metrics()
+
+	width := fixed.Int26_6(0)
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line))
+	}
+
+	height := metrics.Height*fixed.Int26_6(len(lines)-1) + metrics.Ascent + metrics.Descent
+	out := image.NewNRGBA(image.Rect(0, 0, width.Ceil(), height.Ceil()))
+
+	drawer := font.Drawer{Dst: out, Src: image.NewUniform(col), Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.Point26_6{X: 0, Y: metrics.Ascent + metrics.Height*fixed.Int26_6(i)}
+		drawer.DrawString(line)
+	}
+
+	return out
+}
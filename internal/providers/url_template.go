@@ -15,7 +15,6 @@
 package providers
 
 import (
-	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -29,16 +28,14 @@ type URLTemplateConfig struct {
 	Width    uint16
 	Height   uint16
 	Srid     uint
+	Metatile uint16
+	OAuth2   *OAuth2Config
 }
 
 type URLTemplate struct {
 	Proxy
 }
 
-func (t URLTemplate) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
-	return layer.ProviderContext{AuthBypass: true}, nil
-}
-
 func init() {
 	layer.RegisterProvider(URLTemplateRegistration{})
 }
@@ -60,14 +57,6 @@ func (s URLTemplateRegistration) Initialize(cfgAny any, deps layer.ProviderDeps)
 		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.url template.url", "")
 	}
 
-	if cfg.Height == 0 {
-		cfg.Height = 256
-	}
-
-	if cfg.Width == 0 {
-		cfg.Width = 256
-	}
-
 	if cfg.Srid == 0 {
 		cfg.Srid = pkg.SRIDWGS84
 	}
@@ -80,14 +69,23 @@ func (s URLTemplateRegistration) Initialize(cfgAny any, deps layer.ProviderDeps)
 	url = strings.ReplaceAll(url, "$ymin", "{ymin}")
 	url = strings.ReplaceAll(url, "$ymax", "{ymax}")
 	url = strings.ReplaceAll(url, "$zoom", "{z}")
-	url = strings.ReplaceAll(url, "$width", strconv.Itoa(int(cfg.Width)))
-	url = strings.ReplaceAll(url, "$height", strconv.Itoa(int(cfg.Height)))
+	url = strings.ReplaceAll(url, "$width", "{width}")
+	url = strings.ReplaceAll(url, "$height", "{height}")
 	url = strings.ReplaceAll(url, "$srs", strconv.FormatUint(uint64(cfg.Srid), 10))
 
 	proxyCfg := ProxyConfig{
-		URL:  url,
-		Srid: cfg.Srid,
+		URL:      url,
+		Srid:     cfg.Srid,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Metatile: cfg.Metatile,
+		OAuth2:   cfg.OAuth2,
+	}
+
+	proxy, err := newProxy(proxyCfg, deps, "provider.url template")
+	if err != nil {
+		return nil, err
 	}
 
-	return &URLTemplate{Proxy{proxyCfg, deps.ClientConfig}}, nil
+	return &URLTemplate{*proxy}, nil
 }
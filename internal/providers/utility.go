@@ -15,8 +15,11 @@
 package providers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"net/url"
 	"os"
@@ -27,9 +30,12 @@ import (
 
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/anthonynsimon/bild/transform"
 )
 
 const mimePng = "image/png"
+const mimeJpeg = "image/jpeg"
+const mimeWebp = "image/webp"
 
 var envRegex = regexp.MustCompile(`{env\.[^{}}]*}`)
 var ctxRegex = regexp.MustCompile(`{ctx\.[^{}}]*}`)
@@ -37,6 +43,22 @@ var lyrRegex = regexp.MustCompile(`{layer\.[^{}}]*}`)
 
 const mvtContentType = "application/vnd.mapbox-vector-tile"
 
+// Older servers describe vector tiles by their encoding instead
+const mvtProtobufContentType = "application/x-protobuf"
+
+// Filters available to providers that resize imagery, by the name used in configuration
+var allResamplingFilters = []string{"nearest", "box", "bilinear", "gaussian", "mitchell", "catmullrom", "lanczos"}
+
+var resamplingFilters = map[string]transform.ResampleFilter{
+	"nearest":    transform.NearestNeighbor,
+	"box":        transform.Box,
+	"bilinear":   transform.Linear,
+	"gaussian":   transform.Gaussian,
+	"mitchell":   transform.MitchellNetravali,
+	"catmullrom": transform.CatmullRom,
+	"lanczos":    transform.Lanczos,
+}
+
 // placeholderSource identifies where a replacement value originated so callers that splice the
 // value into something else (e.g. a URL) can decide whether it needs escaping.
 type placeholderSource int
@@ -50,7 +72,14 @@ const (
 	sourceLayer
 )
 
-func replaceURLPlaceholders(ctx context.Context, tileRequest pkg.TileRequest, rawURL string, invertY bool, srid uint) (string, error) {
+func replaceURLPlaceholders(ctx context.Context, tileRequest pkg.TileRequest, rawURL string, invertY bool, srid uint, subdomains []string) (string, error) {
+	// The subdomain comes from the configuration rather than the request so it's inserted as-is.
+	// It's chosen from the tile's position, like Leaflet does, so a tile always maps to the same
+	// host and upstream caches stay warm
+	if len(subdomains) > 0 {
+		rawURL = strings.ReplaceAll(rawURL, "{s}", subdomains[(tileRequest.X+tileRequest.Y)%len(subdomains)])
+	}
+
 	// replacePlaceholdersInString assigns $N in a fixed source order, so counting each category up
 	// front is enough to classify each $N afterwards. It keeps returning plain values because
 	// postgis uses it for SQL params, where the source tag is meaningless.
@@ -74,17 +103,53 @@ func replaceURLPlaceholders(ctx context.Context, tileRequest pkg.TileRequest, ra
 		}
 	}
 
-	// A single left-to-right scan, so substituted text is never re-examined. Repeated ReplaceAll
-	// passes would be unsafe at any ordering: a request-derived value containing a literal "$0"
-	// survives escaping ("$" is escaped by neither PathEscape nor QueryEscape) and a later pass
-	// would then splice the operator's unescaped {env.*} value, typically a secret, into the
-	// outbound URL and the debug log. One scan makes inserted text inert by construction.
-	var out strings.Builder
 	queryStart := strings.Index(rawURL, "?")
 
-	for i := 0; i < len(rawURL); {
-		if rawURL[i] != '$' {
-			out.WriteByte(rawURL[i])
+	return substituteParams(rawURL, replacements, func(idx int, pos int, value string) string {
+		// {env.*} must be allowed to carry a scheme, host, and slashes, since injecting a whole
+		// base URL is the documented use for it. The request-derived sources are escaped: an
+		// unescaped "?", "#", or "/" would let a User inject query parameters, truncate the path,
+		// or traverse it.
+		if sourceFor(idx) == sourceEnv {
+			return value
+		}
+
+		// Escape for the position the value lands in. Positions are measured against the
+		// template, since an {env.*} value substituted in this same scan could contain a "?"
+		// and must not retroactively change how later values are escaped.
+		if queryStart >= 0 && pos > queryStart {
+			return url.QueryEscape(value)
+		}
+
+		return url.PathEscape(value)
+	}), nil
+}
+
+// replaceTextPlaceholders fills in the placeholders of text that's displayed rather than sent
+// anywhere, so values go in as they are
+func replaceTextPlaceholders(ctx context.Context, tileRequest pkg.TileRequest, text string) (string, error) {
+	text, replacements, err := replacePlaceholdersInString(ctx, tileRequest, text, 0, false, pkg.SRIDWGS84)
+	if err != nil {
+		return "", err
+	}
+
+	return substituteParams(text, replacements, func(_ int, _ int, value string) string { return value }), nil
+}
+
+// substituteParams swaps the $N placeholders produced by replacePlaceholdersInString for their
+// values, as returned by format given the index of the value and the position of the placeholder.
+//
+// It's a single left-to-right scan, so substituted text is never re-examined. Repeated ReplaceAll
+// passes would be unsafe at any ordering: a request-derived value containing a literal "$0"
+// survives escaping ("$" is escaped by neither PathEscape nor QueryEscape) and a later pass
+// would then splice the operator's unescaped {env.*} value, typically a secret, into the
+// outbound URL and the debug log. One scan makes inserted text inert by construction.
+func substituteParams(str string, replacements []any, format func(idx int, pos int, value string) string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(str); {
+		if str[i] != '$' {
+			out.WriteByte(str[i])
 			i++
 			continue
 		}
@@ -92,42 +157,24 @@ func replaceURLPlaceholders(ctx context.Context, tileRequest pkg.TileRequest, ra
 		// Take the longest run of digits after '$' so "$10" reads as index 10, not index 1
 		// followed by a literal "0".
 		j := i + 1
-		for j < len(rawURL) && rawURL[j] >= '0' && rawURL[j] <= '9' {
+		for j < len(str) && str[j] >= '0' && str[j] <= '9' {
 			j++
 		}
 
-		idx, err := strconv.Atoi(rawURL[i+1 : j])
+		idx, err := strconv.Atoi(str[i+1 : j])
 		if j == i+1 || err != nil || idx >= len(replacements) {
 			// Not a placeholder this call produced (a literal "$", or an index out of range):
 			// emit it untouched.
-			out.WriteByte(rawURL[i])
+			out.WriteByte(str[i])
 			i++
 			continue
 		}
 
-		value := fmt.Sprint(replacements[idx])
-
-		// {env.*} must be allowed to carry a scheme, host, and slashes, since injecting a whole
-		// base URL is the documented use for it. The request-derived sources are escaped: an
-		// unescaped "?", "#", or "/" would let a User inject query parameters, truncate the path,
-		// or traverse it.
-		if sourceFor(idx) == sourceEnv {
-			out.WriteString(value)
-		} else {
-			// Escape for the position the value lands in. Positions are measured against the
-			// template, since an {env.*} value substituted in this same scan could contain a "?"
-			// and must not retroactively change how later values are escaped.
-			if queryStart >= 0 && i > queryStart {
-				out.WriteString(url.QueryEscape(value))
-			} else {
-				out.WriteString(url.PathEscape(value))
-			}
-		}
-
+		out.WriteString(format(idx, i, fmt.Sprint(replacements[idx])))
 		i = j
 	}
 
-	return out.String(), nil
+	return out.String()
 }
 
 // Replaces arbitrary application specific placeholders in an arbitrary string with more generic prepared statement style placeholders and returns a mapping of those final placeholders to the real values.  e.g. "blah {env.foo} blah" -> "blah $1 blah" and {"$1": "bar"}
@@ -169,15 +216,8 @@ func replacePlaceholdersInString(ctx context.Context, tileRequest pkg.TileReques
 		for _, ctxMatch := range ctxMatches {
 			ctxVar := ctxMatch[5 : len(ctxMatch)-1]
 
-			val := ctx.Value(ctxVar)
-			valVal := reflect.ValueOf(val)
-
-			if valVal.Kind() == reflect.Pointer {
-				val = valVal.Elem().Interface()
-			}
-
 			param := "$" + strconv.Itoa(paramIndex)
-			replacements = append(replacements, fmt.Sprint(val))
+			replacements = append(replacements, fmt.Sprint(contextValue(ctx, ctxVar)))
 			str = strings.Replace(str, ctxMatch, param, 1)
 			paramIndex++
 		}
@@ -218,8 +258,38 @@ func replacePlaceholdersInString(ctx context.Context, tileRequest pkg.TileReques
 	return str, replacements, nil
 }
 
+// contextValue looks up a {ctx.*} placeholder's value, such as a header or the user. Some values
+// are held by pointer so auth can fill them in after the context is made, and those are followed
+func contextValue(ctx context.Context, name string) any {
+	val := ctx.Value(name)
+	valVal := reflect.ValueOf(val)
+
+	if valVal.Kind() == reflect.Pointer {
+		val = valVal.Elem().Interface()
+	}
+
+	return val
+}
+
 // getTile is an alias for the call sites in this package. The implementation lives in pkg so
 // library consumers writing their own Go providers can call it too.
 func getTile(ctx context.Context, clientConfig config.ClientConfig, url string, authHeaders map[string]string) (*pkg.Image, error) {
 	return pkg.GetTile(ctx, clientConfig, url, authHeaders)
 }
+
+// Pregenerated vector tiles are conventionally stored gzipped. Callers that hand tiles straight to a
+// client or merge them need the raw protobuf, so this decompresses only when the gzip magic number
+// is present and otherwise returns the input untouched
+func decompressIfGzipped(content []byte) ([]byte, error) {
+	if len(content) < 2 || content[0] != 0x1f || content[1] != 0x8b {
+		return content, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
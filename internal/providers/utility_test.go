@@ -31,7 +31,7 @@ func Test_ReplaceURLPlaceholders_EscapesInjectionInPath(t *testing.T) {
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "evil?extra=param"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "?extra=param")
@@ -43,7 +43,7 @@ func Test_ReplaceURLPlaceholders_EscapesPathTraversal(t *testing.T) {
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "../../escaped"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "/../../escaped/")
@@ -55,7 +55,7 @@ func Test_ReplaceURLPlaceholders_EscapesFragmentInjection(t *testing.T) {
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "evil#fragment"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "#fragment")
@@ -67,7 +67,7 @@ func Test_ReplaceURLPlaceholders_EscapesInQueryPosition(t *testing.T) {
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "value&injected=1"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles?layer={layer.v}&z={z}", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles?layer={layer.v}&z={z}", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "&injected=1")
@@ -79,7 +79,7 @@ func Test_ReplaceURLPlaceholders_NormalValuesStillWork(t *testing.T) {
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "20230917a"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.Equal(t, "https://example.com/tiles/20230917a/1/1/0.png", result)
@@ -92,7 +92,7 @@ func Test_ReplaceURLPlaceholders_EnvValuePassesThroughUnescaped(t *testing.T) {
 
 	ctx := pkg.BackgroundContext()
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "{env.TILEGROXY_TEST_BASEURL}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "{env.TILEGROXY_TEST_BASEURL}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.Equal(t, "https://tiles.example.com/v1/1/1/0.png", result)
@@ -104,7 +104,7 @@ func Test_ReplaceURLPlaceholders_EnvValueWithQueryStringPassesThroughUnescaped(t
 
 	ctx := pkg.BackgroundContext()
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{z}/{x}/{y}{env.TILEGROXY_TEST_SUFFIX}", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{z}/{x}/{y}{env.TILEGROXY_TEST_SUFFIX}", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.Equal(t, "https://example.com/tiles/1/1/0?key=abc&fmt=png", result)
@@ -118,7 +118,7 @@ func Test_ReplaceURLPlaceholders_CtxValueIsEscaped(t *testing.T) {
 
 	ctx := pkg.NewRequestContext(req)
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{ctx.User-Agent}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{ctx.User-Agent}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "?extra=param")
@@ -133,7 +133,7 @@ func Test_ReplaceURLPlaceholders_CtxValueNormalStillWorks(t *testing.T) {
 
 	ctx := pkg.NewRequestContext(req)
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{z}/{x}/{y}.png?agent={ctx.User-Agent}", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/tiles/{z}/{x}/{y}.png?agent={ctx.User-Agent}", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.Equal(t, "https://example.com/tiles/1/1/0.png?agent=my-agent", result)
@@ -148,7 +148,7 @@ func Test_ReplaceURLPlaceholders_MixedEnvAndLayerOnlyEscapesLayer(t *testing.T)
 	lpm, _ := pkg.LayerPatternMatchesFromContext(ctx)
 	(*lpm)["v"] = "evil?x=1"
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "{env.TILEGROXY_TEST_HOST}/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "{env.TILEGROXY_TEST_HOST}/tiles/{layer.v}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, result)
@@ -170,7 +170,7 @@ func Test_ReplaceURLPlaceholders_CtxValueCannotReinjectPlaceholder(t *testing.T)
 
 	ctx := pkg.NewRequestContext(req)
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/{env.TILEGROXY_TEST_SECRET}/{ctx.User-Agent}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/{env.TILEGROXY_TEST_SECRET}/{ctx.User-Agent}/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "super-secret-value/super-secret-value")
@@ -187,7 +187,7 @@ func Test_ReplaceURLPlaceholders_CtxValueCannotReinjectPlaceholderInQuery(t *tes
 
 	ctx := pkg.NewRequestContext(req)
 
-	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/{env.TILEGROXY_TEST_SECRET}/{z}/{x}/{y}.png?agent={ctx.User-Agent}", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(ctx, pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/{env.TILEGROXY_TEST_SECRET}/{z}/{x}/{y}.png?agent={ctx.User-Agent}", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "agent=super-secret-value")
@@ -206,7 +206,7 @@ func Test_ReplaceURLPlaceholders_DoubleDigitIndices(t *testing.T) {
 	}
 	template += templateSb200.String()
 
-	result, err := replaceURLPlaceholders(pkg.BackgroundContext(), pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com"+template, false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(pkg.BackgroundContext(), pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com"+template, false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.NotContains(t, result, "$")
@@ -218,8 +218,25 @@ func Test_ReplaceURLPlaceholders_DoubleDigitIndices(t *testing.T) {
 // A literal "$" in the template that isn't one of our generated placeholders must pass through
 // untouched.
 func Test_ReplaceURLPlaceholders_LiteralDollarPreserved(t *testing.T) {
-	result, err := replaceURLPlaceholders(pkg.BackgroundContext(), pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/a$b/c$/{z}/{x}/{y}.png", false, pkg.SRIDWGS84)
+	result, err := replaceURLPlaceholders(pkg.BackgroundContext(), pkg.TileRequest{Z: 1, X: 1, Y: 0}, "https://example.com/a$b/c$/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, nil)
 
 	require.NoError(t, err)
 	require.Equal(t, "https://example.com/a$b/c$/1/1/0.png", result)
 }
+
+// The subdomain is picked from the tile so the same tile always goes to the same host
+func Test_ReplaceURLPlaceholders_Subdomains(t *testing.T) {
+	subdomains := []string{"a", "b", "c"}
+
+	for tile, expected := range map[pkg.TileRequest]string{
+		{Z: 2, X: 0, Y: 0}: "https://a.example.com/2/0/0.png",
+		{Z: 2, X: 1, Y: 0}: "https://b.example.com/2/1/0.png",
+		{Z: 2, X: 1, Y: 1}: "https://c.example.com/2/1/1.png",
+		{Z: 2, X: 3, Y: 3}: "https://a.example.com/2/3/3.png",
+	} {
+		result, err := replaceURLPlaceholders(pkg.BackgroundContext(), tile, "https://{s}.example.com/{z}/{x}/{y}.png", false, pkg.SRIDWGS84, subdomains)
+
+		require.NoError(t, err)
+		require.Equal(t, expected, result)
+	}
+}
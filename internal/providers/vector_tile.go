@@ -0,0 +1,85 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"math"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/project"
+)
+
+func isMVT(img *pkg.Image) bool {
+	return img.ContentType == mvtContentType || img.ContentType == mvtProtobufContentType
+}
+
+// decodeMVT reads the layers of a vector tile, which may be gzipped. An empty tile has no layers
+func decodeMVT(img *pkg.Image) (mvt.Layers, error) {
+	if len(img.Content) == 0 {
+		return mvt.Layers{}, nil
+	}
+
+	content, err := decompressIfGzipped(img.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return mvt.Unmarshal(content)
+}
+
+// encodeMVT writes layers out as an uncompressed vector tile
+func encodeMVT(layers mvt.Layers, forceSkipCache bool) (*pkg.Image, error) {
+	content, err := mvt.Marshal(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: content, ContentType: mvtContentType, ForceSkipCache: forceSkipCache}, nil
+}
+
+// mvtExtent is the extent of a layer, falling back on the spec's default for layers that leave it out
+func mvtExtent(l *mvt.Layer) uint32 {
+	if l.Extent == 0 {
+		return mvt.DefaultExtent
+	}
+
+	return l.Extent
+}
+
+// transformMVTLayer applies fn to every point in the layer, rounding the result to the integer
+// grid the encoding requires
+func transformMVTLayer(l *mvt.Layer, fn func(orb.Point) orb.Point) {
+	for _, f := range l.Features {
+		f.Geometry = project.Geometry(f.Geometry, func(p orb.Point) orb.Point {
+			p = fn(p)
+			return orb.Point{math.Round(p[0]), math.Round(p[1])}
+		})
+	}
+}
+
+// mergeMVTLayer adds the features of l to existing, rescaling them first if the extents differ
+func mergeMVTLayer(existing *mvt.Layer, l *mvt.Layer) {
+	if mvtExtent(l) != mvtExtent(existing) {
+		factor := float64(mvtExtent(existing)) / float64(mvtExtent(l))
+		transformMVTLayer(l, func(p orb.Point) orb.Point {
+			return orb.Point{p[0] * factor, p[1] * factor}
+		})
+	}
+
+	existing.Version = max(existing.Version, l.Version)
+	existing.Features = append(existing.Features, l.Features...)
+}
@@ -0,0 +1,332 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Michad/tilegroxy/internal/images"
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/Michad/tilegroxy/pkg/entities/lifecycle"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+const watermarkJpegQuality = 90
+
+var allWatermarkPositions = []string{"top-left", "top", "top-right", "left", "center", "right", "bottom-left", "bottom", "bottom-right"}
+
+type WatermarkConfig struct {
+	Text     string   // Text to draw, which may contain placeholders
+	Image    string   // PNG to draw instead of text
+	Font     string   // TrueType or OpenType font file for text, defaults to Go Regular
+	Size     float64  // Height of text in pixels
+	Color    string   // Color of text
+	Opacity  *float64 // From 0 for invisible to 1 for opaque
+	Position string   // Where in the tile to draw the watermark
+	Margin   int      // Pixels between the watermark and the edge of the tile
+	Spacing  int      // Pixels between copies when repeating the watermark across the tile. 0 draws it once
+	Every    int      // Only stamp one in this many tiles
+	Zoom     string   // Only stamp tiles at these zoom levels
+	Provider map[string]interface{}
+}
+
+type Watermark struct {
+	WatermarkConfig
+	font     *opentype.Font
+	color    color.NRGBA
+	mark     *image.NRGBA // The prepared image, or nil for text
+	zooms    []int
+	provider layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(WatermarkRegistration{})
+}
+
+type WatermarkRegistration struct {
+}
+
+func (s WatermarkRegistration) InitializeConfig() any {
+	return WatermarkConfig{}
+}
+
+func (s WatermarkRegistration) Name() string {
+	return "watermark"
+}
+
+func (s WatermarkRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(WatermarkConfig)
+	t := &Watermark{}
+
+	if cfg.Text == "" && cfg.Image == "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.OneOfRequired, []string{"provider.watermark.text", "provider.watermark.image"})
+	}
+
+	if cfg.Text != "" && cfg.Image != "" {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamsMutuallyExclusive, "provider.watermark.text", "provider.watermark.image")
+	}
+
+	if cfg.Opacity == nil {
+		opacity := 1.0
+		cfg.Opacity = &opacity
+	}
+
+	if *cfg.Opacity < 0 || *cfg.Opacity > 1 {
+		return nil, fmt.Errorf(deps.ErrorMessages.RangeError, "provider.watermark.opacity", 0, 1)
+	}
+
+	if cfg.Position == "" {
+		cfg.Position = "bottom-right"
+	}
+
+	if !slices.Contains(allWatermarkPositions, cfg.Position) {
+		return nil, fmt.Errorf(deps.ErrorMessages.EnumError, "provider.watermark.position", cfg.Position, allWatermarkPositions)
+	}
+
+	if cfg.Margin < 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.margin", cfg.Margin)
+	}
+
+	if cfg.Spacing < 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.spacing", cfg.Spacing)
+	}
+
+	if cfg.Every == 0 {
+		cfg.Every = 1
+	}
+
+	if cfg.Every < 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.every", cfg.Every)
+	}
+
+	if cfg.Zoom != "" {
+		zooms, err := pkg.ParseZoomString(cfg.Zoom)
+		if err != nil {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.zoom", cfg.Zoom)
+		}
+		t.zooms = zooms
+	}
+
+	if cfg.Image != "" {
+		content, err := images.GetStaticImage(cfg.Image)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, _, err := image.Decode(bytes.NewReader(*content))
+		if err != nil {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.image", cfg.Image)
+		}
+
+		t.mark = image.NewNRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+		draw.Draw(t.mark, t.mark.Rect, decoded, decoded.Bounds().Min, draw.Src)
+	} else {
+		if cfg.Size == 0 {
+			cfg.Size = 12
+		}
+
+		if cfg.Size < 0 {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.size", cfg.Size)
+		}
+
+		if cfg.Color == "" {
+			cfg.Color = "000"
+		}
+
+		col, err := images.ParseColor(cfg.Color)
+		if err != nil {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.color", cfg.Color)
+		}
+		t.color = col
+
+		fontData := goregular.TTF
+		if cfg.Font != "" {
+			fontData, err = os.ReadFile(cfg.Font)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		t.font, err = opentype.Parse(fontData)
+		if err != nil {
+			return nil, fmt.Errorf(deps.ErrorMessages.InvalidParam, "provider.watermark.font", cfg.Font)
+		}
+
+		// Text from the request, such as the user, differs between requests for the same tile
+		if ctxRegex.MatchString(cfg.Text) {
+			placeholders := strings.Join(ctxRegex.FindAllString(cfg.Text, -1), "\n")
+			deps.VaryCache(func(ctx context.Context) string {
+				return watermarkVariant(ctx, placeholders)
+			})
+		}
+	}
+
+	provider, err := layer.ConstructProvider(cfg.Provider, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	t.WatermarkConfig = cfg
+	t.provider = provider
+	return t, nil
+}
+
+func (t Watermark) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return t.provider.PreAuth(ctx, providerContext)
+}
+
+// Close releases the child provider. Watermark holds it directly rather than through a Layer, so
+// it's unreachable from LayerGroup.Close without this.
+func (t Watermark) Close(ctx context.Context) error {
+	return lifecycle.CloseIfCloser(ctx, t.provider)
+}
+
+func (t Watermark) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	img, err := t.provider.GenerateTile(ctx, providerContext, tileRequest)
+	if err != nil || img == nil {
+		return img, err
+	}
+
+	if t.zooms != nil && !slices.Contains(t.zooms, tileRequest.Z) {
+		return img, nil
+	}
+
+	// Adding the coordinates spreads the stamped tiles out diagonally rather than in columns
+	if (tileRequest.X+tileRequest.Y)%t.Every != 0 {
+		return img, nil
+	}
+
+	if isMVT(img) {
+		return nil, fmt.Errorf("watermark requires imagery but got %v", img.ContentType)
+	}
+
+	mark := t.mark
+
+	if mark == nil {
+		text, err := replaceTextPlaceholders(ctx, tileRequest, t.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		face, err := newTextFace(t.font, t.Size)
+		if err != nil {
+			return nil, err
+		}
+		defer face.Close()
+
+		mark = drawText(face, t.color, text)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Rect, decoded, bounds.Min, draw.Src)
+
+	opacity := image.NewUniform(color.Alpha{uint8(math.Round(*t.Opacity * 255))})
+	for _, pt := range t.placements(tileRequest, out.Rect.Size(), mark.Rect.Size()) {
+		draw.DrawMask(out, mark.Rect.Add(pt), mark, image.Point{}, opacity, image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	isJpeg := img.ContentType == mimeJpeg
+	if isJpeg {
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: watermarkJpegQuality})
+	} else {
+		err = png.Encode(&buf, out)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.Image{Content: buf.Bytes(), ContentType: pkg.Ternary(isJpeg, mimeJpeg, mimePng), ForceSkipCache: img.ForceSkipCache}, nil
+}
+
+// watermarkVariant gives what the request fills the {ctx.*} placeholders of the text in with,
+// hashed to keep the cache key short whatever the values are
+func watermarkVariant(ctx context.Context, placeholders string) string {
+	text, err := replaceTextPlaceholders(ctx, pkg.TileRequest{}, placeholders)
+	if err != nil {
+		return ""
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(text))
+
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// placements gives the top left corner of each copy of the watermark in the tile. Repeated copies
+// sit on a grid anchored to the whole map rather than the tile so the pattern continues unbroken
+// from one tile to the next
+func (t Watermark) placements(tileRequest pkg.TileRequest, tile image.Point, mark image.Point) []image.Point {
+	if t.Spacing == 0 {
+		var x, y int
+
+		switch {
+		case strings.HasSuffix(t.Position, "left"):
+			x = t.Margin
+		case strings.HasSuffix(t.Position, "right"):
+			x = tile.X - mark.X - t.Margin
+		default:
+			x = (tile.X - mark.X) / 2
+		}
+
+		switch {
+		case strings.HasPrefix(t.Position, "top"):
+			y = t.Margin
+		case strings.HasPrefix(t.Position, "bottom"):
+			y = tile.Y - mark.Y - t.Margin
+		default:
+			y = (tile.Y - mark.Y) / 2
+		}
+
+		return []image.Point{{x, y}}
+	}
+
+	stepX, stepY := mark.X+t.Spacing, mark.Y+t.Spacing
+
+	// Where the grid starts, at or just before the tile's top left corner
+	offsetX := -((tileRequest.X * tile.X) % stepX)
+	offsetY := -((tileRequest.Y * tile.Y) % stepY)
+
+	points := make([]image.Point, 0)
+	for y := offsetY; y < tile.Y; y += stepY {
+		for x := offsetX; x < tile.X; x += stepX {
+			points = append(points, image.Point{x, y})
+		}
+	}
+
+	return points
+}
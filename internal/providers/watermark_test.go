@@ -0,0 +1,232 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeWatermark(t *testing.T, cfg WatermarkConfig) *Watermark {
+	t.Helper()
+
+	cfg.Provider = map[string]interface{}{"name": "static", "color": "FFF"}
+	p, err := WatermarkRegistration{}.Initialize(cfg, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	return p.(*Watermark)
+}
+
+func renderWatermark(ctx context.Context, t *testing.T, w *Watermark, tileRequest pkg.TileRequest) (*pkg.Image, image.Image) {
+	t.Helper()
+
+	img, err := w.GenerateTile(ctx, layer.ProviderContext{}, tileRequest)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Content))
+	require.NoError(t, err)
+
+	return img, decoded
+}
+
+// countNonWhite gives how many pixels of an area aren't white
+func countNonWhite(img image.Image, area image.Rectangle) int {
+	count := 0
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) != (color.NRGBA{255, 255, 255, 255}) {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+func Test_WatermarkValidate(t *testing.T) {
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+	tooOpaque := 1.5
+
+	_, err := WatermarkRegistration{}.Initialize(WatermarkConfig{Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Image: "test_files/10_pixel_blue.png", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Opacity: &tooOpaque, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Position: "middle", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Color: "purple", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Zoom: "x", Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Every: -1, Provider: s}, deps)
+	require.Error(t, err)
+
+	_, err = WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Font: "test_files/10_pixel_blue.png", Provider: s}, deps)
+	require.Error(t, err)
+
+	p, err := WatermarkRegistration{}.Initialize(WatermarkConfig{Text: "a", Provider: s}, deps)
+	require.NoError(t, err)
+	assert.Equal(t, "bottom-right", p.(*Watermark).Position)
+	assert.InDelta(t, 12.0, p.(*Watermark).Size, 0)
+	assert.Equal(t, 1, p.(*Watermark).Every)
+}
+
+func Test_WatermarkText(t *testing.T) {
+	w := makeWatermark(t, WatermarkConfig{Text: "© Example", Size: 20, Margin: 4})
+
+	img, decoded := renderWatermark(context.Background(), t, w, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1})
+	assert.Equal(t, mimePng, img.ContentType)
+	assert.False(t, img.ForceSkipCache)
+
+	assert.Positive(t, countNonWhite(decoded, image.Rect(412, 482, 508, 508)))
+	assert.Zero(t, countNonWhite(decoded, image.Rect(0, 0, 412, 482)))
+	assert.Zero(t, countNonWhite(decoded, image.Rect(0, 508, 512, 512)))
+}
+
+func Test_WatermarkImageOpacity(t *testing.T) {
+	half := 0.5
+	w := makeWatermark(t, WatermarkConfig{Image: "test_files/10_pixel_blue.png", Opacity: &half, Position: "top-left", Margin: 2})
+
+	_, decoded := renderWatermark(context.Background(), t, w, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1})
+
+	r, g, b, _ := decoded.At(5, 5).RGBA()
+	assert.InDelta(t, 128, r>>8, 2)
+	assert.InDelta(t, 128, g>>8, 2)
+	assert.Equal(t, uint32(255), b>>8)
+	assert.Equal(t, 100, countNonWhite(decoded, decoded.Bounds()))
+}
+
+func Test_WatermarkRepeat(t *testing.T) {
+	w := makeWatermark(t, WatermarkConfig{Image: "test_files/10_pixel_blue.png", Spacing: 5})
+
+	// The grid repeats every 15 pixels from the corner of the map, which is 2 pixels left of this
+	// tile since 512 isn't a multiple of 15
+	_, decoded := renderWatermark(context.Background(), t, w, pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 0})
+
+	assert.Positive(t, countNonWhite(decoded, image.Rect(0, 0, 8, 1)))
+	assert.Zero(t, countNonWhite(decoded, image.Rect(8, 0, 13, 1)))
+	assert.Equal(t, 10, countNonWhite(decoded, image.Rect(13, 0, 28, 1)))
+}
+
+func Test_WatermarkFilters(t *testing.T) {
+	w := makeWatermark(t, WatermarkConfig{Text: "x", Every: 2, Zoom: "3-5"})
+	original, err := w.provider.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 3, X: 0, Y: 0})
+	require.NoError(t, err)
+
+	for tile, stamped := range map[pkg.TileRequest]bool{
+		{LayerName: "l", Z: 3, X: 1, Y: 1}: true,
+		{LayerName: "l", Z: 3, X: 1, Y: 2}: false,
+		{LayerName: "l", Z: 6, X: 1, Y: 1}: false,
+	} {
+		img, err := w.GenerateTile(context.Background(), layer.ProviderContext{}, tile)
+		require.NoError(t, err)
+		assert.Equal(t, stamped, !bytes.Equal(original.Content, img.Content), tile)
+	}
+}
+
+func Test_WatermarkTemplate(t *testing.T) {
+	w := makeWatermark(t, WatermarkConfig{Text: "{ctx.user}", Size: 20, Position: "center"})
+	tile := pkg.TileRequest{LayerName: "l", Z: 3, X: 1, Y: 1}
+
+	render := func(user string) (*pkg.Image, image.Image) {
+		ctx := pkg.NewRequestContext(httptest.NewRequest("GET", "/tiles/l/3/1/1", nil))
+		id, _ := pkg.UserIDFromContext(ctx)
+		*id = user
+		return renderWatermark(ctx, t, w, tile)
+	}
+
+	img, short := render("al")
+	assert.False(t, img.ForceSkipCache)
+	_, long := render("alexandra")
+
+	assert.Less(t, countNonWhite(short, short.Bounds()), countNonWhite(long, long.Bounds()))
+
+	w = makeWatermark(t, WatermarkConfig{Text: "{z}/{x}/{y}"})
+	img, _ = renderWatermark(context.Background(), t, w, tile)
+	assert.False(t, img.ForceSkipCache)
+}
+
+// Each user gets their own name on the tile, even when they ask for it at the same time, and it's
+// cached separately for each
+func Test_WatermarkTemplateInLayer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Layers = []config.LayerConfig{
+		{ID: "marked", Provider: map[string]any{
+			"name":     "watermark",
+			"text":     "{ctx.user}",
+			"position": "center",
+			"provider": map[string]any{"name": "static", "color": "FFF"},
+		}},
+	}
+
+	c := &memoryCache{recordingCache{saved: make(map[pkg.TileRequest]*pkg.Image)}}
+	lg, err := layer.ConstructLayerGroup(cfg, c, nil, nil)
+	require.NoError(t, err)
+
+	users := []string{"al", "alexandra", "al", "alexandra", "al", "alexandra"}
+	imgs := make([]*pkg.Image, len(users))
+
+	var wg sync.WaitGroup
+	for i, user := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := pkg.NewRequestContext(httptest.NewRequest("GET", "/tiles/marked/3/1/1", nil))
+			id, _ := pkg.UserIDFromContext(ctx)
+			*id = user
+
+			img, err := lg.RenderTile(ctx, pkg.TileRequest{LayerName: "marked", Z: 3, X: 1, Y: 1})
+			assert.NoError(t, err)
+			imgs[i] = img
+		}()
+	}
+	wg.Wait()
+
+	for i := range users {
+		assert.Equal(t, imgs[i%2].Content, imgs[i].Content)
+	}
+	assert.NotEqual(t, imgs[0].Content, imgs[1].Content)
+	require.Eventually(t, func() bool { return c.count() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_WatermarkRejectsMVT(t *testing.T) {
+	w := makeWatermark(t, WatermarkConfig{Text: "x"})
+	w.provider = &recordingProvider{img: &pkg.Image{Content: []byte{0x1a, 0x00}, ContentType: mvtContentType}}
+
+	_, err := w.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: 1, X: 0, Y: 0})
+	require.Error(t, err)
+}
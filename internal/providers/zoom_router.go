@@ -0,0 +1,131 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+)
+
+type ZoomRoute struct {
+	Zoom     string // The zoom levels to send to Provider
+	Provider map[string]interface{}
+}
+
+type ZoomRouterConfig struct {
+	Routes []ZoomRoute
+}
+
+type ZoomRouter struct {
+	ZoomRouterConfig
+	// The index of the provider for each zoom level, or -1 where none covers it
+	routes    [pkg.MaxZoom + 1]int
+	providers []layer.Provider
+}
+
+func init() {
+	layer.RegisterProvider(ZoomRouterRegistration{})
+}
+
+type ZoomRouterRegistration struct {
+}
+
+func (s ZoomRouterRegistration) InitializeConfig() any {
+	return ZoomRouterConfig{}
+}
+
+func (s ZoomRouterRegistration) Name() string {
+	return "zoomrouter"
+}
+
+func (s ZoomRouterRegistration) Initialize(cfgAny any, deps layer.ProviderDeps) (layer.Provider, error) {
+	cfg := cfgAny.(ZoomRouterConfig)
+
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf(deps.ErrorMessages.ParamRequired, "provider.zoomrouter.routes")
+	}
+
+	t := &ZoomRouter{ZoomRouterConfig: cfg}
+	for z := range t.routes {
+		t.routes[z] = -1
+	}
+
+	errs := make([]error, 0)
+
+	for i, route := range cfg.Routes {
+		param := "provider.zoomrouter.routes[" + strconv.Itoa(i) + "].zoom"
+
+		if route.Zoom == "" {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.ParamRequired, param))
+			continue
+		}
+
+		zooms, err := pkg.ParseZoomString(route.Zoom)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param, route.Zoom))
+			continue
+		}
+
+		for _, z := range zooms {
+			if other := t.routes[z]; other != -1 {
+				errs = append(errs, fmt.Errorf(deps.ErrorMessages.InvalidParam, param, fmt.Sprintf("%v overlaps routes[%v] at zoom %v", route.Zoom, other, z)))
+				break
+			}
+
+			t.routes[z] = i
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	t.providers = make([]layer.Provider, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		provider, err := layer.ConstructProvider(route.Provider, deps)
+		if err != nil {
+			return nil, err
+		}
+
+		t.providers[i] = provider
+	}
+
+	return t, nil
+}
+
+func (t ZoomRouter) PreAuth(ctx context.Context, providerContext layer.ProviderContext) (layer.ProviderContext, error) {
+	return preAuthRoutes(ctx, t.providers, providerContext)
+}
+
+// Close releases the child providers. ZoomRouter holds them directly rather than through a Layer,
+// so they're unreachable from LayerGroup.Close without this.
+func (t ZoomRouter) Close(ctx context.Context) error {
+	return closeRoutes(ctx, t.providers)
+}
+
+func (t ZoomRouter) GenerateTile(ctx context.Context, providerContext layer.ProviderContext, tileRequest pkg.TileRequest) (*pkg.Image, error) {
+	if tileRequest.Z < 0 || tileRequest.Z > pkg.MaxZoom || t.routes[tileRequest.Z] == -1 {
+		return nil, pkg.TileNotFoundError{Tile: tileRequest}
+	}
+
+	i := t.routes[tileRequest.Z]
+
+	return t.providers[i].GenerateTile(ctx, routeContext(providerContext, i), tileRequest)
+}
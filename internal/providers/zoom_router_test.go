@@ -0,0 +1,131 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/entities/layer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenProvider authenticates with a token that expires, and returns the token it was given when
+// generating as the tile's content
+type tokenProvider struct {
+	token      string
+	expiration time.Time
+	err        error
+}
+
+func (p *tokenProvider) PreAuth(_ context.Context, _ layer.ProviderContext) (layer.ProviderContext, error) {
+	return layer.ProviderContext{AuthToken: p.token, AuthExpiration: p.expiration}, p.err
+}
+
+func (p *tokenProvider) GenerateTile(_ context.Context, providerContext layer.ProviderContext, _ pkg.TileRequest) (*pkg.Image, error) {
+	return &pkg.Image{Content: []byte(providerContext.AuthToken), ContentType: mimePng}, nil
+}
+
+func Test_ZoomRouterValidate(t *testing.T) {
+	deps := layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages}
+	s := map[string]interface{}{"name": "static", "color": "F00"}
+
+	_, err := ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{}, deps)
+	require.Error(t, err)
+
+	_, err = ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{{Provider: s}}}, deps)
+	require.Error(t, err)
+
+	_, err = ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{{Zoom: "a-b", Provider: s}}}, deps)
+	require.Error(t, err)
+
+	_, err = ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{{Zoom: "0-6", Provider: s}, {Zoom: "6-10", Provider: s}}}, deps)
+	require.ErrorContains(t, err, "routes[1].zoom")
+
+	_, err = ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{{Zoom: "0-6", Provider: s}, {Zoom: "7", Provider: map[string]interface{}{"name": "static"}}}}, deps)
+	require.Error(t, err)
+
+	_, err = ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{{Zoom: "0-6", Provider: s}, {Zoom: "10,8", Provider: s}}}, deps)
+	require.NoError(t, err)
+}
+
+func Test_ZoomRouterRoutes(t *testing.T) {
+	global, national, city := &recordingProvider{img: &pkg.Image{Content: []byte("global")}}, &recordingProvider{img: &pkg.Image{Content: []byte("national")}}, &recordingProvider{img: &pkg.Image{Content: []byte("city")}}
+
+	p, err := ZoomRouterRegistration{}.Initialize(ZoomRouterConfig{Routes: []ZoomRoute{
+		{Zoom: "0-6", Provider: map[string]interface{}{"name": "static", "color": "F00"}},
+		{Zoom: "7-12", Provider: map[string]interface{}{"name": "static", "color": "F00"}},
+		{Zoom: "15-21", Provider: map[string]interface{}{"name": "static", "color": "F00"}},
+	}}, layer.ProviderDeps{ClientConfig: testClientConfig, ErrorMessages: testErrMessages})
+	require.NoError(t, err)
+
+	r := p.(*ZoomRouter)
+	r.providers = []layer.Provider{global, national, city}
+
+	for z, expected := range map[int]string{0: "global", 6: "global", 7: "national", 12: "national", 15: "city", 21: "city"} {
+		img, err := r.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: z})
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(img.Content), z)
+	}
+
+	for _, z := range []int{13, 14, 22} {
+		_, err = r.GenerateTile(context.Background(), layer.ProviderContext{}, pkg.TileRequest{LayerName: "l", Z: z})
+
+		var notFound pkg.TileNotFoundError
+		require.ErrorAs(t, err, &notFound, z)
+	}
+}
+
+func Test_ZoomRouterAuth(t *testing.T) {
+	soon, later := time.Now().Add(time.Minute), time.Now().Add(time.Hour)
+	r := &ZoomRouter{providers: []layer.Provider{&tokenProvider{token: "a", expiration: later}, &Static{}, &tokenProvider{token: "b", expiration: soon}}}
+	r.routes[1], r.routes[2], r.routes[3] = 0, 1, 2
+
+	pc, err := r.PreAuth(context.Background(), layer.ProviderContext{})
+	require.NoError(t, err)
+	assert.False(t, pc.AuthBypass)
+	assert.Equal(t, soon, pc.AuthExpiration)
+
+	img, err := r.GenerateTile(context.Background(), pc, pkg.TileRequest{LayerName: "l", Z: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(img.Content))
+
+	img, err = r.GenerateTile(context.Background(), pc, pkg.TileRequest{LayerName: "l", Z: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(img.Content))
+
+	r.providers[2] = &tokenProvider{err: errors.New("denied")}
+	pc, err = r.PreAuth(context.Background(), pc)
+	require.Error(t, err)
+	assert.True(t, pc.AuthExpiration.IsZero())
+
+	r.providers = []layer.Provider{&Static{}, &Static{}}
+	pc, err = r.PreAuth(context.Background(), pc)
+	require.NoError(t, err)
+	assert.True(t, pc.AuthBypass)
+}
+
+func Test_ZoomRouterClose(t *testing.T) {
+	first, second := &closableProvider{}, &closableProvider{}
+	r := &ZoomRouter{providers: []layer.Provider{first, second}}
+
+	require.NoError(t, r.Close(context.Background()))
+	assert.True(t, first.closed)
+	assert.True(t, second.closed)
+}
@@ -47,6 +47,14 @@ func errorVars(cfg *config.ErrorConfig, errorType pkg.TypeOfError) (int, slog.Le
 		level = slog.LevelInfo
 		status = http.StatusInternalServerError
 		imgPath = cfg.Images.Provider
+	case pkg.TypeOfErrorRateLimit:
+		level = slog.LevelInfo
+		status = http.StatusTooManyRequests
+		imgPath = cfg.Images.Provider
+	case pkg.TypeOfErrorUnavailable:
+		level = slog.LevelInfo
+		status = http.StatusServiceUnavailable
+		imgPath = cfg.Images.Provider
 	case pkg.TypeOfErrorBadRequest:
 		level = slog.LevelDebug
 		status = http.StatusBadRequest
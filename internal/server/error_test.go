@@ -44,6 +44,16 @@ func Test_ErrorVals_Execute(t *testing.T) {
 	}
 }
 
+func Test_ErrorVals_RateLimit(t *testing.T) {
+	cfg := config.DefaultConfig()
+
+	status, _, _ := errorVars(&cfg.Error, pkg.RateLimitError{}.Type())
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	status, _, _ = errorVars(&cfg.Error, pkg.RateLimitError{Concurrency: true}.Type())
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
 func Test_WriteErrorMessage_Execute(t *testing.T) {
 	cfg := config.DefaultConfig()
 	ctx := pkg.BackgroundContext()
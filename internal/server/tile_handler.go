@@ -239,6 +239,7 @@ func (h *tileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	entities.writeVary(ctx, w, tileReq)
 	writeTile(ctx, w, req, span, img)
 
 	// This isn't in the else clause because the tile was still generated successfully even though request errored
@@ -312,6 +313,20 @@ func requestETagMatches(ifNoneMatch string, etag string) bool {
 	return false
 }
 
+// writeVary lists the request headers the layer's tiles depend on, such as Accept for a layer
+// choosing its format by it, so caches in front of the server keep those responses apart
+func (h *reloadableEntities) writeVary(ctx context.Context, w http.ResponseWriter, tileReq pkg.TileRequest) {
+	l := h.layerGroup.FindLayer(ctx, tileReq.LayerName)
+
+	if l == nil {
+		return
+	}
+
+	for _, header := range l.Vary() {
+		w.Header().Add("Vary", header)
+	}
+}
+
 func (h *reloadableEntities) writeHeaders(w http.ResponseWriter) {
 	for h, v := range h.config.Server.Headers {
 		w.Header().Add(h, v)
@@ -466,6 +466,52 @@ layers:
 	assert.Empty(t, body2, "304 response must not include a body")
 }
 
+// A layer negotiating its format caches each format separately and tells caches in front of it
+// that the response depends on Accept
+func Test_TileHandler_NegotiatedFormat(t *testing.T) {
+	configRaw := `server:
+  port: 12348
+cache:
+  name: memory
+layers:
+  - id: color
+    provider:
+      name: format
+      format: png
+      negotiate:
+        - jpeg
+      provider:
+        name: static
+        color: "FFFFFF"
+`
+
+	cfg, err := config.LoadConfig(configRaw)
+	require.NoError(t, err)
+	lg, auth, err := configToEntities(cfg)
+	require.NoError(t, err)
+	handler, err := newTileHandler(reloadableEntities{config: &cfg, auth: auth, layerGroup: lg})
+	require.NoError(t, err)
+
+	for _, accept := range []string{"image/jpeg", "", "image/jpeg", ""} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:12348/tiles/color/8/12/32", nil)
+		req.Header.Set("Accept", accept)
+		req = req.WithContext(pkg.NewRequestContext(req))
+		req.SetPathValue("layer", "color")
+		req.SetPathValue("z", "8")
+		req.SetPathValue("x", "12")
+		req.SetPathValue("y", "32")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		resp := w.Result()
+		require.NoError(t, resp.Body.Close())
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+		assert.Equal(t, pkg.Ternary(accept == "", "image/png", "image/jpeg"), resp.Header.Get("Content-Type"), accept)
+	}
+}
+
 func Test_TileHandler_ExecuteErrorText(t *testing.T) {
 	configRaw := `server:
   port: 12346
@@ -0,0 +1,186 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// States of the circuit breaker for a server
+const (
+	CircuitClosed   = "closed"    // Requests go through as normal
+	CircuitOpen     = "open"      // Requests fail fast without calling the server
+	CircuitHalfOpen = "half-open" // A single request is let through to check whether the server has recovered
+)
+
+// CircuitBreaker tracks how often the servers a layer calls are failing and stops calling any that
+// are failing too often. Each server, as identified by its host, is tracked separately so a layer
+// falling back from one server to another isn't cut off from both. A nil CircuitBreaker lets
+// every request through
+type CircuitBreaker struct {
+	cfg config.CircuitBreakerConfig
+	// Counts state changes, may be nil
+	stateCounter metric.Int64Counter
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state       string
+	windowStart time.Time
+	requests    uint
+	failures    uint
+	openUntil   time.Time
+	probing     bool
+}
+
+// NewCircuitBreaker returns a circuit breaker, or nil if the configuration disables it
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig, stateCounter metric.Int64Counter) *CircuitBreaker {
+	if cfg.ErrorRate <= 0 {
+		return nil
+	}
+
+	return &CircuitBreaker{cfg: cfg, stateCounter: stateCounter, circuits: make(map[string]*circuit)}
+}
+
+// Allow checks whether a request to host can be made. If it can then Record must be called with
+// the outcome
+func (b *CircuitBreaker) Allow(ctx context.Context, host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+
+	if c.state == CircuitOpen && !time.Now().Before(c.openUntil) {
+		b.transition(ctx, host, c, CircuitHalfOpen)
+	}
+
+	switch c.state {
+	case CircuitOpen:
+		return CircuitOpenError{Host: host}
+	case CircuitHalfOpen:
+		if c.probing {
+			return CircuitOpenError{Host: host}
+		}
+		c.probing = true
+	}
+
+	return nil
+}
+
+// Record notes the outcome of a request Allow let through
+func (b *CircuitBreaker) Record(ctx context.Context, host string, failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	now := time.Now()
+
+	if c.state == CircuitHalfOpen {
+		c.probing = false
+
+		if failed {
+			c.openUntil = now.Add(time.Duration(b.cfg.Cooldown) * time.Second)
+			b.transition(ctx, host, c, CircuitOpen)
+		} else {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+			b.transition(ctx, host, c, CircuitClosed)
+		}
+
+		return
+	}
+
+	if c.state != CircuitClosed {
+		return
+	}
+
+	if now.Sub(c.windowStart) > time.Duration(b.cfg.Window)*time.Second {
+		c.windowStart, c.requests, c.failures = now, 0, 0
+	}
+
+	c.requests++
+	if failed {
+		c.failures++
+	}
+
+	if c.requests >= b.cfg.MinRequests && float64(c.failures)/float64(c.requests) >= b.cfg.ErrorRate {
+		slog.WarnContext(ctx, fmt.Sprintf("Circuit breaker opening for %v after %v of %v requests failed", host, c.failures, c.requests))
+
+		c.openUntil = now.Add(time.Duration(b.cfg.Cooldown) * time.Second)
+		b.transition(ctx, host, c, CircuitOpen)
+	}
+}
+
+// Release is called instead of Record when a request Allow let through ended without telling us
+// anything about the server, such as the caller giving up on it
+func (b *CircuitBreaker) Release(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.circuit(host).probing = false
+}
+
+// State gives the current state of the circuit for host
+func (b *CircuitBreaker) State(host string) string {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.circuit(host).state
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed, windowStart: time.Now()}
+		b.circuits[host] = c
+	}
+
+	return c
+}
+
+func (b *CircuitBreaker) transition(ctx context.Context, host string, c *circuit, state string) {
+	slog.DebugContext(ctx, fmt.Sprintf("Circuit breaker for %v changing from %v to %v", host, c.state, state))
+
+	c.state = state
+
+	if b.stateCounter != nil {
+		b.stateCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("state", state), attribute.String("server.address", host)))
+	}
+}
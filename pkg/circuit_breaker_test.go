@@ -0,0 +1,93 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CircuitBreakerDisabled(t *testing.T) {
+	breaker := NewCircuitBreaker(config.CircuitBreakerConfig{MinRequests: 1}, nil)
+	assert.Nil(t, breaker)
+
+	for range 10 {
+		require.NoError(t, breaker.Allow(context.Background(), "example.com"))
+		breaker.Record(context.Background(), "example.com", true)
+	}
+
+	assert.Equal(t, CircuitClosed, breaker.State("example.com"))
+}
+
+func Test_CircuitBreakerStates(t *testing.T) {
+	ctx := context.Background()
+	breaker := NewCircuitBreaker(config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: 60, Cooldown: 60}, nil)
+
+	// Below the error rate
+	for _, failed := range []bool{true, false, false, false, true} {
+		require.NoError(t, breaker.Allow(ctx, "example.com"))
+		breaker.Record(ctx, "example.com", failed)
+	}
+	assert.Equal(t, CircuitClosed, breaker.State("example.com"))
+
+	// Now half have failed
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+	breaker.Record(ctx, "example.com", true)
+	assert.Equal(t, CircuitOpen, breaker.State("example.com"))
+	require.ErrorAs(t, breaker.Allow(ctx, "example.com"), new(CircuitOpenError))
+
+	// Once the cooldown is over a single request is let through
+	breaker.circuits["example.com"].openUntil = time.Now()
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+	assert.Equal(t, CircuitHalfOpen, breaker.State("example.com"))
+	require.Error(t, breaker.Allow(ctx, "example.com"))
+
+	// Which failing opens it again
+	breaker.Record(ctx, "example.com", true)
+	assert.Equal(t, CircuitOpen, breaker.State("example.com"))
+
+	// A request that gives up doesn't count either way
+	breaker.circuits["example.com"].openUntil = time.Now()
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+	breaker.Release("example.com")
+	assert.Equal(t, CircuitHalfOpen, breaker.State("example.com"))
+
+	// And succeeding closes it
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+	breaker.Record(ctx, "example.com", false)
+	assert.Equal(t, CircuitClosed, breaker.State("example.com"))
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+}
+
+func Test_CircuitBreakerWindow(t *testing.T) {
+	ctx := context.Background()
+	breaker := NewCircuitBreaker(config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: 60, Cooldown: 60}, nil)
+
+	for range 3 {
+		require.NoError(t, breaker.Allow(ctx, "example.com"))
+		breaker.Record(ctx, "example.com", true)
+	}
+
+	// Failures from before the window don't count
+	breaker.circuits["example.com"].windowStart = time.Now().Add(-time.Hour)
+	require.NoError(t, breaker.Allow(ctx, "example.com"))
+	breaker.Record(ctx, "example.com", true)
+	assert.Equal(t, CircuitClosed, breaker.State("example.com"))
+}
@@ -86,7 +86,35 @@ type ClientConfig struct {
 	Headers             map[string]string // Include these headers in requests. Defaults to none
 	Timeout             uint              // How long (in seconds) a request can be in flight before we cancel it and return an error
 	RewriteContentTypes map[string]string // Replace ContentType's that match the key with the value. This is to handle servers returning a generic content type. Kicks in after the check that ContentType is in `ContentTypes`.
+	Retries             uint              // How many more times to try a request after the first attempt fails. Default: 0
+	RetryBackoff        uint              // How long (in milliseconds) to wait before the first retry. Doubles with each retry, with jitter
+	RetryMaxBackoff     uint              // The longest (in milliseconds) to wait between retries. A Retry-After header asking for longer than this stops retrying
+	RetryStatusCodes    []int             // The status codes from the remote server that are worth trying again
+	CircuitBreaker      CircuitBreakerConfig
+	RateLimit           float64 // The most requests per second a layer can make to remote servers. 0 for no limit
+	RateBurst           uint    // How many requests can be made at once before RateLimit kicks in. Default: 1
+	MaxConcurrency      uint    // The most requests a layer can have in flight to remote servers at once. 0 for no limit
+	LimitWait           uint    // How long (in milliseconds) a request waits for RateLimit or MaxConcurrency to allow it before failing
+	Limiter             string  // Layers with the same Limiter share one set of limits, such as layers calling the same server
+	Proxy               string  // The URL of a proxy to send requests through. Defaults to the HTTP_PROXY and HTTPS_PROXY environment variables
+	NoProxy             string  // Comma separated hosts to not send through Proxy. Only applies when Proxy is set, otherwise the NO_PROXY environment variable is used
+	TLSCert             string  // File containing a PEM encoded client certificate to present to servers. Requires TLSKey
+	TLSKey              string  // File containing the PEM encoded private key of TLSCert
+	TLSCA               string  // File containing PEM encoded certificate authorities to trust in addition to the system's
+	InsecureSkipVerify  bool    // If true, don't verify the certificates of servers. Only for testing
+	MaxIdleConns        int     // The most idle connections to keep open across all servers. 0 for no limit
+	MaxIdleConnsPerHost int     // The most idle connections to keep open to each server
+	MaxConnsPerHost     int     // The most connections to open to each server. 0 for no limit
+	IdleConnTimeout     uint    // How long (in seconds) to keep an idle connection open. 0 to keep them open indefinitely
+	DisableHTTP2        bool    // If true, only use HTTP/1.1
+}
 
+// Stops calling a server that's mostly failing so requests fail fast instead of waiting on it
+type CircuitBreakerConfig struct {
+	ErrorRate   float64 // The fraction (0-1) of requests to a server that have to fail for the circuit breaker to open. 0 disables the circuit breaker
+	MinRequests uint    // How many requests to a server have to be made within Window before the error rate is considered
+	Window      uint    // How long (in seconds) requests are counted for
+	Cooldown    uint    // How long (in seconds) requests fail fast once the circuit breaker opens before another request is let through to check on the server
 }
 
 type TelemetryConfig struct {
@@ -120,6 +148,80 @@ func (c *ClientConfig) MergeDefaultsFrom(o ClientConfig) {
 	if len(c.RewriteContentTypes) == 0 {
 		c.RewriteContentTypes = o.RewriteContentTypes
 	}
+	if c.Retries == 0 {
+		c.Retries = o.Retries
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = o.RetryBackoff
+	}
+	if c.RetryMaxBackoff == 0 {
+		c.RetryMaxBackoff = o.RetryMaxBackoff
+	}
+	if len(c.RetryStatusCodes) == 0 {
+		c.RetryStatusCodes = o.RetryStatusCodes
+	}
+	if c.CircuitBreaker.ErrorRate == 0 {
+		c.CircuitBreaker.ErrorRate = o.CircuitBreaker.ErrorRate
+	}
+	if c.CircuitBreaker.MinRequests == 0 {
+		c.CircuitBreaker.MinRequests = o.CircuitBreaker.MinRequests
+	}
+	if c.CircuitBreaker.Window == 0 {
+		c.CircuitBreaker.Window = o.CircuitBreaker.Window
+	}
+	if c.CircuitBreaker.Cooldown == 0 {
+		c.CircuitBreaker.Cooldown = o.CircuitBreaker.Cooldown
+	}
+	if c.RateLimit == 0 {
+		c.RateLimit = o.RateLimit
+	}
+	if c.RateBurst == 0 {
+		c.RateBurst = o.RateBurst
+	}
+	if c.MaxConcurrency == 0 {
+		c.MaxConcurrency = o.MaxConcurrency
+	}
+	if c.LimitWait == 0 {
+		c.LimitWait = o.LimitWait
+	}
+	if c.Limiter == "" {
+		c.Limiter = o.Limiter
+	}
+	if c.Proxy == "" {
+		c.Proxy = o.Proxy
+	}
+	if c.NoProxy == "" {
+		c.NoProxy = o.NoProxy
+	}
+	// The key is only inherited along with the certificate, so a layer setting its own certificate
+	// can't end up paired with the default's key
+	if c.TLSCert == "" && c.TLSKey == "" {
+		c.TLSCert = o.TLSCert
+		c.TLSKey = o.TLSKey
+	}
+	if c.TLSCA == "" {
+		c.TLSCA = o.TLSCA
+	}
+	// Unlike UnknownLength these are inherited, so a layer can't turn them back off when they're
+	// on by default. They're meant to be set everywhere or nowhere
+	if !c.InsecureSkipVerify {
+		c.InsecureSkipVerify = o.InsecureSkipVerify
+	}
+	if !c.DisableHTTP2 {
+		c.DisableHTTP2 = o.DisableHTTP2
+	}
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = o.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost == 0 {
+		c.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = o.IdleConnTimeout
+	}
 }
 
 // Modes for error reporting
@@ -147,6 +249,7 @@ type ErrorMessages struct {
 	ScriptError             string
 	Timeout                 string
 	ParamRegex              string
+	RateLimited             string
 }
 
 // Default embedded image keys, mirrored as literals from internal/images.GetStaticImage since
@@ -311,6 +414,33 @@ func DefaultConfig() Config {
 			Headers:             map[string]string{},
 			Timeout:             10,
 			RewriteContentTypes: map[string]string{"application/octet-stream": ""},
+			Retries:             0,
+			RetryBackoff:        100,
+			RetryMaxBackoff:     2000,
+			RetryStatusCodes:    []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+			CircuitBreaker: CircuitBreakerConfig{
+				ErrorRate:   0,
+				MinRequests: 20,
+				Window:      60,
+				Cooldown:    30,
+			},
+			RateLimit:      0,
+			RateBurst:      1,
+			MaxConcurrency: 0,
+			LimitWait:      5000,
+			Limiter:        "",
+			// Matching http.DefaultTransport
+			Proxy:               "",
+			NoProxy:             "",
+			TLSCert:             "",
+			TLSKey:              "",
+			TLSCA:               "",
+			InsecureSkipVerify:  false,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 2,
+			MaxConnsPerHost:     0,
+			IdleConnTimeout:     90,
+			DisableHTTP2:        false,
 		},
 		Logging: LogConfig{
 			Main: MainConfig{
@@ -343,6 +473,7 @@ func DefaultConfig() Config {
 				Timeout:                 "Timeout error",
 				ParamRequired:           "Parameter %v is required",
 				ParamRegex:              "Invalid value supplied for parameter %v: %v. Value must conform to regex: %v ",
+				RateLimited:             "Too many requests, try again later",
 			},
 			Images: ErrorImages{
 				OutOfBounds:    defaultImageTransparent,
@@ -244,6 +244,9 @@ func TestMergeDefaultsFrom(t *testing.T) {
 	assert.Equal(t, c1.Timeout, c2.Timeout)
 	assert.Equal(t, c1.UnknownLength, c2.UnknownLength)
 	assert.Equal(t, c1.UserAgent, c2.UserAgent)
+	assert.Equal(t, c1.MaxIdleConns, c2.MaxIdleConns)
+	assert.Equal(t, c1.MaxIdleConnsPerHost, c2.MaxIdleConnsPerHost)
+	assert.Equal(t, c1.IdleConnTimeout, c2.IdleConnTimeout)
 
 	var c3 ClientConfig
 	c3.Headers = map[string]string{"test": "test"}
@@ -281,6 +284,23 @@ func TestMergeDefaultsFrom_UnknownLength(t *testing.T) {
 	assert.Equal(t, uint(5), explicitFalse.Timeout)
 }
 
+func TestMergeDefaultsFrom_Transport(t *testing.T) {
+	defaults := ClientConfig{Proxy: "http://proxy:3128", NoProxy: "internal", TLSCert: "global.crt", TLSKey: "global.key", TLSCA: "ca.pem", MaxIdleConnsPerHost: 2}
+
+	var unset ClientConfig
+	unset.MergeDefaultsFrom(defaults)
+	assert.Equal(t, defaults, unset)
+
+	// The certificate and key are only inherited as a pair
+	own := ClientConfig{Proxy: "http://other:3128", TLSCert: "layer.crt", MaxIdleConnsPerHost: 10}
+	own.MergeDefaultsFrom(defaults)
+	assert.Equal(t, "http://other:3128", own.Proxy)
+	assert.Equal(t, "layer.crt", own.TLSCert)
+	assert.Empty(t, own.TLSKey)
+	assert.Equal(t, "ca.pem", own.TLSCA)
+	assert.Equal(t, 10, own.MaxIdleConnsPerHost)
+}
+
 func Test_ShutdownTimeoutDerivesFromItsPhases(t *testing.T) {
 	c := DefaultConfig()
 	c.Server.Timeout = 45
@@ -197,6 +197,14 @@ type Layer struct {
 	tileAuthCounter    metric.Int64Counter
 	tileErrorCounter   metric.Int64Counter
 	tileSuccessCounter metric.Int64Counter
+	// Requests that missed the cache but shared another request's in-flight render
+	tileCoalescedCounter metric.Int64Counter
+	// Stops calling servers this layer relies on while they're failing. nil if disabled
+	circuitBreaker *pkg.CircuitBreaker
+	// Caps how quickly and how many requests at once go to the provider. nil if there are no limits
+	limiter *pkg.Limiter
+	// What the provider's output depends on besides the tile. nil if it only depends on the tile
+	variants *cacheVariants
 }
 
 func ConstructLayer(rawConfig config.LayerConfig, defaultClientConfig config.ClientConfig, errorMessages config.ErrorMessages, layerGroup *LayerGroup, secreter secret.Secreter, datastores *datastore.DatastoreRegistry) (*Layer, error) {
@@ -208,6 +216,11 @@ func ConstructLayer(rawConfig config.LayerConfig, defaultClientConfig config.Cli
 
 	}
 
+	// Built now so a bad proxy or certificate is reported at startup rather than on the first request
+	if _, err = pkg.ClientTransport(*rawConfig.Client); err != nil {
+		return nil, fmt.Errorf("layer %v: %w", rawConfig.ID, err)
+	}
+
 	rawConfig.Provider = pkg.ReplaceEnv(rawConfig.Provider)
 	if secreter != nil {
 		rawConfig.Provider, err = pkg.ReplaceConfigValues(rawConfig.Provider, "secret", secreter.Lookup)
@@ -216,11 +229,14 @@ func ConstructLayer(rawConfig config.LayerConfig, defaultClientConfig config.Cli
 		}
 	}
 
+	variants := &cacheVariants{}
+
 	provider, err := ConstructProvider(rawConfig.Provider, ProviderDeps{
 		ClientConfig:  *rawConfig.Client,
 		ErrorMessages: errorMessages,
 		LayerGroup:    layerGroup,
 		Datastores:    datastores,
+		variants:      variants,
 	})
 
 	if err != nil {
@@ -254,8 +270,17 @@ func ConstructLayer(rawConfig config.LayerConfig, defaultClientConfig config.Cli
 	tileAuthCounter, err2 := meter.Int64Counter("tilegroxy.tiles.layer."+sanitizedID+".auth", metric.WithDescription("Number of outgoing authentication checks for "+rawConfig.ID))
 	tileErrorCounter, err3 := meter.Int64Counter("tilegroxy.tiles.layer."+sanitizedID+".error", metric.WithDescription("Number of tile requests that error during generation for "+rawConfig.ID))
 	tileSuccessCounter, err4 := meter.Int64Counter("tilegroxy.tiles.layer."+sanitizedID+".success", metric.WithDescription("Number of tile requests that result in a tile for "+rawConfig.ID))
+	tileCoalescedCounter, err5 := meter.Int64Counter("tilegroxy.tiles.layer."+sanitizedID+".coalesced", metric.WithDescription("Number of cache misses that shared an in-flight render instead of calling the provider for "+rawConfig.ID))
+	breakerCounter, err6 := meter.Int64Counter("tilegroxy.tiles.layer."+sanitizedID+".breaker", metric.WithDescription("Number of times a circuit breaker changed state for "+rawConfig.ID))
+
+	circuitBreaker := pkg.NewCircuitBreaker(rawConfig.Client.CircuitBreaker, breakerCounter)
+
+	limiter, err := layerGroup.layerLimiter(rawConfig.ID, *rawConfig.Client)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Layer{rawConfig.ID, segments, validator, rawConfig, provider, nil, errorMessages, ProviderContext{}, sync.Mutex{}, tileAllCounter, tileAuthCounter, tileErrorCounter, tileSuccessCounter}, errors.Join(err1, err2, err3, err4)
+	return &Layer{rawConfig.ID, segments, validator, rawConfig, provider, nil, errorMessages, ProviderContext{}, sync.Mutex{}, tileAllCounter, tileAuthCounter, tileErrorCounter, tileSuccessCounter, tileCoalescedCounter, circuitBreaker, limiter, variants}, errors.Join(err1, err2, err3, err4, err5, err6)
 }
 
 // getProviderContext returns a snapshot of the current provider context, re-authenticating
@@ -285,6 +310,22 @@ func (l *Layer) forceReauth(ctx context.Context) (ProviderContext, error) {
 	return l.getProviderContext(ctx)
 }
 
+// cacheRequest gives the tile request to cache and coalesce a tile under. When the provider varies
+// by request the variant is set, so each one is kept apart
+func (l *Layer) cacheRequest(ctx context.Context, tileRequest pkg.TileRequest) pkg.TileRequest {
+	tileRequest.Variant = l.variants.variant(ctx)
+	return tileRequest
+}
+
+// Vary gives the request headers the layer's tiles depend on, to send back in the Vary header
+func (l *Layer) Vary() []string {
+	if l.variants == nil {
+		return nil
+	}
+
+	return l.variants.headers
+}
+
 func (l *Layer) MatchesName(ctx context.Context, layerName string) bool {
 
 	if doesMatch, matches := match(l.Pattern, layerName); doesMatch {
@@ -306,6 +347,15 @@ func (l *Layer) RenderTileNoCache(ctx context.Context, tileRequest pkg.TileReque
 
 	l.tileAllCounter.Add(ctx, 1)
 
+	// Always set, even when disabled, so a layer reached through a ref doesn't use the breaker of
+	// the layer referencing it
+	ctx = pkg.WithCircuitBreaker(ctx, l.circuitBreaker)
+
+	// Limits the requests the provider makes rather than the provider call itself. A provider that
+	// renders other tiles of the same layer, such as pyramid, would otherwise hold a place while
+	// waiting on children that need one too
+	ctx = pkg.WithLimiter(ctx, l.limiter)
+
 	providerContext, err := l.getProviderContext(ctx)
 
 	if err != nil {
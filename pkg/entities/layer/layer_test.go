@@ -15,10 +15,14 @@
 package layer
 
 import (
+	"context"
 	"testing"
 
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 func Test_ParsePattern(t *testing.T) {
@@ -190,3 +194,71 @@ func Test_ValidateMatches(t *testing.T) {
 	require.NoError(t, err)
 	assert.False(t, validateParamMatches(matches, regex))
 }
+
+// breakerProvider remembers the circuit breaker and limiter it was called with
+type breakerProvider struct {
+	breaker *pkg.CircuitBreaker
+	limiter *pkg.Limiter
+}
+
+func (p *breakerProvider) PreAuth(_ context.Context, _ ProviderContext) (ProviderContext, error) {
+	return ProviderContext{AuthBypass: true}, nil
+}
+
+func (p *breakerProvider) GenerateTile(ctx context.Context, _ ProviderContext, _ pkg.TileRequest) (*pkg.Image, error) {
+	p.breaker, _ = pkg.CircuitBreakerFromContext(ctx)
+	p.limiter, _ = pkg.LimiterFromContext(ctx)
+	return &pkg.Image{}, nil
+}
+
+func Test_Layer_RenderTileNoCache_SetsCircuitBreaker(t *testing.T) {
+	provider := &breakerProvider{}
+	l := &Layer{ID: "test", Provider: provider}
+	l.tileAllCounter = noop.Int64Counter{}
+	l.tileAuthCounter = noop.Int64Counter{}
+	l.tileErrorCounter = noop.Int64Counter{}
+	l.tileSuccessCounter = noop.Int64Counter{}
+	l.circuitBreaker = pkg.NewCircuitBreaker(config.CircuitBreakerConfig{ErrorRate: 0.5}, nil)
+
+	_, err := l.RenderTileNoCache(context.Background(), pkg.TileRequest{LayerName: "test"})
+	require.NoError(t, err)
+	assert.Same(t, l.circuitBreaker, provider.breaker)
+
+	// A layer without one replaces the one of any layer it's called through
+	outer := provider.breaker
+	l.circuitBreaker = nil
+
+	_, err = l.RenderTileNoCache(pkg.WithCircuitBreaker(context.Background(), outer), pkg.TileRequest{LayerName: "test"})
+	require.NoError(t, err)
+	assert.Nil(t, provider.breaker)
+}
+
+func Test_Layer_RenderTileNoCache_SetsLimiter(t *testing.T) {
+	provider := &breakerProvider{}
+	l := &Layer{ID: "test", Provider: provider}
+	l.tileAllCounter = noop.Int64Counter{}
+	l.tileAuthCounter = noop.Int64Counter{}
+	l.tileErrorCounter = noop.Int64Counter{}
+	l.tileSuccessCounter = noop.Int64Counter{}
+	l.limiter = pkg.NewLimiter("test", config.ClientConfig{MaxConcurrency: 1, LimitWait: 10})
+
+	_, err := l.RenderTileNoCache(context.Background(), pkg.TileRequest{LayerName: "test"})
+	require.NoError(t, err)
+	assert.Same(t, l.limiter, provider.limiter)
+
+	// The provider call itself isn't limited, only the requests it makes
+	release, err := l.limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	_, err = l.RenderTileNoCache(context.Background(), pkg.TileRequest{LayerName: "test"})
+	require.NoError(t, err)
+
+	// A layer without one replaces the one of any layer it's called through
+	outer := provider.limiter
+	l.limiter = nil
+
+	_, err = l.RenderTileNoCache(pkg.WithLimiter(context.Background(), outer), pkg.TileRequest{LayerName: "test"})
+	require.NoError(t, err)
+	assert.Nil(t, provider.limiter)
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"log/slog"
 	"slices"
+	"strconv"
 
 	"github.com/Michad/tilegroxy/pkg"
 	"github.com/Michad/tilegroxy/pkg/config"
@@ -30,6 +31,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // Bounds the background writeCache goroutines. A slow cache backend plus sustained misses would
@@ -42,6 +44,40 @@ type LayerGroup struct {
 	cacheHitCounter   metric.Int64Counter
 	cacheMissCounter  metric.Int64Counter
 	cacheWriteLimiter chan struct{}
+	// Collapses concurrent cache misses for the same tile into a single provider call
+	renderFlight singleflight.Group
+	// Limiters shared by every layer naming them, keyed by name. Only written while constructing
+	// the layers, so needs no lock
+	limiters map[string]sharedLimiter
+}
+
+type sharedLimiter struct {
+	limiter *pkg.Limiter
+	client  config.ClientConfig
+}
+
+// layerLimiter gives the limiter for a layer with the given client configuration. Layers naming the
+// same limiter get the same one, so they have to agree on its limits
+func (lg *LayerGroup) layerLimiter(layerID string, client config.ClientConfig) (*pkg.Limiter, error) {
+	if client.Limiter == "" || lg == nil {
+		return pkg.NewLimiter(layerID, client), nil
+	}
+
+	if lg.limiters == nil {
+		lg.limiters = make(map[string]sharedLimiter)
+	}
+
+	existing, ok := lg.limiters[client.Limiter]
+	if !ok {
+		existing = sharedLimiter{pkg.NewLimiter(client.Limiter, client), client}
+		lg.limiters[client.Limiter] = existing
+	}
+
+	if existing.client.RateLimit != client.RateLimit || existing.client.RateBurst != client.RateBurst || existing.client.MaxConcurrency != client.MaxConcurrency || existing.client.LimitWait != client.LimitWait {
+		return nil, fmt.Errorf("layers sharing limiter %v must have the same ratelimit, rateburst, maxconcurrency and limitwait", client.Limiter)
+	}
+
+	return existing.limiter, nil
 }
 
 func ConstructLayerGroup(cfg config.Config, cache cache.Cache, secreter secret.Secreter, datastores *datastore.DatastoreRegistry) (*LayerGroup, error) {
@@ -230,7 +266,9 @@ func (lg *LayerGroup) RenderTile(ctx context.Context, tileRequest pkg.TileReques
 		return nil, err
 	}
 
-	img, err = l.Cache.Lookup(ctx, tileRequest)
+	cacheRequest := l.cacheRequest(ctx, tileRequest)
+
+	img, err = l.Cache.Lookup(ctx, cacheRequest)
 
 	if img != nil {
 		slog.DebugContext(ctx, "Cache hit")
@@ -244,6 +282,82 @@ func (lg *LayerGroup) RenderTile(ctx context.Context, tileRequest pkg.TileReques
 		slog.WarnContext(ctx, fmt.Sprintf("Cache read error %v\n", err))
 	}
 
+	return lg.renderTileCoalesced(ctx, l, tileRequest, cacheRequest)
+}
+
+// renderTileCoalesced renders a tile that missed the cache, sharing a single provider call (and
+// the cache write that follows it) between every request for the same tile that arrives while the
+// render is in flight. The render runs detached from the caller's cancellation so one client
+// disconnecting doesn't fail the tile for everyone else waiting on it; each waiter still gives up
+// on its own context. Requests are only shared when they have the same cacheRequest, so requests
+// the provider would give different tiles don't get each other's
+func (lg *LayerGroup) renderTileCoalesced(ctx context.Context, l *Layer, tileRequest pkg.TileRequest, cacheRequest pkg.TileRequest) (*pkg.Image, error) {
+	leader := false
+
+	// The ref depth is part of the key since a pattern layer can ref itself at runtime. Sharing a
+	// key across depths would have the nested render wait on its own flight rather than tripping
+	// the depth limit
+	depth := 0
+	if ctxDepth, ok := pkg.RefDepthFromContext(ctx); ok && ctxDepth != nil {
+		depth = *ctxDepth
+	}
+	key := strconv.Itoa(depth) + "/" + l.ID + "/" + cacheRequest.String()
+
+	resultChan := lg.renderFlight.DoChan(key, func() (any, error) {
+		leader = true
+
+		renderCtx, cancel := detachContext(ctx)
+		defer cancel()
+
+		return lg.renderAndSave(renderCtx, l, tileRequest, cacheRequest)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-resultChan:
+		if !leader {
+			slog.DebugContext(ctx, "Shared in-flight render")
+			l.tileCoalescedCounter.Add(ctx, 1)
+		}
+
+		if res.Err != nil {
+			// The caller that started the render sees the panic just as it would without coalescing
+			// so anything recovering further up the stack (such as seeding) still notices it
+			var panicErr renderPanicError
+			if leader && errors.As(res.Err, &panicErr) {
+				panic(panicErr.value)
+			}
+
+			return nil, res.Err
+		}
+
+		return res.Val.(*pkg.Image), nil
+	}
+}
+
+// detachContext makes a context that keeps the values (and span) of ctx and its deadline, if
+// any, but isn't cancelled along with it
+func detachContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	newCtx := context.WithoutCancel(ctx)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(newCtx, deadline)
+	}
+
+	return newCtx, func() {}
+}
+
+func (lg *LayerGroup) renderAndSave(ctx context.Context, l *Layer, tileRequest pkg.TileRequest, cacheRequest pkg.TileRequest) (img *pkg.Image, err error) { //nolint:nonamedreturns // needed to surface a recovered panic
+	// singleflight re-panics on a goroutine nobody can recover from, so a panicking provider would
+	// take down the process instead of just failing the request as it would without coalescing
+	defer func() {
+		if r := recover(); r != nil {
+			img = nil
+			err = renderPanicError{value: r}
+		}
+	}()
+
 	img, err = lg.RenderTileNoCache(ctx, tileRequest)
 
 	if err != nil {
@@ -255,20 +369,53 @@ func (lg *LayerGroup) RenderTile(ctx context.Context, tileRequest pkg.TileReques
 	}
 
 	if !img.ForceSkipCache {
-		select {
-		case lg.cacheWriteLimiter <- struct{}{}:
-			go func() {
-				defer func() { <-lg.cacheWriteLimiter }()
-				writeCache(ctx, l.Cache, tileRequest, img)
-			}()
-		default:
-			slog.WarnContext(ctx, "Skipping cache write: too many cache writes already in flight")
-		}
+		lg.scheduleCacheWrite(ctx, l, cacheRequest, img)
 	}
 
 	return img, nil
 }
 
+// SaveTile writes a tile to the cache of the layer it belongs to without rendering it. This is for
+// providers that produce more tiles than the one requested, such as the rest of a metatile, so the
+// later requests for those tiles are cache hits. Like the write following a cache miss it happens
+// in the background and is skipped for layers that skip the cache, images with ForceSkipCache set,
+// or when too many writes are already in flight
+func (lg *LayerGroup) SaveTile(ctx context.Context, tileRequest pkg.TileRequest, img *pkg.Image) {
+	if img == nil || img.ForceSkipCache {
+		return
+	}
+
+	l := lg.FindLayer(ctx, tileRequest.LayerName)
+
+	if l == nil || l.Config.SkipCache || l.Cache == nil {
+		return
+	}
+
+	lg.scheduleCacheWrite(ctx, l, l.cacheRequest(ctx, tileRequest), img)
+}
+
+func (lg *LayerGroup) scheduleCacheWrite(ctx context.Context, l *Layer, tileRequest pkg.TileRequest, img *pkg.Image) {
+	select {
+	case lg.cacheWriteLimiter <- struct{}{}:
+		go func() {
+			defer func() { <-lg.cacheWriteLimiter }()
+			writeCache(ctx, l.Cache, tileRequest, img)
+		}()
+	default:
+		slog.WarnContext(ctx, "Skipping cache write: too many cache writes already in flight")
+	}
+}
+
+// renderPanicError carries a panic out of a coalesced render. Requests that joined the render get
+// it as an error while the one that started it re-panics with the original value
+type renderPanicError struct {
+	value any
+}
+
+func (e renderPanicError) Error() string {
+	return fmt.Sprintf("unexpected panic rendering tile: %v", e.value)
+}
+
 // errNilImage is returned when a provider reports success but hands back no image. composite_mvt
 // and blend already defend against nested providers doing this, so it's reachable in practice.
 var errNilImage = errors.New("provider returned no image and no error")
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/Michad/tilegroxy/pkg"
+	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/metric/noop"
 )
@@ -172,3 +173,34 @@ func Test_WriteCache_RecoversFromPanic(t *testing.T) {
 		writeCache(context.Background(), panicOnSaveCache{}, pkg.TileRequest{LayerName: "test", Z: 1, X: 0, Y: 0}, &pkg.Image{Content: []byte("x")})
 	})
 }
+
+// SaveTile is how providers cache tiles they rendered beyond the one requested, so it has to honor
+// the same opt-outs as the write after a normal cache miss
+func Test_LayerGroup_SaveTile_RespectsSkips(t *testing.T) {
+	c := &alwaysMissCache{}
+
+	makeLayer := func(id string, skipCache bool) *Layer {
+		return &Layer{
+			ID:      id,
+			Pattern: []layerSegment{{value: id, placeholder: false}},
+			Config:  config.LayerConfig{ID: id, SkipCache: skipCache},
+			Cache:   c,
+		}
+	}
+
+	lg := &LayerGroup{
+		layers:            []*Layer{makeLayer("cached", false), makeLayer("skipped", true)},
+		DefaultCache:      c,
+		cacheWriteLimiter: make(chan struct{}, maxConcurrentCacheWrites),
+	}
+
+	ctx := context.Background()
+	lg.SaveTile(ctx, pkg.TileRequest{LayerName: "cached", Z: 1, X: 0, Y: 0}, &pkg.Image{Content: []byte("tile")})
+	lg.SaveTile(ctx, pkg.TileRequest{LayerName: "cached", Z: 1, X: 1, Y: 0}, &pkg.Image{Content: []byte("tile"), ForceSkipCache: true})
+	lg.SaveTile(ctx, pkg.TileRequest{LayerName: "skipped", Z: 1, X: 0, Y: 0}, &pkg.Image{Content: []byte("tile")})
+	lg.SaveTile(ctx, pkg.TileRequest{LayerName: "missing", Z: 1, X: 0, Y: 0}, &pkg.Image{Content: []byte("tile")})
+
+	require.Eventually(t, func() bool { return c.saveCalls.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), c.saveCalls.Load())
+}
@@ -0,0 +1,287 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// gatedProvider blocks every GenerateTile call until release is closed, so concurrent requests
+// are guaranteed to overlap
+type gatedProvider struct {
+	generateCalls atomic.Int32
+	started       chan struct{}
+	release       chan struct{}
+	err           error
+	panicValue    any
+}
+
+func (p *gatedProvider) PreAuth(_ context.Context, providerContext ProviderContext) (ProviderContext, error) {
+	providerContext.AuthBypass = true
+	return providerContext, nil
+}
+
+func (p *gatedProvider) GenerateTile(ctx context.Context, _ ProviderContext, _ pkg.TileRequest) (*pkg.Image, error) {
+	if p.generateCalls.Add(1) == 1 {
+		close(p.started)
+	}
+	<-p.release
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if p.panicValue != nil {
+		panic(p.panicValue)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &pkg.Image{Content: []byte("tile")}, nil
+}
+
+type countingCounter struct {
+	noop.Int64Counter
+	count atomic.Int64
+}
+
+func (c *countingCounter) Add(_ context.Context, incr int64, _ ...metric.AddOption) {
+	c.count.Add(incr)
+}
+
+func makeCoalesceLayerGroup(provider Provider, coalesced metric.Int64Counter) *LayerGroup {
+	c := &alwaysMissCache{}
+
+	l := &Layer{
+		ID:       "test",
+		Pattern:  []layerSegment{{value: "test", placeholder: false}},
+		Provider: provider,
+		Cache:    c,
+	}
+	l.tileAllCounter = noop.Int64Counter{}
+	l.tileAuthCounter = noop.Int64Counter{}
+	l.tileErrorCounter = noop.Int64Counter{}
+	l.tileSuccessCounter = noop.Int64Counter{}
+	l.tileCoalescedCounter = coalesced
+
+	return &LayerGroup{
+		layers:            []*Layer{l},
+		DefaultCache:      c,
+		cacheHitCounter:   noop.Int64Counter{},
+		cacheMissCounter:  noop.Int64Counter{},
+		cacheWriteLimiter: make(chan struct{}, maxConcurrentCacheWrites),
+	}
+}
+
+// renderConcurrently fires n RenderTile calls for the same tile, holding the provider until every
+// call has had a chance to join the in-flight render
+func renderConcurrently(lg *LayerGroup, provider *gatedProvider, ctxs []context.Context) ([]*pkg.Image, []error) {
+	imgs := make([]*pkg.Image, len(ctxs))
+	errs := make([]error, len(ctxs))
+
+	var wg sync.WaitGroup
+	wg.Add(len(ctxs))
+	for i, ctx := range ctxs {
+		go func() {
+			defer wg.Done()
+			imgs[i], errs[i] = lg.RenderTile(ctx, pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1})
+		}()
+	}
+
+	<-provider.started
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+
+	return imgs, errs
+}
+
+func Test_LayerGroup_RenderTile_CoalescesConcurrentMisses(t *testing.T) {
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{})}
+	coalesced := &countingCounter{}
+	lg := makeCoalesceLayerGroup(provider, coalesced)
+
+	const n = 20
+	ctxs := make([]context.Context, n)
+	for i := range ctxs {
+		ctxs[i] = pkg.BackgroundContext()
+	}
+
+	imgs, errs := renderConcurrently(lg, provider, ctxs)
+
+	for i := range n {
+		require.NoError(t, errs[i])
+		require.Same(t, imgs[0], imgs[i])
+	}
+	require.Equal(t, int32(1), provider.generateCalls.Load())
+	require.Equal(t, int64(n-1), coalesced.count.Load())
+}
+
+func Test_LayerGroup_RenderTile_CoalescedErrorIsShared(t *testing.T) {
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{}), err: errors.New("upstream down")}
+	lg := makeCoalesceLayerGroup(provider, &countingCounter{})
+
+	ctxs := []context.Context{pkg.BackgroundContext(), pkg.BackgroundContext(), pkg.BackgroundContext()}
+	_, errs := renderConcurrently(lg, provider, ctxs)
+
+	for _, err := range errs {
+		require.EqualError(t, err, "upstream down")
+	}
+	require.Equal(t, int32(1), provider.generateCalls.Load())
+}
+
+// The request that kicks off the render is as likely as any other to be the one whose client goes
+// away, so cancelling it mustn't fail the tile for the requests sharing its render
+func Test_LayerGroup_RenderTile_CancelledWaiterDoesNotCancelSharedRender(t *testing.T) {
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{})}
+	lg := makeCoalesceLayerGroup(provider, &countingCounter{})
+
+	leaderCtx, cancel := context.WithCancel(pkg.BackgroundContext())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := lg.RenderTile(leaderCtx, pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1})
+		leaderDone <- err
+	}()
+	<-provider.started
+
+	waiterDone := make(chan error, 1)
+	var waiterImg *pkg.Image
+	go func() {
+		var err error
+		waiterImg, err = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1})
+		waiterDone <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-leaderDone, context.Canceled)
+
+	close(provider.release)
+	require.NoError(t, <-waiterDone)
+	require.NotNil(t, waiterImg)
+	require.Equal(t, int32(1), provider.generateCalls.Load())
+}
+
+// singleflight re-panics on a goroutine nothing can recover, so a provider panic has to be caught
+// before it gets there and handed back to the caller that started the render
+func Test_LayerGroup_RenderTile_CoalescedPanicReachesCaller(t *testing.T) {
+	lg := makeCoalesceLayerGroup(panicProvider{}, &countingCounter{})
+
+	require.PanicsWithValue(t, "simulated provider panic", func() {
+		_, _ = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1})
+	})
+}
+
+func Test_LayerGroup_RenderTile_CoalescedPanicIsErrorForWaiters(t *testing.T) {
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{}), panicValue: "simulated provider panic"}
+	lg := makeCoalesceLayerGroup(provider, &countingCounter{})
+
+	var panics atomic.Int32
+	errs := make([]error, 3)
+
+	var wg sync.WaitGroup
+	wg.Add(len(errs))
+	for i := range errs {
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					panics.Add(1)
+				}
+			}()
+			_, errs[i] = lg.RenderTile(pkg.BackgroundContext(), pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1})
+		}()
+	}
+
+	<-provider.started
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), provider.generateCalls.Load())
+	require.Equal(t, int32(1), panics.Load())
+
+	errCount := 0
+	for _, err := range errs {
+		if err != nil {
+			require.ErrorContains(t, err, "simulated provider panic")
+			errCount++
+		}
+	}
+	require.Equal(t, len(errs)-1, errCount)
+}
+
+type panicProvider struct{}
+
+func (panicProvider) PreAuth(_ context.Context, providerContext ProviderContext) (ProviderContext, error) {
+	providerContext.AuthBypass = true
+	return providerContext, nil
+}
+
+func (panicProvider) GenerateTile(_ context.Context, _ ProviderContext, _ pkg.TileRequest) (*pkg.Image, error) {
+	panic("simulated provider panic")
+}
+
+type variantKey struct{}
+
+// Requests a provider gives different tiles for have to be rendered and cached separately even
+// when they're for the same tile at the same time
+func Test_LayerGroup_RenderTile_VariantsArentShared(t *testing.T) {
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{})}
+	coalesced := &countingCounter{}
+	lg := makeCoalesceLayerGroup(provider, coalesced)
+
+	l := lg.layers[0]
+	l.variants = &cacheVariants{}
+	ProviderDeps{variants: l.variants}.VaryCache(func(ctx context.Context) string {
+		v, _ := ctx.Value(variantKey{}).(string)
+		return v
+	}, "X-Variant")
+
+	ctxs := make([]context.Context, 4)
+	for i := range ctxs {
+		ctxs[i] = context.WithValue(pkg.BackgroundContext(), variantKey{}, []string{"a", "b"}[i%2])
+	}
+
+	imgs, errs := renderConcurrently(lg, provider, ctxs)
+
+	for i := range ctxs {
+		require.NoError(t, errs[i])
+		require.NotNil(t, imgs[i])
+	}
+	require.Equal(t, int32(2), provider.generateCalls.Load())
+	require.Equal(t, int64(2), coalesced.count.Load())
+	require.Equal(t, []string{"X-Variant"}, l.Vary())
+
+	tile := pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1}
+	require.Equal(t, pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1, Variant: "a"}, l.cacheRequest(ctxs[0], tile))
+	require.Equal(t, pkg.TileRequest{LayerName: "test", Z: 10, X: 1, Y: 1, Variant: "b"}, l.cacheRequest(ctxs[1], tile))
+	require.Equal(t, tile, l.cacheRequest(pkg.BackgroundContext(), tile))
+
+	// Never the same as a tile of a layer named like the variant was added to the name
+	require.NotEqual(t, pkg.TileRequest{LayerName: "test.a", Z: 10, X: 1, Y: 1}.String(), l.cacheRequest(ctxs[0], tile).String())
+}
@@ -127,6 +127,28 @@ func Test_ConstructLayerGroup_DuplicateLayerIDErrors(t *testing.T) {
 	require.Contains(t, err.Error(), "duplicate layer id")
 }
 
+func Test_ConstructLayerGroup_SharedLimiter(t *testing.T) {
+	RegisterProvider(docExampleSampleRegistration{})
+
+	vendor := &config.ClientConfig{MaxConcurrency: 2, Limiter: "vendor"}
+	layers := []config.LayerConfig{
+		{ID: "a", Provider: map[string]any{"name": "doc-example-sample"}, Client: vendor},
+		{ID: "b", Provider: map[string]any{"name": "doc-example-sample"}, Client: &config.ClientConfig{MaxConcurrency: 2, Limiter: "vendor"}},
+		{ID: "c", Provider: map[string]any{"name": "doc-example-sample"}, Client: &config.ClientConfig{MaxConcurrency: 2}},
+	}
+
+	lg, err := ConstructLayerGroup(config.Config{Client: config.DefaultConfig().Client, Layers: layers}, nil, nil, nil)
+	require.NoError(t, err)
+
+	assert.NotNil(t, lg.layers[0].limiter)
+	assert.Same(t, lg.layers[0].limiter, lg.layers[1].limiter)
+	assert.NotSame(t, lg.layers[0].limiter, lg.layers[2].limiter)
+
+	layers[1].Client = &config.ClientConfig{MaxConcurrency: 3, Limiter: "vendor"}
+	_, err = ConstructLayerGroup(config.Config{Client: config.DefaultConfig().Client, Layers: layers}, nil, nil, nil)
+	require.ErrorContains(t, err, "vendor")
+}
+
 func Test_ValidateRefs_DirectCycle(t *testing.T) {
 	layers := []config.LayerConfig{
 		{ID: "a", Provider: refProvider("b")},
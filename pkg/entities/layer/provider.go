@@ -17,6 +17,8 @@ package layer
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -47,6 +49,68 @@ type ProviderDeps struct {
 	// The group the provider belongs to, used by nesting providers to reach sibling layers
 	LayerGroup *LayerGroup
 	Datastores *datastore.DatastoreRegistry
+	// How many providers deep the provider being constructed is, counted by ConstructProvider
+	depth int
+	// Collects VaryCache calls for the layer the provider belongs to. nil outside of a layer
+	variants *cacheVariants
+}
+
+// cacheVariants are the parts of the request, beyond the tile itself, that the providers of a
+// layer give different tiles for
+type cacheVariants struct {
+	keys    []func(ctx context.Context) string
+	headers []string
+}
+
+// variant combines the keys for a request. Empty if none of them differ from the default
+func (v *cacheVariants) variant(ctx context.Context) string {
+	if v == nil || len(v.keys) == 0 {
+		return ""
+	}
+
+	keys := make([]string, len(v.keys))
+	varies := false
+
+	for i, key := range v.keys {
+		keys[i] = key(ctx)
+		varies = varies || keys[i] != ""
+	}
+
+	if !varies {
+		return ""
+	}
+
+	return strings.Join(keys, "-")
+}
+
+// VaryCache is for providers whose output depends on the request rather than just the tile, such
+// as one choosing a format by the Accept header. key gives what the output depends on for a
+// request, which the layer adds to its cache and coalescing keys so requests that differ by it
+// don't share a tile. Any request headers key reads are listed so they're sent back in Vary
+func (d ProviderDeps) VaryCache(key func(ctx context.Context) string, headers ...string) {
+	if d.variants == nil {
+		return
+	}
+
+	d.variants.keys = append(d.variants.keys, key)
+
+	for _, header := range headers {
+		if !slices.Contains(d.variants.headers, header) {
+			d.variants.headers = append(d.variants.headers, header)
+		}
+	}
+}
+
+// CacheVariant gives the variant the layer caches the request's tile under, made up of the keys
+// passed to VaryCache. Providers that keep tiles of their own can use it to keep variants apart too
+func (d ProviderDeps) CacheVariant(ctx context.Context) string {
+	return d.variants.variant(ctx)
+}
+
+// Nested reports whether the provider being constructed is inside another provider rather than
+// being the layer's own provider
+func (d ProviderDeps) Nested() bool {
+	return d.depth > 1
 }
 
 type ProviderRegistration interface {
@@ -92,6 +156,7 @@ func ConstructProvider(rawConfig map[string]interface{}, deps ProviderDeps) (Pro
 			if err != nil {
 				return nil, err
 			}
+			deps.depth++
 			provider, err := reg.Initialize(cfg, deps)
 
 			if err != nil {
@@ -32,6 +32,10 @@ const (
 	TypeOfErrorProvider
 	// Indicates something wrong with the incoming request besides what's covered in bounds
 	TypeOfErrorBadRequest
+	// Indicates requests to a provider are coming in faster than it's allowed to make them. Generally a 429
+	TypeOfErrorRateLimit
+	// Indicates a provider already has as many requests in flight as it's allowed. Generally a 503
+	TypeOfErrorUnavailable
 	// Indicates something that doesn't fall into the above categories. This is usually a real problem that the operator needs to be aware of. Generally a 500
 	TypeOfErrorOther
 )
@@ -143,6 +147,75 @@ func (e RemoteServerError) External(messages config.ErrorMessages) string {
 	return messages.ProviderError
 }
 
+// Indicates a request wasn't made because the circuit breaker for the server is open
+type CircuitOpenError struct {
+	Host string
+}
+
+func (e CircuitOpenError) Error() string {
+	// notest
+	return fmt.Sprintf("Circuit breaker is open for %v", e.Host)
+}
+
+func (e CircuitOpenError) Type() TypeOfError {
+	// notest
+	return TypeOfErrorProvider
+}
+
+func (e CircuitOpenError) External(messages config.ErrorMessages) string {
+	// notest
+	return messages.ProviderError
+}
+
+// Indicates a request waited too long for its layer's limits on outgoing requests to allow it
+type RateLimitError struct {
+	Layer       string
+	Concurrency bool // If true, it waited for another request to finish rather than for its turn under the rate
+}
+
+func (e RateLimitError) Error() string {
+	// notest
+	if e.Concurrency {
+		return fmt.Sprintf("Timed out waiting for a request for %v to finish", e.Layer)
+	}
+
+	return fmt.Sprintf("Timed out waiting for the rate limit of %v", e.Layer)
+}
+
+func (e RateLimitError) Type() TypeOfError {
+	// notest
+	if e.Concurrency {
+		return TypeOfErrorUnavailable
+	}
+
+	return TypeOfErrorRateLimit
+}
+
+func (e RateLimitError) External(messages config.ErrorMessages) string {
+	// notest
+	return messages.RateLimited
+}
+
+// Indicates the provider has no tile at the requested coordinates, such as outside the coverage of a pregenerated tile archive. Treated like a request outside the layer's bounds
+type TileNotFoundError struct {
+	Tile TileRequest
+}
+
+func (e TileNotFoundError) Error() string {
+	// notest
+	return fmt.Sprintf("No tile exists for %v", e.Tile)
+}
+
+func (e TileNotFoundError) Type() TypeOfError {
+	// notest
+	return TypeOfErrorBounds
+}
+
+func (e TileNotFoundError) External(messages config.ErrorMessages) string {
+	// notest
+	return messages.ProviderError
+}
+
 type InvalidSridError struct {
 	srid uint
 }
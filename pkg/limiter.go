@@ -0,0 +1,96 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"golang.org/x/time/rate"
+)
+
+// Limiter caps how quickly and how many requests at once a layer makes to remote servers. Requests
+// over the limits wait their turn for up to a configured time. A nil Limiter lets every request
+// through immediately
+type Limiter struct {
+	name string
+	wait time.Duration
+	// nil if there's no rate limit
+	rate *rate.Limiter
+	// Holds a value for each request in flight. nil if there's no concurrency limit
+	slots chan struct{}
+}
+
+// NewLimiter returns a limiter for the limits in the client configuration, or nil if there aren't
+// any. name identifies the limiter in errors
+func NewLimiter(name string, cfg config.ClientConfig) *Limiter {
+	if cfg.RateLimit <= 0 && cfg.MaxConcurrency == 0 {
+		return nil
+	}
+
+	l := &Limiter{name: name, wait: time.Duration(cfg.LimitWait) * time.Millisecond}
+
+	if cfg.RateLimit > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(cfg.RateLimit), max(int(cfg.RateBurst), 1)) // #nosec G115 -- burst sizes are small
+	}
+
+	if cfg.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConcurrency)
+	}
+
+	return l
+}
+
+// Acquire waits until the request is allowed, returning a function to call once it's finished. A
+// RateLimitError is returned if that takes too long
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, l.wait)
+	defer cancel()
+
+	release := func() {}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, RateLimitError{Layer: l.name, Concurrency: true}
+		}
+	}
+
+	if l.rate != nil {
+		// Fails straight away, rather than after waiting, if the wait would outlast waitCtx
+		if err := l.rate.Wait(waitCtx); err != nil {
+			release()
+
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, RateLimitError{Layer: l.name}
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LimiterUnlimited(t *testing.T) {
+	l := NewLimiter("l", config.ClientConfig{LimitWait: 10})
+	assert.Nil(t, l)
+
+	release, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func Test_LimiterConcurrency(t *testing.T) {
+	l := NewLimiter("l", config.ClientConfig{MaxConcurrency: 2, LimitWait: 50})
+
+	first, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	_, err = l.Acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = l.Acquire(context.Background())
+	var limitErr RateLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.True(t, limitErr.Concurrency)
+	assert.Equal(t, TypeOfError(TypeOfErrorUnavailable), limitErr.Type())
+
+	// Waits for a request to finish
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		first()
+	}()
+
+	_, err = l.Acquire(context.Background())
+	require.NoError(t, err)
+}
+
+func Test_LimiterRate(t *testing.T) {
+	l := NewLimiter("l", config.ClientConfig{RateLimit: 20, RateBurst: 2, LimitWait: 200})
+
+	start := time.Now()
+	for range 4 {
+		release, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		release()
+	}
+
+	// The burst goes straight through, then one every 50ms
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	l = NewLimiter("l", config.ClientConfig{RateLimit: 1, LimitWait: 100})
+	_, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = l.Acquire(context.Background())
+	var limitErr RateLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.False(t, limitErr.Concurrency)
+	assert.Equal(t, TypeOfError(TypeOfErrorRateLimit), limitErr.Type())
+}
+
+func Test_LimiterCanceled(t *testing.T) {
+	l := NewLimiter("l", config.ClientConfig{MaxConcurrency: 1, LimitWait: 1000})
+
+	_, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = l.Acquire(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
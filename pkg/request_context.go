@@ -36,6 +36,8 @@ const allowedAreaKey = "allowedArea"
 const userIDKey = "user"
 const layerPatternMatchesKey = "layerPatternMatches"
 const refDepthKey = "refDepth"
+const circuitBreakerKey = "circuitBreaker"
+const limiterKey = "limiter"
 
 func p[A any](val A) *A {
 	return &val
@@ -129,6 +131,34 @@ func RefDepthFromContext(ctx context.Context) (*int, bool) {
 	return u, ok
 }
 
+// The circuit breaker of the layer currently generating a tile, used for outgoing requests
+func CircuitBreakerFromContext(ctx context.Context) (*CircuitBreaker, bool) {
+	u, ok := ctx.Value(circuitBreakerKey).(*CircuitBreaker)
+	return u, ok
+}
+
+// Sets the circuit breaker outgoing requests made with the returned context should use. nil turns
+// off the circuit breaker
+//
+//nolint:revive,staticcheck // We want values to be accessible
+func WithCircuitBreaker(ctx context.Context, breaker *CircuitBreaker) context.Context {
+	return context.WithValue(ctx, circuitBreakerKey, breaker)
+}
+
+// The limiter of the layer currently generating a tile, used for outgoing requests
+func LimiterFromContext(ctx context.Context) (*Limiter, bool) {
+	u, ok := ctx.Value(limiterKey).(*Limiter)
+	return u, ok
+}
+
+// Sets the limiter outgoing requests made with the returned context should wait on. nil turns off
+// the limits
+//
+//nolint:revive,staticcheck // We want values to be accessible
+func WithLimiter(ctx context.Context, limiter *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey, limiter)
+}
+
 func BackgroundContext() context.Context {
 	req, _ := http.NewRequestWithContext(context.Background(), "", "", nil)
 	return NewRequestContext(req)
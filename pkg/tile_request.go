@@ -45,6 +45,9 @@ type TileRequest struct {
 	Z         int
 	X         int
 	Y         int
+	// Set when the layer's tiles differ between requests for the same coordinates, such as by the
+	// format negotiated from the Accept header, so each variant is cached separately. Usually empty
+	Variant string
 }
 
 func (t TileRequest) GetBounds() (*Bounds, error) {
@@ -118,9 +121,16 @@ func (t TileRequest) String() string {
 	return t.StringWithSeparator("/")
 }
 
-// Generates a string representation of the tile request with an arbitrary separator between values
+// Generates a string representation of the tile request with an arbitrary separator between values.
+// The variant, if any, follows a ~ after the coordinates, which keeps it from ever matching the
+// string of another layer's tile
 func (t TileRequest) StringWithSeparator(sep string) string {
-	return t.LayerName + sep + strconv.Itoa(t.Z) + sep + strconv.Itoa(t.X) + sep + strconv.Itoa(t.Y)
+	str := t.LayerName + sep + strconv.Itoa(t.Z) + sep + strconv.Itoa(t.X) + sep + strconv.Itoa(t.Y)
+	if t.Variant != "" {
+		str += "~" + t.Variant
+	}
+
+	return str
 }
 
 type Bounds struct {
@@ -201,7 +211,7 @@ func (b Bounds) FindTiles(layerName string, zoom uint, force bool) (*[]TileReque
 
 	for x := xMin; x < xMax; x++ {
 		for y := yMin; y < yMax; y++ {
-			result[(y-yMin)*(xMax-xMin)+x-xMin] = TileRequest{layerName, int(zoom), x, y}
+			result[(y-yMin)*(xMax-xMin)+x-xMin] = TileRequest{LayerName: layerName, Z: int(zoom), X: x, Y: y}
 		}
 	}
 
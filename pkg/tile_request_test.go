@@ -65,7 +65,7 @@ func TestBoundsToTileZoom8(t *testing.T) {
 }
 
 func TestTileToBoundsZoom0(t *testing.T) {
-	r := TileRequest{"layer", 0, 0, 0}
+	r := TileRequest{LayerName: "layer", Z: 0, X: 0, Y: 0}
 
 	b, err := r.GetBounds()
 
@@ -76,7 +76,7 @@ func TestTileToBoundsZoom0(t *testing.T) {
 	assert.InDelta(t, 180.0, b.East, .0001)
 }
 func TestTileToBoundsZoom8(t *testing.T) {
-	r := TileRequest{"layer", 8, 132, 85}
+	r := TileRequest{LayerName: "layer", Z: 8, X: 132, Y: 85}
 
 	b, err := r.GetBounds()
 
@@ -87,8 +87,13 @@ func TestTileToBoundsZoom8(t *testing.T) {
 	assert.InDelta(t, 7.031250, .0001, b.East)
 }
 
+func TestTileRequestString(t *testing.T) {
+	assert.Equal(t, "layer/1/2/3", TileRequest{LayerName: "layer", Z: 1, X: 2, Y: 3}.String())
+	assert.Equal(t, "layer_1_2_3~jpeg", TileRequest{LayerName: "layer", Z: 1, X: 2, Y: 3, Variant: "jpeg"}.StringWithSeparator("_"))
+}
+
 func TestTileRequestRangeError(t *testing.T) {
-	r := TileRequest{"layer", 2, 0, 5}
+	r := TileRequest{LayerName: "layer", Z: 2, X: 0, Y: 5}
 
 	b, err := r.GetBounds()
 
@@ -181,7 +186,7 @@ func FuzzToBoundsAndBack(f *testing.F) {
 		f.Add(z, int(math.Exp2(float64(z))/2), int(math.Exp2(float64(z))/2))
 	}
 	f.Fuzz(func(t *testing.T, z int, x int, y int) {
-		orig := TileRequest{"layer", z, x, y}
+		orig := TileRequest{LayerName: "layer", Z: z, X: x, Y: y}
 		b, err := orig.GetBounds()
 		require.NoError(t, err)
 
@@ -0,0 +1,151 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// The parts of the client configuration that decide how connections are made
+type transportKey struct {
+	proxy               string
+	noProxy             string
+	tlsCert             string
+	tlsKey              string
+	tlsCA               string
+	insecureSkipVerify  bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     uint
+	disableHTTP2        bool
+}
+
+var (
+	transports      = make(map[transportKey]http.RoundTripper)
+	transportsMutex sync.Mutex
+)
+
+// ClientTransport gives the transport to make requests with for the client configuration. It's
+// built the first time and shared by every configuration with the same connection settings, so
+// connections are reused between requests and layers
+func ClientTransport(clientConfig config.ClientConfig) (http.RoundTripper, error) {
+	key := transportKey{
+		clientConfig.Proxy,
+		clientConfig.NoProxy,
+		clientConfig.TLSCert,
+		clientConfig.TLSKey,
+		clientConfig.TLSCA,
+		clientConfig.InsecureSkipVerify,
+		clientConfig.MaxIdleConns,
+		clientConfig.MaxIdleConnsPerHost,
+		clientConfig.MaxConnsPerHost,
+		clientConfig.IdleConnTimeout,
+		clientConfig.DisableHTTP2,
+	}
+
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+
+	if transport, ok := transports[key]; ok {
+		return transport, nil
+	}
+
+	transport, err := newTransport(key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := otelhttp.NewTransport(transport, otelhttp.WithMessageEvents(otelhttp.ReadEvents))
+	transports[key] = wrapped
+
+	return wrapped, nil
+}
+
+func newTransport(key transportKey) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if key.proxy != "" {
+		proxyURL, err := neturl.Parse(key.proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid client proxy %v", RedactURLForLog(key.proxy))
+		}
+
+		proxyFunc := (&httpproxy.Config{HTTPProxy: key.proxy, HTTPSProxy: key.proxy, NoProxy: key.noProxy}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*neturl.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if key.tlsCert != "" || key.tlsKey != "" {
+		if key.tlsCert == "" || key.tlsKey == "" {
+			return nil, errors.New("client tlscert and tlskey must be used together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(key.tlsCert, key.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if key.tlsCA != "" {
+		pem, err := os.ReadFile(key.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client tlsca: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client tlsca %v", key.tlsCA)
+		}
+
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	transport.TLSClientConfig.InsecureSkipVerify = key.insecureSkipVerify // #nosec G402 -- opt in for testing
+
+	transport.MaxIdleConns = key.maxIdleConns
+	transport.MaxIdleConnsPerHost = key.maxIdleConnsPerHost
+	transport.MaxConnsPerHost = key.maxConnsPerHost
+	transport.IdleConnTimeout = time.Duration(key.idleConnTimeout) * time.Second
+
+	if key.disableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		// A non-nil empty map is what turns off HTTP/2 in the standard library. The cloned TLS
+		// config still offers h2 to the server though, so only ask for HTTP/1.1
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	return transport, nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2026 Michael Davis
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Michad/tilegroxy/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tileClientConfig() config.ClientConfig {
+	return config.ClientConfig{
+		StatusCodes:  []int{http.StatusOK},
+		ContentTypes: []string{"image/png"},
+		MaxLength:    1024,
+		Timeout:      5,
+	}
+}
+
+func tileHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write([]byte("tiledata"))
+}
+
+func writePEM(t *testing.T, name string, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+// Makes a CA and a client certificate signed by it, returning the CA and the paths of the client's cert and key
+func makeClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "tilegroxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, ca, &clientKey.PublicKey, caKey)
+	require.NoError(t, err)
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+
+	return ca, writePEM(t, "client.crt", "CERTIFICATE", clientDER), writePEM(t, "client.key", "EC PRIVATE KEY", clientKeyDER)
+}
+
+func Test_ClientTransportProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		tileHandler(w, r)
+	}))
+	defer proxy.Close()
+
+	clientConfig := tileClientConfig()
+	clientConfig.Proxy = proxy.URL
+	clientConfig.NoProxy = "internal.example.com"
+
+	img, err := GetTile(context.Background(), clientConfig, "http://tiles.example.com/1/2/3.png", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+	assert.Equal(t, []string{"http://tiles.example.com/1/2/3.png"}, proxied)
+
+	transport, err := newTransport(transportKey{proxy: proxy.URL, noProxy: "internal.example.com"})
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://tiles.example.com/1/2/3.png", nil)
+	proxyURL, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, proxy.URL, proxyURL.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "http://a.internal.example.com/1/2/3.png", nil)
+	proxyURL, err = transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+}
+
+func Test_ClientTransportInvalid(t *testing.T) {
+	_, err := ClientTransport(config.ClientConfig{Proxy: "not a url"})
+	require.Error(t, err)
+
+	_, err = ClientTransport(config.ClientConfig{TLSCert: "client.crt"})
+	require.Error(t, err)
+
+	_, err = ClientTransport(config.ClientConfig{TLSCert: "missing.crt", TLSKey: "missing.key"})
+	require.Error(t, err)
+
+	_, err = ClientTransport(config.ClientConfig{TLSCA: "missing.pem"})
+	require.Error(t, err)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("hello"), 0600))
+	_, err = ClientTransport(config.ClientConfig{TLSCA: notPEM})
+	require.Error(t, err)
+}
+
+func Test_ClientTransportMutualTLS(t *testing.T) {
+	ca, certFile, keyFile := makeClientCert(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(tileHandler))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	clientConfig := tileClientConfig()
+
+	// Server isn't trusted
+	_, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.Error(t, err)
+
+	// Trusted but no client certificate
+	clientConfig.TLSCA = writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	_, err = GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.Error(t, err)
+
+	clientConfig.TLSCert = certFile
+	clientConfig.TLSKey = keyFile
+	img, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+}
+
+func Test_ClientTransportInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(tileHandler))
+	defer server.Close()
+
+	clientConfig := tileClientConfig()
+	clientConfig.InsecureSkipVerify = true
+
+	img, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+}
+
+func Test_ClientTransportDisableHTTP2(t *testing.T) {
+	var protos []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos = append(protos, r.Proto)
+		tileHandler(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	clientConfig := tileClientConfig()
+	clientConfig.InsecureSkipVerify = true
+
+	img, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+
+	clientConfig.DisableHTTP2 = true
+	img, err = GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+
+	assert.Equal(t, []string{"HTTP/2.0", "HTTP/1.1"}, protos)
+}
+
+func Test_ClientTransportPool(t *testing.T) {
+	transport, err := newTransport(transportKey{maxIdleConns: 50, maxIdleConnsPerHost: 10, maxConnsPerHost: 20, idleConnTimeout: 30, disableHTTP2: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, 50, transport.MaxIdleConns)
+	assert.Equal(t, 10, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, transport.MaxConnsPerHost)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+
+	// Same settings share a transport
+	first, err := ClientTransport(config.ClientConfig{MaxIdleConns: 50})
+	require.NoError(t, err)
+	second, err := ClientTransport(config.ClientConfig{MaxIdleConns: 50, Timeout: 5})
+	require.NoError(t, err)
+	third, err := ClientTransport(config.ClientConfig{MaxIdleConns: 40})
+	require.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.NotSame(t, first, third)
+}
@@ -36,7 +36,6 @@ import (
 
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/Michad/tilegroxy/pkg/static"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -285,29 +284,12 @@ func RedactURLForLog(rawURL string) string {
 func GetTile(ctx context.Context, clientConfig config.ClientConfig, url string, authHeaders map[string]string) (*Image, error) {
 	slog.DebugContext(ctx, fmt.Sprintf("Calling url %v\n", RedactURLForLog(url)))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := newClientRequest(ctx, clientConfig, url, authHeaders)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", clientConfig.UserAgent)
-
-	for h, v := range clientConfig.Headers {
-		req.Header.Set(h, v)
-	}
-
-	for h, v := range authHeaders {
-		req.Header.Set(h, v)
-	}
-
-	if clientConfig.Timeout > math.MaxInt32 {
-		clientConfig.Timeout = math.MaxInt32
-	}
-
-	transport := otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithMessageEvents(otelhttp.ReadEvents))
-	client := http.Client{Transport: transport, Timeout: time.Duration(clientConfig.Timeout) * time.Second}
-
-	resp, err := client.Do(req)
+	resp, err := doClientRequest(clientConfig, req)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -359,6 +341,179 @@ func GetTile(ctx context.Context, clientConfig config.ClientConfig, url string,
 	return &Image{Content: img, ContentType: contentType}, nil
 }
 
+// GetRange performs a GET operation for length bytes starting at offset of the given URL using an
+// HTTP range request. This is for providers that read part of a larger archive, so unlike GetTile
+// the status code and content-type allowlists don't apply: the server must answer with 206 Partial
+// Content and whatever type it serves the archive as. Headers, timeout, and MaxLength are applied
+// as normal.
+func GetRange(ctx context.Context, clientConfig config.ClientConfig, url string, offset uint64, length uint64) ([]byte, error) {
+	slog.DebugContext(ctx, fmt.Sprintf("Calling url %v for bytes %v-%v\n", RedactURLForLog(url), offset, offset+length-1))
+
+	if length == 0 {
+		return []byte{}, nil
+	}
+
+	if length > uint64(clientConfig.MaxLength) { // #nosec G115 -- MaxLength is never negative
+		return nil, &InvalidContentLengthError{Length: int(min(length, math.MaxInt32))} // #nosec G115 -- clamped
+	}
+
+	req, err := newClientRequest(ctx, clientConfig, url, map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doClientRequest(clientConfig, req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, fmt.Sprintf("Response status: %v", resp.StatusCode))
+
+	// A 200 means the server ignored the range and is sending the whole archive
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, &RemoteServerError{StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(length)+1)) // #nosec G115 -- bounded by MaxLength above
+	if err != nil {
+		return nil, &RemoteServerError{StatusCode: resp.StatusCode}
+	}
+
+	if uint64(len(data)) != length {
+		return nil, &InvalidContentLengthError{Length: len(data)}
+	}
+
+	return data, nil
+}
+
+func newClientRequest(ctx context.Context, clientConfig config.ClientConfig, url string, extraHeaders map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", clientConfig.UserAgent)
+
+	for h, v := range clientConfig.Headers {
+		req.Header.Set(h, v)
+	}
+
+	for h, v := range extraHeaders {
+		req.Header.Set(h, v)
+	}
+
+	return req, nil
+}
+
+// doClientRequest makes the request, retrying failures that are worth retrying, and goes through
+// the limiter and circuit breaker of the layer making the request if there are any
+func doClientRequest(clientConfig config.ClientConfig, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	breaker, _ := CircuitBreakerFromContext(ctx)
+	limiter, _ := LimiterFromContext(ctx)
+	host := req.URL.Host
+
+	if err := breaker.Allow(ctx, host); err != nil {
+		return nil, err
+	}
+
+	resp, err := doClientRequestWithRetries(clientConfig, req, limiter)
+
+	// The caller giving up or the layer being over its limits says nothing about the server
+	if ctx.Err() != nil || errors.As(err, new(RateLimitError)) {
+		breaker.Release(host)
+	} else {
+		breaker.Record(ctx, host, err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests)
+	}
+
+	return resp, err
+}
+
+// doClientRequestWithRetries waits on the limiter before every attempt, including retries, so
+// retrying doesn't take the layer over its limits. The limiter isn't held while waiting to retry
+func doClientRequestWithRetries(clientConfig config.ClientConfig, req *http.Request, limiter *Limiter) (*http.Response, error) {
+	ctx := req.Context()
+
+	if clientConfig.Timeout > math.MaxInt32 {
+		clientConfig.Timeout = math.MaxInt32
+	}
+
+	transport, err := ClientTransport(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Transport: transport, Timeout: time.Duration(clientConfig.Timeout) * time.Second}
+
+	maxBackoff := time.Duration(clientConfig.RetryMaxBackoff) * time.Millisecond
+	backoff := min(time.Duration(clientConfig.RetryBackoff)*time.Millisecond, maxBackoff)
+
+	for attempt := uint(1); ; attempt++ {
+		release, err := limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		release()
+
+		retryable := ctx.Err() == nil && (err != nil || slices.Contains(clientConfig.RetryStatusCodes, resp.StatusCode))
+		if attempt > clientConfig.Retries || !retryable {
+			return resp, err
+		}
+
+		// Jittered so that clients that failed together don't all retry together
+		delay := backoff/2 + rand.N(backoff/2+1) // #nosec G404 -- jitter doesn't need to be unpredictable
+		backoff = min(backoff*2, maxBackoff)
+
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > maxBackoff {
+					slog.DebugContext(ctx, fmt.Sprintf("Not retrying since the server asked to wait %v", retryAfter))
+					return resp, err
+				}
+
+				delay = max(delay, retryAfter)
+			}
+
+			// Drained so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, int64(clientConfig.MaxLength)))
+			resp.Body.Close()
+
+			slog.DebugContext(ctx, fmt.Sprintf("Retrying in %v after status %v", delay, resp.StatusCode))
+		} else {
+			slog.DebugContext(ctx, fmt.Sprintf("Retrying in %v after error %v", delay, err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(header, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
 // cond ? a : b
 func Ternary[T any](cond bool, a T, b T) T {
 	if cond {
@@ -18,7 +18,9 @@ import (
 	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Michad/tilegroxy/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -268,6 +270,248 @@ func Test_GetTile(t *testing.T) {
 	assert.Equal(t, "image/png", img.ContentType)
 }
 
+func Test_GetRange(t *testing.T) {
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte("ile"))
+	}))
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		MaxLength: 1024,
+		Timeout:   5,
+	}
+
+	data, err := GetRange(context.Background(), clientConfig, server.URL, 1, 3)
+
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ile"), data)
+	assert.Equal(t, "bytes=1-3", gotRange)
+
+	_, err = GetRange(context.Background(), clientConfig, server.URL, 0, 2048)
+	require.ErrorAs(t, err, new(*InvalidContentLengthError))
+}
+
+// flakyServer fails with the given status until it's been called failures times
+func flakyServer(failures int32, status int, retryAfter string, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("tiledata"))
+	}))
+}
+
+func Test_GetTileRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(2, http.StatusBadGateway, "", &calls)
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		StatusCodes:      []int{http.StatusOK},
+		ContentTypes:     []string{"image/png"},
+		MaxLength:        1024,
+		Timeout:          5,
+		Retries:          2,
+		RetryBackoff:     10,
+		RetryMaxBackoff:  50,
+		RetryStatusCodes: []int{http.StatusBadGateway},
+	}
+
+	img, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tiledata"), img.Content)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Out of retries
+	calls.Store(0)
+	clientConfig.Retries = 1
+	_, err = GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.ErrorAs(t, err, new(*RemoteServerError))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Not a status worth retrying
+	calls.Store(0)
+	clientConfig.Retries = 2
+	clientConfig.RetryStatusCodes = []int{http.StatusServiceUnavailable}
+	_, err = GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func Test_GetTileRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(1, http.StatusTooManyRequests, "1", &calls)
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		StatusCodes:      []int{http.StatusOK},
+		ContentTypes:     []string{"image/png"},
+		MaxLength:        1024,
+		Timeout:          5,
+		Retries:          1,
+		RetryBackoff:     10,
+		RetryMaxBackoff:  2000,
+		RetryStatusCodes: []int{http.StatusTooManyRequests},
+	}
+
+	start := time.Now()
+	_, err := GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// Waiting longer than the max backoff isn't worth it
+	calls.Store(0)
+	clientConfig.RetryMaxBackoff = 500
+	_, err = GetTile(context.Background(), clientConfig, server.URL, nil)
+	require.ErrorAs(t, err, new(*RemoteServerError))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func Test_ParseRetryAfter(t *testing.T) {
+	delay, ok := parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), delay.Seconds(), 2)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+}
+
+func Test_GetTileCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(1000, http.StatusInternalServerError, "", &calls)
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		StatusCodes:  []int{http.StatusOK},
+		ContentTypes: []string{"image/png"},
+		MaxLength:    1024,
+		Timeout:      5,
+	}
+
+	breaker := NewCircuitBreaker(config.CircuitBreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: 60, Cooldown: 60}, nil)
+	ctx := WithCircuitBreaker(context.Background(), breaker)
+
+	for range 4 {
+		_, err := GetTile(ctx, clientConfig, server.URL, nil)
+		require.ErrorAs(t, err, new(*RemoteServerError))
+	}
+
+	// Now open so the server isn't called
+	_, err := GetTile(ctx, clientConfig, server.URL, nil)
+	require.ErrorAs(t, err, new(CircuitOpenError))
+	assert.Equal(t, int32(4), calls.Load())
+
+	// Other servers aren't affected
+	other := flakyServer(0, 0, "", &atomic.Int32{})
+	defer other.Close()
+
+	_, err = GetTile(ctx, clientConfig, other.URL, nil)
+	require.NoError(t, err)
+}
+
+func Test_GetTileLimiter(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(0, 0, "", &calls)
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		StatusCodes:  []int{http.StatusOK},
+		ContentTypes: []string{"image/png"},
+		MaxLength:    1024,
+		Timeout:      5,
+	}
+
+	limiter := NewLimiter("test", config.ClientConfig{MaxConcurrency: 1, LimitWait: 10})
+	ctx := WithLimiter(context.Background(), limiter)
+
+	// Released once the request is done
+	for range 2 {
+		_, err := GetTile(ctx, clientConfig, server.URL, nil)
+		require.NoError(t, err)
+	}
+
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = GetTile(ctx, clientConfig, server.URL, nil)
+	require.ErrorAs(t, err, new(RateLimitError))
+	assert.Equal(t, int32(2), calls.Load())
+
+	release()
+	_, err = GetTile(ctx, clientConfig, server.URL, nil)
+	require.NoError(t, err)
+}
+
+func Test_GetTileLimiterRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := flakyServer(1000, http.StatusBadGateway, "", &calls)
+	defer server.Close()
+
+	clientConfig := config.ClientConfig{
+		StatusCodes:      []int{http.StatusOK},
+		ContentTypes:     []string{"image/png"},
+		MaxLength:        1024,
+		Timeout:          5,
+		Retries:          20,
+		RetryBackoff:     1,
+		RetryMaxBackoff:  5,
+		RetryStatusCodes: []int{http.StatusBadGateway},
+	}
+
+	// Every retry waits its turn, so a second allows the first attempt plus five more
+	limiter := NewLimiter("test", config.ClientConfig{RateLimit: 5, RateBurst: 1, LimitWait: 5000})
+	ctx, cancel := context.WithTimeout(WithLimiter(context.Background(), limiter), time.Second)
+	defer cancel()
+
+	_, err := GetTile(ctx, clientConfig, server.URL, nil)
+	require.Error(t, err)
+	assert.LessOrEqual(t, calls.Load(), int32(6))
+	assert.GreaterOrEqual(t, calls.Load(), int32(4))
+
+	// Waiting to retry doesn't hold a place other requests could use
+	calls.Store(0)
+	clientConfig.Retries = 1
+	clientConfig.RetryBackoff = 500
+	clientConfig.RetryMaxBackoff = 500
+
+	limiter = NewLimiter("test", config.ClientConfig{MaxConcurrency: 1, LimitWait: 100})
+	ctx = WithLimiter(context.Background(), limiter)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := GetTile(ctx, clientConfig, server.URL, nil)
+		assert.ErrorAs(t, err, new(*RemoteServerError))
+	}()
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	other := flakyServer(0, 0, "", &atomic.Int32{})
+	defer other.Close()
+
+	_, err = GetTile(ctx, clientConfig, other.URL, nil)
+	require.NoError(t, err)
+	<-done
+	assert.Equal(t, int32(2), calls.Load())
+}
+
 func Fuzz_EncodeDecodeImage(f *testing.F) {
 	for z := 1; z < 100; z++ {
 		b := make([]byte, rand.IntN(1000))